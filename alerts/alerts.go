@@ -0,0 +1,339 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+// Package alerts evaluates threshold and rate of change rules over numeric
+// Report fields. Rules support a minimum duration, hysteresis and a cooldown,
+// so a value hovering around a threshold raises a single Alert.
+package alerts
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/tannerryan/davisweather"
+)
+
+const (
+	// evaluateInterval is how often Run evaluates rules between Events
+	evaluateInterval = 10 * time.Second
+	// alertBuffer is the capacity of the channel returned by Run
+	alertBuffer = 16
+)
+
+var (
+	// ErrInvalidRule is returned when a rule is missing a name or field, has a
+	// duplicate name, or has a negative duration or hysteresis
+	ErrInvalidRule = errors.New("alerts: invalid rule")
+	// ErrUnknownCondition is returned when a rule has an unknown Condition
+	ErrUnknownCondition = errors.New("alerts: unknown condition")
+	// ErrMissingWindow is returned when a rate rule has no Window
+	ErrMissingWindow = errors.New("alerts: rate condition requires window")
+)
+
+// Condition is how a rule compares a field to its threshold.
+type Condition string
+
+const (
+	// Above is met when the value is greater than the threshold
+	Above Condition = "above"
+	// Below is met when the value is less than the threshold
+	Below Condition = "below"
+	// Rise is met when the value increased by more than the threshold over the
+	// window
+	Rise Condition = "rise"
+	// Fall is met when the value decreased by more than the threshold over the
+	// window
+	Fall Condition = "fall"
+)
+
+// State is the state of an Alert.
+type State string
+
+const (
+	// Raised is emitted when a rule is met
+	Raised State = "raised"
+	// Cleared is emitted when a raised rule is no longer met
+	Cleared State = "cleared"
+)
+
+// Rule is a condition over a numeric Report field.
+type Rule struct {
+	Name       string        `json:"name"`       // Name is the unique name of the rule
+	Field      string        `json:"field"`      // Field is the JSON name of the Report field
+	Condition  Condition     `json:"condition"`  // Condition is how the field is compared to the Threshold
+	Threshold  float64       `json:"threshold"`  // Threshold is the value, or change over the Window for rates, in the units of the Report
+	Window     time.Duration `json:"window"`     // Window is the duration of the change for Rise and Fall
+	For        time.Duration `json:"for"`        // For is how long the condition must hold before raising (optional)
+	Hysteresis float64       `json:"hysteresis"` // Hysteresis is how far past the Threshold the value must return before clearing (optional)
+	Cooldown   time.Duration `json:"cooldown"`   // Cooldown is the minimum time between raises of the rule (optional)
+}
+
+// Alert is a raised or cleared rule.
+type Alert struct {
+	Rule    Rule      `json:"rule"`    // Rule is the rule that changed state
+	State   State     `json:"state"`   // State is the new state of the rule
+	Value   float64   `json:"value"`   // Value is the compared value (the field value, or change over the Window for rates)
+	Current float64   `json:"current"` // Current is the field value
+	Since   time.Time `json:"since"`   // Since is when the condition started to hold (Raised) or the rule was raised (Cleared)
+	Time    time.Time `json:"time"`    // Time is when the rule changed state
+}
+
+// Engine evaluates rules over observed values.
+type Engine struct {
+	rules    []*rule             // rules are the evaluated rules, in order
+	index    map[string]struct{} // index are the rule names
+	values   map[string]float64  // values are the most recently observed values
+	observed time.Time           // observed is the time of the most recent observation
+	received time.Time           // received is the wall time of the most recent observation
+	mutex    *sync.Mutex         // mutex is for atomic engine actions
+}
+
+// rule is the evaluation state of a Rule.
+type rule struct {
+	Rule
+	samples []sample  // samples are the values within the rate window, oldest first
+	pending time.Time // pending is when the condition started to hold (zero if not held)
+	raised  bool      // raised indicates the rule is raised
+	since   time.Time // since is when the rule was raised
+	last    time.Time // last is when the rule was last raised
+}
+
+// sample is an observed value of a field.
+type sample struct {
+	at    time.Time // at is when the value was observed
+	value float64   // value is the observed value
+}
+
+// New returns an Engine evaluating the provided rules. It returns an error if a
+// rule is invalid.
+func New(rules []Rule) (*Engine, error) {
+	e := &Engine{
+		index: make(map[string]struct{}),
+		mutex: &sync.Mutex{},
+	}
+	for _, r := range rules {
+		if r.Name == "" || r.Field == "" || r.For < 0 || r.Hysteresis < 0 || r.Cooldown < 0 {
+			return nil, ErrInvalidRule
+		}
+		if _, ok := e.index[r.Name]; ok {
+			return nil, ErrInvalidRule
+		}
+		switch r.Condition {
+		case Above, Below:
+		case Rise, Fall:
+			if r.Window <= 0 {
+				return nil, ErrMissingWindow
+			}
+		default:
+			return nil, ErrUnknownCondition
+		}
+		e.index[r.Name] = struct{}{}
+		e.rules = append(e.rules, &rule{Rule: r})
+	}
+	return e, nil
+}
+
+// Run evaluates the rules with every Event of the Client, and every 10 seconds
+// between Events so duration rules are raised while the Report is unchanged.
+// Between Events, rules only advance while the Client receives weather
+// conditions, so duration rules are not raised while the station is dark. The
+// returned channel receives every Alert and is closed when the context is
+// cancelled.
+func (e *Engine) Run(ctx context.Context, c *davisweather.Client) <-chan Alert {
+	alerts := make(chan Alert, alertBuffer)
+	events := c.Subscribe(ctx, davisweather.SubscribeOptions{Buffer: 16, Policy: davisweather.DropOldest})
+	if report, err := c.Report(); err == nil && !report.Timestamp.IsZero() {
+		e.mutex.Lock()
+		e.values = report.Values()
+		e.observed = report.Timestamp
+		e.received = time.Now()
+		e.mutex.Unlock()
+	}
+
+	go func() {
+		defer close(alerts)
+		ticker := time.NewTicker(evaluateInterval)
+		defer ticker.Stop()
+		for {
+			var raised []Alert
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				raised = e.Update(event.Report)
+			case <-ticker.C:
+				status := c.Status()
+				received := status.LastUDP
+				if status.LastHTTP.After(received) {
+					received = status.LastHTTP
+				}
+				raised = e.evaluate(received)
+			case <-ctx.Done():
+				return
+			}
+			for _, alert := range raised {
+				select {
+				case alerts <- alert:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return alerts
+}
+
+// Update evaluates the rules with the numeric fields of the Report at the
+// Report Timestamp, returning the resulting Alerts.
+func (e *Engine) Update(r *davisweather.Report) []Alert {
+	return e.Observe(r.Timestamp, r.Values())
+}
+
+// Observe evaluates the rules with the values observed at the provided time,
+// keyed by field name, returning the resulting Alerts in rule order. Rules
+// whose field is not provided are not evaluated, and restart their For
+// duration. Observations older than the
+// most recent observation are ignored.
+func (e *Engine) Observe(at time.Time, values map[string]float64) []Alert {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if at.Before(e.observed) {
+		return nil
+	}
+	e.values = values
+	e.observed = at
+	e.received = time.Now()
+	return e.observe(at)
+}
+
+// Active returns the raised rules, in rule order.
+func (e *Engine) Active() []Rule {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	var active []Rule
+	for _, r := range e.rules {
+		if r.raised {
+			active = append(active, r.Rule)
+		}
+	}
+	return active
+}
+
+// evaluate re-evaluates the rules with the most recent values, advancing the
+// observation time by the wall time elapsed since they were observed, up to
+// the wall time weather conditions were last received. Values that have not
+// been received since they were observed are stale, and are not advanced.
+func (e *Engine) evaluate(received time.Time) []Alert {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.values == nil {
+		return nil
+	}
+	elapsed := received.Sub(e.received)
+	if elapsed <= 0 {
+		return nil
+	}
+	return e.observe(e.observed.Add(elapsed))
+}
+
+// observe evaluates every rule with the most recent values at the provided
+// time. Rules whose field is not provided restart their duration.
+func (e *Engine) observe(at time.Time) []Alert {
+	var alerts []Alert
+	for _, r := range e.rules {
+		current, ok := e.values[r.Field]
+		if !ok {
+			r.pending = time.Time{}
+			continue
+		}
+		if alert, ok := r.observe(at, current); ok {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts
+}
+
+// observe evaluates the rule with the field value observed at the provided
+// time. It returns true if the rule changed state.
+func (r *rule) observe(at time.Time, current float64) (Alert, bool) {
+	value, ok := r.value(at, current)
+	if !ok {
+		return Alert{}, false
+	}
+
+	if r.raised {
+		if !r.cleared(value) {
+			return Alert{}, false
+		}
+		r.raised = false
+		r.pending = time.Time{}
+		return Alert{Rule: r.Rule, State: Cleared, Value: value, Current: current, Since: r.since, Time: at}, true
+	}
+
+	if !r.met(value) {
+		r.pending = time.Time{}
+		return Alert{}, false
+	}
+	if r.pending.IsZero() {
+		r.pending = at
+	}
+	if at.Sub(r.pending) < r.For {
+		return Alert{}, false
+	}
+	if !r.last.IsZero() && at.Sub(r.last) < r.Cooldown {
+		return Alert{}, false
+	}
+	r.raised = true
+	r.since = at
+	r.last = at
+	return Alert{Rule: r.Rule, State: Raised, Value: value, Current: current, Since: r.pending, Time: at}, true
+}
+
+// value returns the compared value of the rule: the field value, or the change
+// over the Window for rates. It returns false if the rate window is not yet
+// covered.
+func (r *rule) value(at time.Time, current float64) (float64, bool) {
+	if r.Condition == Above || r.Condition == Below {
+		return current, true
+	}
+
+	r.samples = append(r.samples, sample{at: at, value: current})
+	// keep the newest sample at or before the window start as the baseline
+	cutoff := at.Add(-r.Window)
+	i := 0
+	for i+1 < len(r.samples) && !r.samples[i+1].at.After(cutoff) {
+		i++
+	}
+	r.samples = append(r.samples[:0], r.samples[i:]...)
+	if r.samples[0].at.After(cutoff) {
+		return 0, false
+	}
+	change := current - r.samples[0].value
+	if r.Condition == Fall {
+		return -change, true
+	}
+	return change, true
+}
+
+// met returns true if the compared value meets the condition.
+func (r *rule) met(value float64) bool {
+	if r.Condition == Below {
+		return value < r.Threshold
+	}
+	return value > r.Threshold
+}
+
+// cleared returns true if the compared value has returned past the threshold
+// by the hysteresis.
+func (r *rule) cleared(value float64) bool {
+	if r.Condition == Below {
+		return value >= r.Threshold+r.Hysteresis
+	}
+	return value <= r.Threshold-r.Hysteresis
+}
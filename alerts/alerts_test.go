@@ -0,0 +1,176 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package alerts
+
+import (
+	"testing"
+	"time"
+)
+
+// start is the time of the first observation of each test
+var start = time.Date(2020, 6, 16, 14, 0, 0, 0, time.UTC)
+
+// step is an observation and the expected Alert states.
+type step struct {
+	after  time.Duration      // after is the time of the observation since start
+	values map[string]float64 // values are the observed values
+	want   []State            // want are the expected Alert states
+}
+
+// temp returns the values with the temperature.
+func temp(v float64) map[string]float64 {
+	return map[string]float64{"temperature": v}
+}
+
+// run observes the steps with a single rule, checking the Alert states.
+func run(t *testing.T, r Rule, steps []step) []Alert {
+	t.Helper()
+	e, err := New([]Rule{r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all []Alert
+	for _, s := range steps {
+		alerts := e.Observe(start.Add(s.after), s.values)
+		var got []State
+		for _, a := range alerts {
+			got = append(got, a.State)
+		}
+		if len(got) != len(s.want) || (len(got) > 0 && got[0] != s.want[0]) {
+			t.Fatalf("%s at %v: alerts = %v, want %v", r.Name, s.after, got, s.want)
+		}
+		all = append(all, alerts...)
+	}
+	return all
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, test := range []struct {
+		rules []Rule
+		want  error
+	}{
+		{[]Rule{{Field: "temperature", Condition: Above}}, ErrInvalidRule},
+		{[]Rule{{Name: "a", Condition: Above}}, ErrInvalidRule},
+		{[]Rule{{Name: "a", Field: "temperature", Condition: Above, For: -time.Second}}, ErrInvalidRule},
+		{[]Rule{{Name: "a", Field: "temperature", Condition: Above, Hysteresis: -1}}, ErrInvalidRule},
+		{[]Rule{{Name: "a", Field: "temperature", Condition: Above, Cooldown: -time.Second}}, ErrInvalidRule},
+		{[]Rule{{Name: "a", Field: "temperature", Condition: Above}, {Name: "a", Field: "humidity", Condition: Below}}, ErrInvalidRule},
+		{[]Rule{{Name: "a", Field: "temperature", Condition: "between"}}, ErrUnknownCondition},
+		{[]Rule{{Name: "a", Field: "temperature", Condition: Rise}}, ErrMissingWindow},
+	} {
+		if _, err := New(test.rules); err != test.want {
+			t.Errorf("New(%+v) = %v, want %v", test.rules, err, test.want)
+		}
+	}
+	if _, err := New([]Rule{{Name: "a", Field: "temperature", Condition: Fall, Window: time.Hour}}); err != nil {
+		t.Errorf("New with valid rule = %v", err)
+	}
+}
+
+func TestAboveForHysteresis(t *testing.T) {
+	alerts := run(t, Rule{Name: "heat", Field: "temperature", Condition: Above, Threshold: 30, For: time.Minute, Hysteresis: 1}, []step{
+		{0, temp(31), nil},
+		{30 * time.Second, temp(32), nil},
+		{time.Minute, temp(31), []State{Raised}},
+		// within the hysteresis
+		{90 * time.Second, temp(29.5), nil},
+		{2 * time.Minute, temp(29), []State{Cleared}},
+	})
+	if !alerts[0].Since.Equal(start) || alerts[0].Value != 31 {
+		t.Errorf("raised = %+v, want since start with value 31", alerts[0])
+	}
+	if !alerts[1].Since.Equal(start.Add(time.Minute)) {
+		t.Errorf("cleared since = %v, want raise time", alerts[1].Since)
+	}
+}
+
+func TestBelowForRestarts(t *testing.T) {
+	alerts := run(t, Rule{Name: "frost", Field: "temperature", Condition: Below, Threshold: 32, For: time.Minute}, []step{
+		{0, temp(31), nil},
+		{30 * time.Second, temp(33), nil},
+		{time.Minute, temp(31), nil},
+		{90 * time.Second, temp(31), nil},
+		{2 * time.Minute, temp(30), []State{Raised}},
+		{3 * time.Minute, temp(32), []State{Cleared}},
+	})
+	if !alerts[0].Since.Equal(start.Add(time.Minute)) {
+		t.Errorf("raised since = %v, want restarted duration", alerts[0].Since)
+	}
+}
+
+func TestMissingFieldRestarts(t *testing.T) {
+	run(t, Rule{Name: "heat", Field: "temperature", Condition: Above, Threshold: 30, For: time.Minute}, []step{
+		{0, temp(31), nil},
+		{30 * time.Second, map[string]float64{"humidity": 50}, nil},
+		{time.Minute, temp(31), nil},
+		{90 * time.Second, temp(31), nil},
+		{2 * time.Minute, temp(31), []State{Raised}},
+	})
+}
+
+func TestCooldown(t *testing.T) {
+	run(t, Rule{Name: "gust", Field: "temperature", Condition: Above, Threshold: 40, Cooldown: time.Hour}, []step{
+		{0, temp(41), []State{Raised}},
+		{time.Minute, temp(39), []State{Cleared}},
+		// suppressed within the cooldown
+		{2 * time.Minute, temp(45), nil},
+		{30 * time.Minute, temp(39), nil},
+		{61 * time.Minute, temp(42), []State{Raised}},
+	})
+}
+
+func TestRiseWindow(t *testing.T) {
+	alerts := run(t, Rule{Name: "warming", Field: "temperature", Condition: Rise, Threshold: 2, Window: 10 * time.Minute}, []step{
+		// window not yet covered
+		{0, temp(10), nil},
+		{5 * time.Minute, temp(15), nil},
+		// baseline is the first sample
+		{10 * time.Minute, temp(13), []State{Raised}},
+		// baseline is the sample at 5 minutes
+		{15 * time.Minute, temp(16), []State{Cleared}},
+	})
+	if alerts[0].Value != 3 || alerts[0].Current != 13 {
+		t.Errorf("raised = %+v, want change 3 at 13", alerts[0])
+	}
+}
+
+func TestFallWindow(t *testing.T) {
+	run(t, Rule{Name: "pressure", Field: "temperature", Condition: Fall, Threshold: 0.06, Window: 3 * time.Hour}, []step{
+		{0, temp(30.10), nil},
+		{2 * time.Hour, temp(29.90), nil},
+		{3 * time.Hour, temp(30.00), []State{Raised}},
+		{4 * time.Hour, temp(29.95), nil},
+		{5 * time.Hour, temp(29.90), []State{Cleared}},
+	})
+}
+
+func TestEvaluateStale(t *testing.T) {
+	e, err := New([]Rule{{Name: "heat", Field: "temperature", Condition: Above, Threshold: 30, For: time.Minute}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alerts := e.evaluate(time.Now()); alerts != nil {
+		t.Fatalf("evaluate without values = %+v", alerts)
+	}
+	e.Observe(start, temp(31))
+	observed := e.received
+
+	// no weather conditions received since the observation
+	for i := 0; i < 3; i++ {
+		if alerts := e.evaluate(observed); alerts != nil {
+			t.Fatalf("evaluate of stale values = %+v", alerts)
+		}
+	}
+	// unchanged conditions received for the duration
+	if alerts := e.evaluate(observed.Add(30 * time.Second)); alerts != nil {
+		t.Fatalf("evaluate before duration = %+v", alerts)
+	}
+	alerts := e.evaluate(observed.Add(time.Minute))
+	if len(alerts) != 1 || alerts[0].State != Raised || !alerts[0].Time.Equal(start.Add(time.Minute)) {
+		t.Fatalf("evaluate after duration = %+v, want raised at 1 minute", alerts)
+	}
+	if active := e.Active(); len(active) != 1 || active[0].Name != "heat" {
+		t.Errorf("Active = %+v", active)
+	}
+}
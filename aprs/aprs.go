@@ -0,0 +1,315 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+// Package aprs formats the Report of a Client as an APRS weather report with
+// position, and uploads it to the APRS-IS network for the Citizen Weather
+// Observer Program (CWOP).
+//
+// A packet has the form
+//
+//	CW1234>APRS,TCPIP*:@161425z4903.50N/07201.75W_220/004g005t077r000p000P000h50b09900davisweather
+//
+// with wind direction (°), sustained wind speed (mph), peak gust over the last
+// 2 minutes (mph), temperature (°F), rain over the last hour, last 24 hours and
+// since midnight (hundredths of an inch), humidity (%) and sea level pressure
+// (tenths of hPa). Values that are not provided are sent as dots or omitted.
+package aprs
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/tannerryan/davisweather"
+)
+
+const (
+	// DefaultServer is the CWOP APRS-IS server
+	DefaultServer = "cwop.aprs.net:14580"
+
+	// defaultInterval is the CWOP upload cadence
+	defaultInterval = 5 * time.Minute
+	// defaultTimeout is the default timeout of an upload
+	defaultTimeout = 30 * time.Second
+	// defaultPasscode is the receive-only passcode of CWOP stations
+	defaultPasscode = -1
+	// resultBuffer is the capacity of the channel returned by Run
+	resultBuffer = 16
+	// software is the software name sent at login and appended to packets
+	software = "davisweather"
+	// version is the software version sent at login
+	version = "1.0"
+	// hPaPerInHg is hectopascals per inch of mercury
+	hPaPerInHg = 33.8639
+)
+
+var (
+	// ErrCallsignMissing is returned when no callsign is provided
+	ErrCallsignMissing = errors.New("aprs: callsign not provided")
+	// ErrPosition is returned when the latitude or longitude is out of range
+	ErrPosition = errors.New("aprs: invalid position")
+	// ErrNoObservation is returned when formatting a Report without a Timestamp
+	ErrNoObservation = errors.New("aprs: report has no observation")
+	// ErrLogin is returned when the server does not respond to the login
+	ErrLogin = errors.New("aprs: login rejected")
+)
+
+// Options configures an Uploader.
+type Options struct {
+	Callsign  string        // Callsign is the station callsign or CWOP ID, such as "CW1234"
+	Passcode  int           // Passcode is the APRS-IS passcode (default -1 for CWOP stations)
+	Latitude  float64       // Latitude is station latitude (°, north positive)
+	Longitude float64       // Longitude is station longitude (°, east positive)
+	Server    string        // Server is the host:port of the APRS-IS server (default DefaultServer)
+	Interval  time.Duration // Interval is the time between uploads of Run (default 5 minutes)
+	Timeout   time.Duration // Timeout is the timeout of each upload (default 30 seconds)
+	Comment   string        // Comment is appended to each packet (default "davisweather")
+
+	Logger davisweather.Logger // Logger receives upload failures (default discards)
+}
+
+// Result is the outcome of an upload.
+type Result struct {
+	Observed time.Time // Observed is the Timestamp of the uploaded Report
+	Time     time.Time // Time is when the upload completed
+	Packet   string    // Packet is the uploaded packet
+	Err      error     // Err is the error of the upload (nil if sent)
+}
+
+// Uploader uploads Reports to APRS-IS.
+type Uploader struct {
+	opts     Options // opts are the Uploader options
+	position string  // position is the encoded station position
+}
+
+// New returns an Uploader with the provided options. It returns an error if no
+// callsign is provided or the position is out of range.
+func New(opts Options) (*Uploader, error) {
+	if opts.Callsign == "" {
+		return nil, ErrCallsignMissing
+	}
+	position, err := Position(opts.Latitude, opts.Longitude)
+	if err != nil {
+		return nil, err
+	}
+	opts.Callsign = strings.ToUpper(opts.Callsign)
+	if opts.Passcode == 0 {
+		opts.Passcode = defaultPasscode
+	}
+	if opts.Server == "" {
+		opts.Server = DefaultServer
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.Comment == "" {
+		opts.Comment = software
+	}
+	if opts.Logger == nil {
+		opts.Logger = davisweather.NopLogger()
+	}
+	return &Uploader{opts: opts, position: position}, nil
+}
+
+// Run uploads the Report of the Client every Interval until the context is
+// cancelled. Uploads are skipped while the Client is not receiving weather
+// conditions. The returned channel receives the Result of every upload;
+// Results are dropped if the channel is full. The channel is closed when the
+// context is cancelled.
+func (u *Uploader) Run(ctx context.Context, c *davisweather.Client) <-chan Result {
+	results := make(chan Result, resultBuffer)
+	go func() {
+		defer close(results)
+		ticker := time.NewTicker(u.opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			state := c.Status().State
+			if state != davisweather.StateLive && state != davisweather.StatePolling {
+				continue
+			}
+			report, err := c.Report()
+			if err != nil || report.Timestamp.IsZero() {
+				continue
+			}
+			result := Result{Observed: report.Timestamp}
+			result.Packet, result.Err = u.Packet(report)
+			if result.Err == nil {
+				result.Err = u.Send(ctx, result.Packet)
+			}
+			result.Time = time.Now()
+			if result.Err != nil && ctx.Err() == nil {
+				u.opts.Logger.Log(davisweather.LevelWarn, "upload failed", davisweather.LogComponent, "aprs",
+					davisweather.LogError, result.Err)
+			}
+			select {
+			case results <- result:
+			default:
+			}
+		}
+	}()
+	return results
+}
+
+// Packet returns the APRS weather report of the Report, without a line
+// terminator. It returns ErrNoObservation if the Report has no Timestamp.
+func (u *Uploader) Packet(r *davisweather.Report) (string, error) {
+	if r.Timestamp.IsZero() {
+		return "", ErrNoObservation
+	}
+	return u.opts.Callsign + ">APRS,TCPIP*:@" + r.Timestamp.UTC().Format("021504") + "z" +
+		u.position + Weather(r) + u.opts.Comment, nil
+}
+
+// Send logs in to the APRS-IS server and sends the packet. It returns an error
+// if the connection or login fails.
+func (u *Uploader) Send(ctx context.Context, packet string) error {
+	ctx, cancel := context.WithTimeout(ctx, u.opts.Timeout)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", u.opts.Server)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	// server banner
+	reader := bufio.NewReader(conn)
+	if _, err := reader.ReadString('\n'); err != nil {
+		return err
+	}
+	login := fmt.Sprintf("user %s pass %d vers %s %s\r\n", u.opts.Callsign, u.opts.Passcode, software, version)
+	if _, err := conn.Write([]byte(login)); err != nil {
+		return err
+	}
+	resp, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(resp, "# logresp") {
+		return ErrLogin
+	}
+	_, err = conn.Write([]byte(packet + "\r\n"))
+	return err
+}
+
+// Position returns the position of the latitude and longitude in APRS format,
+// with the weather station symbol, such as "4903.50N/07201.75W_". It returns
+// ErrPosition if the latitude or longitude is out of range.
+func Position(lat float64, lon float64) (string, error) {
+	if math.IsNaN(lat) || math.IsNaN(lon) || math.Abs(lat) > 90 || math.Abs(lon) > 180 {
+		return "", ErrPosition
+	}
+	ns, ew := 'N', 'E'
+	if lat < 0 {
+		ns = 'S'
+	}
+	if lon < 0 {
+		ew = 'W'
+	}
+	// round to hundredths of a minute before splitting into degrees
+	latH := int(math.Round(math.Abs(lat) * 6000))
+	lonH := int(math.Round(math.Abs(lon) * 6000))
+	return fmt.Sprintf("%02d%02d.%02d%c/%03d%02d.%02d%c_",
+		latH/6000, latH%6000/100, latH%100, ns,
+		lonH/6000, lonH%6000/100, lonH%100, ew), nil
+}
+
+// Weather returns the weather data of the Report in APRS format, starting with
+// the wind direction and speed, such as "220/004g005t077r000p000P000h50b09900".
+// Wind, gust and temperature that are not provided are sent as dots; other
+// values that are not provided are omitted.
+func Weather(r *davisweather.Report) string {
+	var b strings.Builder
+	b.WriteString(field("", r.WindDirAvgLast1Min, 1, 3))
+	b.WriteString(field("/", r.WindSpeedAvgLast1Min, 1, 3))
+	// APRS gust is the peak of the last few minutes, closest to the 2 minute high
+	b.WriteString(field("g", r.WindSpeedHighLast2Min, 1, 3))
+	b.WriteString(field("t", r.Temperature, 1, 3))
+
+	for _, rain := range []struct {
+		prefix string
+		field  davisweather.RainField
+	}{
+		{"r", davisweather.RainFieldLast60Min},
+		{"p", davisweather.RainFieldLast24Hour},
+		{"P", davisweather.RainFieldDaily},
+	} {
+		if depth, err := r.RainDepth(rain.field); err == nil {
+			hundredths := depth.Inches()
+			b.WriteString(field(rain.prefix, &hundredths, 100, 3))
+		}
+	}
+
+	if r.Humidity != nil {
+		// clamped to 1-100%, with 100% sent as 00
+		humidity := int(math.Round(math.Max(1, math.Min(100, *r.Humidity))))
+		b.WriteString(fmt.Sprintf("h%02d", humidity%100))
+	}
+	if r.BarometerSeaLevel != nil {
+		tenths := *r.BarometerSeaLevel * hPaPerInHg
+		b.WriteString(field("b", &tenths, 10, 5))
+	}
+	if r.SolarRad != nil {
+		// luminosity above 999 W/m² is sent as l with 1000 subtracted
+		if solar := math.Round(*r.SolarRad); solar >= 1000 {
+			solar -= 1000
+			b.WriteString(field("l", &solar, 1, 3))
+		} else {
+			b.WriteString(field("L", &solar, 1, 3))
+		}
+	}
+	return b.String()
+}
+
+// field returns the prefixed value scaled and rounded to a zero padded integer
+// of the provided width, clamped to the largest value of the width. Negative
+// values include the sign in the width. It returns dots if the value is not
+// provided.
+func field(prefix string, v *float64, scale float64, width int) string {
+	if v == nil {
+		return prefix + strings.Repeat(".", width)
+	}
+	n := int(math.Round(*v * scale))
+	max := int(math.Pow10(width)) - 1
+	if n > max {
+		n = max
+	}
+	if n < 0 {
+		min := -(int(math.Pow10(width-1)) - 1)
+		if n < min {
+			n = min
+		}
+		return fmt.Sprintf("%s-%0*d", prefix, width-1, -n)
+	}
+	return fmt.Sprintf("%s%0*d", prefix, width, n)
+}
+
+// Passcode returns the APRS-IS passcode of the callsign, ignoring any SSID.
+// CWOP stations without an amateur radio license use -1.
+func Passcode(callsign string) int {
+	call := strings.ToUpper(strings.SplitN(callsign, "-", 2)[0])
+	hash := 0x73e2
+	for i := 0; i < len(call); i += 2 {
+		hash ^= int(call[i]) << 8
+		if i+1 < len(call) {
+			hash ^= int(call[i+1])
+		}
+	}
+	return hash & 0x7fff
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package aprs
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/davisweather"
+)
+
+// testReport returns a Report loaded from the JSON payload.
+func testReport(t *testing.T, payload string) *davisweather.Report {
+	t.Helper()
+	r, _ := davisweather.NewReport(false)
+	if err := r.UpdateJSON([]byte(payload)); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestPosition(t *testing.T) {
+	for _, test := range []struct {
+		lat  float64
+		lon  float64
+		want string
+	}{
+		{49.0583, -72.0292, "4903.50N/07201.75W_"},
+		{-33.8568, 151.2153, "3351.41S/15112.92E_"},
+		{0, 0, "0000.00N/00000.00E_"},
+	} {
+		got, err := Position(test.lat, test.lon)
+		if err != nil || got != test.want {
+			t.Errorf("Position(%v, %v) = %q, %v, want %q", test.lat, test.lon, got, err, test.want)
+		}
+	}
+	if _, err := Position(91, 0); err != ErrPosition {
+		t.Errorf("Position(91, 0) error = %v, want %v", err, ErrPosition)
+	}
+}
+
+func TestPasscode(t *testing.T) {
+	for _, call := range []string{"N0CALL", "n0call", "N0CALL-13"} {
+		if got := Passcode(call); got != 13023 {
+			t.Errorf("Passcode(%q) = %d, want 13023", call, got)
+		}
+	}
+}
+
+func TestPacket(t *testing.T) {
+	u, err := New(Options{Callsign: "cw1234", Latitude: 49.0583, Longitude: -72.0292})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := testReport(t, `{"windDirAvg1Min":220,"windSpeedAvg1Min":4,"windGustSpeedLast2Min":5,"windGustSpeedLast10Min":9,"temperature":77,
+		"rainSize":1,"rainLast60Min":0,"rainLast24Hour":0,"rainDaily":0,
+		"humidity":50,"barometerSeaLevel":29.2348}`)
+	r.Timestamp = time.Date(2020, 6, 16, 14, 25, 0, 0, time.UTC)
+	packet, err := u.Packet(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "CW1234>APRS,TCPIP*:@161425z4903.50N/07201.75W_220/004g005t077r000p000P000h50b09900davisweather"
+	if packet != want {
+		t.Errorf("Packet =\n%s\nwant\n%s", packet, want)
+	}
+
+	if _, err := u.Packet(&davisweather.Report{}); err != ErrNoObservation {
+		t.Errorf("Packet without observation error = %v, want %v", err, ErrNoObservation)
+	}
+}
+
+func TestWeather(t *testing.T) {
+	for _, test := range []struct {
+		payload string
+		want    string
+	}{
+		{`{}`, ".../...g...t..."},
+		{`{"temperature":-5.4,"humidity":100}`, ".../...g...t-05h00"},
+		{`{"humidity":0.4}`, ".../...g...t...h01"},
+		{`{"humidity":99.6}`, ".../...g...t...h00"},
+		{`{"temperature":77,"solarRad":1203}`, ".../...g...t077l203"},
+		{`{"rainSize":2,"rainLast60Min":13}`, ".../...g...t...r010"},
+	} {
+		if got := Weather(testReport(t, test.payload)); got != test.want {
+			t.Errorf("Weather(%s) = %q, want %q", test.payload, got, test.want)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		conn.Write([]byte("# aprsc 2.1.4\r\n"))
+		login, _ := reader.ReadString('\n')
+		conn.Write([]byte("# logresp CW1234 unverified, server T2TEST\r\n"))
+		packet, _ := reader.ReadString('\n')
+		received <- []string{login, packet}
+	}()
+
+	u, err := New(Options{Callsign: "CW1234", Server: listener.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Send(context.Background(), "CW1234>APRS,TCPIP*:test"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case lines := <-received:
+		if lines[0] != "user CW1234 pass -1 vers davisweather 1.0\r\n" {
+			t.Errorf("login = %q", lines[0])
+		}
+		if strings.TrimSpace(lines[1]) != "CW1234>APRS,TCPIP*:test" {
+			t.Errorf("packet = %q", lines[1])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not receive packet")
+	}
+}
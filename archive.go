@@ -0,0 +1,154 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/tannerryan/davisweather/archive"
+)
+
+const (
+	// archiveQueueSize is the number of Reports waiting to be archived before
+	// Reports are dropped
+	archiveQueueSize = 64
+)
+
+var (
+	// restoreWindows are the increasingly long periods searched for the most
+	// recent archived Report
+	restoreWindows = []time.Duration{time.Hour, 48 * time.Hour}
+)
+
+// WithArchive stores the Report state in the archive Store each time it is
+// modified, as JSON or, if encode is true, zlib encoded (see Report.Encode).
+// Stored Reports are restored with Report.UpdateJSON or Report.Decode. When the
+// Client is created with WithStation, the daily ET0 accumulation resumes from
+// the most recent stored Report. Reports are stored in the background, and
+// Reports restored with Report.UpdateJSON are not stored again. The Store is
+// not closed by the Client.
+func WithArchive(s archive.Store, encode bool) Option {
+	return func(c *Client) {
+		c.report.mutex.Lock()
+		defer c.report.mutex.Unlock()
+		c.report.archive = s
+		c.report.archiveZlib = encode
+		c.report.archiveQueue = make(chan archive.Record, archiveQueueSize)
+	}
+}
+
+// store queues the Report state for the archive Store, if configured. The
+// Report is dropped if the queue is full.
+func (r *Report) store(timestamp time.Time) {
+	if r.archiveQueue == nil {
+		return
+	}
+	select {
+	case r.archiveQueue <- archive.Record{Time: timestamp, Payload: r.lastBytes}:
+	default:
+		r.logger.Log(LevelWarn, "archive queue full, report not archived", LogComponent, "archive", LogDevice, r.DeviceID)
+	}
+}
+
+// startArchive starts appending queued Reports to the archive Store, if
+// configured, until the context is cancelled.
+func (c *Client) startArchive(ctx context.Context) {
+	if c.report.archiveQueue == nil {
+		return
+	}
+	c.wg.Add(1)
+	go c.archiveLoop(ctx)
+}
+
+// archiveLoop appends queued Reports to the archive Store outside of the
+// Report lock. Once the context is cancelled, the remaining queued Reports are
+// appended.
+func (c *Client) archiveLoop(ctx context.Context) {
+	// goroutine monitoring
+	defer c.wg.Done()
+
+	for {
+		select {
+		case record := <-c.report.archiveQueue:
+			c.append(record)
+		case <-ctx.Done():
+			for {
+				select {
+				case record := <-c.report.archiveQueue:
+					c.append(record)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// append stores the queued Report in the archive Store, logging failures.
+func (c *Client) append(record archive.Record) {
+	payload := record.Payload
+	if c.report.archiveZlib {
+		payload = encode(payload)
+	}
+	if err := c.report.archive.Append(record.Time, payload); err != nil {
+		c.log(LevelWarn, "archive", "failed to archive report", LogError, err)
+	}
+}
+
+// restoreET resumes the ET0 accumulation from the most recent archived Report,
+// if the archive and ET0 are configured. It logs failures to read the archive.
+func (r *Report) restoreET(now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.archive == nil || r.et == nil {
+		return
+	}
+	payload, err := r.latest(now)
+	if err != nil {
+		r.logger.Log(LevelWarn, "failed to read archive", LogComponent, "archive", LogError, err)
+		return
+	}
+	if payload == nil {
+		return
+	}
+	var restored struct {
+		ET0 *Evapotranspiration `json:"et0"`
+	}
+	if err := json.Unmarshal(payload, &restored); err != nil {
+		r.logger.Log(LevelWarn, "failed to decode archived report", LogComponent, "archive", LogError, err)
+		return
+	}
+	r.et.resume(restored.ET0, now, r.station.location())
+}
+
+// latest returns the JSON representation of the most recent archived Report
+// before the provided time. It returns nil if there are no recent Reports.
+func (r *Report) latest(now time.Time) ([]byte, error) {
+	for _, window := range restoreWindows {
+		it, err := r.archive.Range(now.Add(-window), now)
+		if err != nil {
+			return nil, err
+		}
+		var payload []byte
+		for it.Next() {
+			payload = it.Record().Payload
+		}
+		err = it.Err()
+		it.Close()
+		if err != nil {
+			return nil, err
+		}
+		if payload == nil {
+			continue
+		}
+		if r.archiveZlib {
+			return decode(payload)
+		}
+		return payload, nil
+	}
+	return nil, nil
+}
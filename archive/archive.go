@@ -0,0 +1,421 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+// Package archive is a durable on-disk store of timestamped payloads, such as
+// Report snapshots. Payloads are appended to daily segment files, which are
+// removed once older than the retention.
+//
+// Each record is framed with its length and a CRC-32 checksum. A record torn
+// by a crash is detected and truncated when the segment is reopened, so the
+// archive never returns a partially written record.
+package archive
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// segmentLayout is the date layout of segment file names
+	segmentLayout = "2006-01-02"
+	// segmentExt is the extension of segment files
+	segmentExt = ".log"
+	// headerSize is the size of a record header (length, checksum, time)
+	headerSize = 16
+	// maxPayload is the largest payload accepted (16 MiB)
+	maxPayload = 16 << 20
+)
+
+var (
+	// ErrClosed is returned when using a closed Log
+	ErrClosed = errors.New("archive: log closed")
+	// ErrPayloadSize is returned when appending an empty or oversized payload
+	ErrPayloadSize = errors.New("archive: invalid payload size")
+	// errCorrupt is returned when reading a torn or corrupt record
+	errCorrupt = errors.New("archive: corrupt record")
+)
+
+// Record is a timestamped payload.
+type Record struct {
+	Time    time.Time // Time is the time of the payload
+	Payload []byte    // Payload is the stored payload
+}
+
+// Store is a durable store of timestamped payloads.
+type Store interface {
+	// Append stores the payload at the provided time.
+	Append(at time.Time, payload []byte) error
+	// Range returns an Iterator over the records between from (inclusive) and
+	// to (exclusive), in order of segment and append.
+	Range(from time.Time, to time.Time) (Iterator, error)
+	// Close releases the resources of the Store.
+	Close() error
+}
+
+// Iterator iterates over records. Next must be called before the first
+// Record.
+type Iterator interface {
+	// Next advances to the next record, returning false when there are no more
+	// records or an error occurs.
+	Next() bool
+	// Record returns the current record.
+	Record() Record
+	// Err returns the error that stopped the iteration, if any.
+	Err() error
+	// Close releases the resources of the Iterator.
+	Close() error
+}
+
+// Options configures a Log.
+type Options struct {
+	Retention time.Duration  // Retention is how long segments are kept (0 keeps all segments)
+	Location  *time.Location // Location is the time zone of daily rotation (default UTC)
+	Sync      bool           // Sync flushes each record to stable storage before Append returns
+}
+
+// Log is a Store of append-only daily segment files in a directory.
+type Log struct {
+	dir     string      // dir is the segment directory
+	opts    Options     // opts are the Log options
+	segment *os.File    // segment is the open segment file (nil if none)
+	date    string      // date is the date of the open segment
+	closed  bool        // closed indicates the Log is closed
+	mutex   *sync.Mutex // mutex is for atomic log actions
+}
+
+// Open returns a Log storing segments in the provided directory, creating it
+// if it does not exist. Torn records at the end of existing segments are
+// truncated, and expired segments are removed. It returns an error if the
+// directory cannot be used.
+func Open(dir string, opts Options) (*Log, error) {
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	l := &Log{dir: dir, opts: opts, mutex: &sync.Mutex{}}
+
+	segments, err := l.segments()
+	if err != nil {
+		return nil, err
+	}
+	for _, date := range segments {
+		if err := repair(l.path(date)); err != nil {
+			return nil, err
+		}
+	}
+	if err := l.expire(time.Now()); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Append stores the payload at the provided time in the segment of its date.
+// A record torn by a failed write is removed before Append returns. It returns
+// an error if the payload is empty or larger than 16 MiB, or if the write
+// fails.
+func (l *Log) Append(at time.Time, payload []byte) error {
+	if len(payload) == 0 || len(payload) > maxPayload {
+		return ErrPayloadSize
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+	// rotate daily
+	date := at.In(l.opts.Location).Format(segmentLayout)
+	if l.segment == nil || date != l.date {
+		if err := l.rotate(date, at); err != nil {
+			return err
+		}
+	}
+
+	// write record as a single write
+	record := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint64(record[8:16], uint64(at.UnixNano()))
+	copy(record[headerSize:], payload)
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(record[8:]))
+	info, err := l.segment.Stat()
+	if err != nil {
+		l.release()
+		return err
+	}
+	_, err = l.segment.Write(record)
+	if err == nil && l.opts.Sync {
+		err = l.segment.Sync()
+	}
+	if err != nil {
+		// remove torn record
+		if l.segment.Truncate(info.Size()) != nil {
+			l.release()
+		}
+		return err
+	}
+	return nil
+}
+
+// release closes the open segment after a failure. The segment is repaired
+// when reopened by the next Append.
+func (l *Log) release() {
+	l.segment.Close()
+	l.segment = nil
+}
+
+// Range returns an Iterator over the records between from (inclusive) and to
+// (exclusive). Iteration stops at the first torn or corrupt record of a
+// segment. It returns an error if the segments cannot be listed.
+func (l *Log) Range(from time.Time, to time.Time) (Iterator, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return nil, ErrClosed
+	}
+	segments, err := l.segments()
+	if err != nil {
+		return nil, err
+	}
+	first := from.In(l.opts.Location).Format(segmentLayout)
+	last := to.In(l.opts.Location).Format(segmentLayout)
+	var paths []string
+	for _, date := range segments {
+		if date >= first && date <= last {
+			paths = append(paths, l.path(date))
+		}
+	}
+	return &iterator{paths: paths, from: from, to: to}, nil
+}
+
+// Close closes the open segment. It returns an error if the segment cannot be
+// closed.
+func (l *Log) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	if l.segment == nil {
+		return nil
+	}
+	err := l.segment.Close()
+	l.segment = nil
+	return err
+}
+
+// rotate closes the open segment and opens the segment of the provided date,
+// truncating torn records, and removes expired segments relative to the
+// provided time.
+func (l *Log) rotate(date string, at time.Time) error {
+	if l.segment != nil {
+		if err := l.segment.Close(); err != nil {
+			return err
+		}
+		l.segment = nil
+	}
+	if err := repair(l.path(date)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.OpenFile(l.path(date), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	l.segment = f
+	l.date = date
+	return l.expire(at)
+}
+
+// expire removes segments whose day ended before the retention, relative to
+// the provided time.
+func (l *Log) expire(now time.Time) error {
+	if l.opts.Retention <= 0 {
+		return nil
+	}
+	segments, err := l.segments()
+	if err != nil {
+		return err
+	}
+	cutoff := now.Add(-l.opts.Retention)
+	for _, date := range segments {
+		day, err := time.ParseInLocation(segmentLayout, date, l.opts.Location)
+		if err != nil || date == l.date {
+			continue
+		}
+		if day.AddDate(0, 0, 1).Before(cutoff) {
+			if err := os.Remove(l.path(date)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// segments returns the dates of the segment files, sorted.
+func (l *Log) segments() ([]string, error) {
+	files, err := ioutil.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	var dates []string
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		date := strings.TrimSuffix(name, segmentExt)
+		if _, err := time.Parse(segmentLayout, date); err != nil {
+			continue
+		}
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	return dates, nil
+}
+
+// path returns the path of the segment of the provided date.
+func (l *Log) path(date string) string {
+	return filepath.Join(l.dir, date+segmentExt)
+}
+
+// repair truncates the segment after its last complete record.
+func repair(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var valid int64
+	reader := bufio.NewReader(f)
+	for {
+		_, n, err := readRecord(reader)
+		if err != nil {
+			break
+		}
+		valid += n
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == valid {
+		return nil
+	}
+	if err := f.Truncate(valid); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// readRecord reads a single record, returning the record and its size. It
+// returns io.EOF at the end of the segment, or errCorrupt if the record is torn
+// or fails its checksum.
+func readRecord(r io.Reader) (Record, int64, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return Record{}, 0, io.EOF
+		}
+		return Record{}, 0, errCorrupt
+	}
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size == 0 || size > maxPayload {
+		return Record{}, 0, errCorrupt
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return Record{}, 0, errCorrupt
+	}
+	sum := crc32.ChecksumIEEE(header[8:])
+	sum = crc32.Update(sum, crc32.IEEETable, payload)
+	if sum != binary.BigEndian.Uint32(header[4:8]) {
+		return Record{}, 0, errCorrupt
+	}
+	at := time.Unix(0, int64(binary.BigEndian.Uint64(header[8:16])))
+	return Record{Time: at, Payload: payload}, int64(headerSize) + int64(size), nil
+}
+
+// iterator is an Iterator over the records of segment files.
+type iterator struct {
+	paths   []string      // paths are the remaining segment files
+	from    time.Time     // from is the inclusive start of the range
+	to      time.Time     // to is the exclusive end of the range
+	file    *os.File      // file is the open segment file
+	reader  *bufio.Reader // reader reads the open segment file
+	current Record        // current is the current record
+	err     error         // err is the error that stopped iteration
+}
+
+// Next advances to the next record in the range.
+func (it *iterator) Next() bool {
+	for it.err == nil {
+		if it.file == nil {
+			if len(it.paths) == 0 {
+				return false
+			}
+			f, err := os.Open(it.paths[0])
+			it.paths = it.paths[1:]
+			if os.IsNotExist(err) {
+				// removed by retention
+				continue
+			}
+			if err != nil {
+				it.err = err
+				return false
+			}
+			it.file = f
+			it.reader = bufio.NewReader(f)
+		}
+
+		record, _, err := readRecord(it.reader)
+		if err != nil {
+			// end of segment, or a record being appended
+			it.file.Close()
+			it.file = nil
+			continue
+		}
+		if record.Time.Before(it.from) || !record.Time.Before(it.to) {
+			continue
+		}
+		it.current = record
+		return true
+	}
+	return false
+}
+
+// Record returns the current record.
+func (it *iterator) Record() Record {
+	return it.current
+}
+
+// Err returns the error that stopped the iteration.
+func (it *iterator) Err() error {
+	return it.err
+}
+
+// Close closes the open segment file.
+func (it *iterator) Close() error {
+	it.paths = nil
+	if it.file == nil {
+		return nil
+	}
+	err := it.file.Close()
+	it.file = nil
+	return err
+}
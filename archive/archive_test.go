@@ -0,0 +1,133 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package archive
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// collect returns the payloads of the records between from and to.
+func collect(t *testing.T, l *Log, from time.Time, to time.Time) []string {
+	t.Helper()
+	it, err := l.Range(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var payloads []string
+	for it.Next() {
+		payloads = append(payloads, string(it.Record().Payload))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return payloads
+}
+
+// tear appends a partial record to the segment of the provided date.
+func tear(t *testing.T, l *Log, date string) {
+	t.Helper()
+	f, err := os.OpenFile(l.path(date), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte{0, 0, 0, 9, 1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepairTornTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	at := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	l, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, payload := range []string{"a", "b"} {
+		if err := l.Append(at.Add(time.Duration(i)*time.Second), []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tear(t, l, "2020-06-01")
+
+	l, err = Open(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := l.Append(at.Add(2*time.Second), []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	got := collect(t, l, at, at.Add(time.Hour))
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("payloads = %q, want %q", got, want)
+	}
+}
+
+func TestFailedAppend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	at := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	l, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := l.Append(at, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a write torn by a failure that also prevents truncation
+	tear(t, l, "2020-06-01")
+	l.segment.Close()
+	if err := l.Append(at.Add(time.Second), []byte("b")); err == nil {
+		t.Fatal("append to closed segment succeeded")
+	}
+	if l.segment != nil {
+		t.Fatal("failed segment remains open")
+	}
+
+	// the segment is repaired when reopened
+	if err := l.Append(at.Add(2*time.Second), []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	got := collect(t, l, at, at.Add(time.Hour))
+	if want := []string{"a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("payloads = %q, want %q", got, want)
+	}
+}
+
+func TestAppendPayloadSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := l.Append(time.Now(), nil); err != ErrPayloadSize {
+		t.Errorf("Append(empty) = %v, want %v", err, ErrPayloadSize)
+	}
+}
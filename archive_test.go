@@ -0,0 +1,63 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/davisweather/archive"
+	"github.com/tannerryan/davisweather/history"
+)
+
+func TestArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "davisweather")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := archive.Open(dir, archive.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	c := newClient(false, DiscoveryDisabled, []Option{WithArchive(store, true), WithHistory(history.Options{})})
+	ctx, cancel := context.WithCancel(context.Background())
+	c.startArchive(ctx)
+
+	// restored Reports are not recorded again
+	if err := c.report.UpdateJSON([]byte(`{"temperature":65,"signal":"Synced","battery":"Nominal"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if fields := c.report.history.Fields(); len(fields) != 0 {
+		t.Errorf("history of restored Report = %v, want none", fields)
+	}
+	updateHTTP(t, c.report, conditionsISS(1592400000, 1, "70", "50"))
+	if fields := c.report.history.Fields(); len(fields) == 0 {
+		t.Error("history of updated Report is empty")
+	}
+	cancel()
+	c.Closed()
+
+	it, err := store.Range(time.Unix(0, 0), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var temperatures []float64
+	for it.Next() {
+		r, _ := NewReport(false)
+		if err := r.Decode(it.Record().Payload); err != nil {
+			t.Fatal(err)
+		}
+		temperatures = append(temperatures, *r.Temperature)
+	}
+	if len(temperatures) != 1 || temperatures[0] != 70 {
+		t.Errorf("archived temperatures = %v, want [70]", temperatures)
+	}
+}
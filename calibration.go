@@ -0,0 +1,323 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"math"
+	"sort"
+
+	"github.com/tannerryan/davisweather/derived"
+	"github.com/tannerryan/davisweather/units"
+)
+
+const (
+	// calibrationPrecision is the decimal places of calibrated values
+	calibrationPrecision = 3
+	// derivedPrecision is the decimal places of recomputed derived values
+	derivedPrecision = 1
+	// calibrationDefault is the transmitter ID of calibrations applied to every
+	// transmitter and to fields received directly into the Report
+	calibrationDefault = -1
+)
+
+// calibrationKey identifies the calibration of a field of a transmitter.
+type calibrationKey struct {
+	txid  int    // txid is the transmitter ID (calibrationDefault for every transmitter)
+	field string // field is the JSON name of the field
+}
+
+// Calibration is the correction of a single Report field. The Curve is applied
+// first, followed by the Multiplier and the Offset.
+type Calibration struct {
+	Offset     float64      `json:"offset"`     // Offset is added to the value
+	Multiplier float64      `json:"multiplier"` // Multiplier scales the value (0 is treated as 1)
+	Curve      []CurvePoint `json:"curve"`      // Curve is a lookup table of corrections (optional)
+}
+
+// CurvePoint maps a raw value to a corrected value. Values between points are
+// linearly interpolated, and values outside of the curve are corrected by the
+// nearest point.
+type CurvePoint struct {
+	Raw   float64 `json:"raw"`   // Raw is the value reported by the sensor
+	Value float64 `json:"value"` // Value is the corrected value
+}
+
+// Apply returns the calibrated value.
+func (c Calibration) Apply(v float64) float64 {
+	if len(c.Curve) > 0 {
+		v = c.curve(v)
+	}
+	if c.Multiplier != 0 {
+		v *= c.Multiplier
+	}
+	return v + c.Offset
+}
+
+// curve returns the value corrected by the lookup table, which must be sorted
+// by raw value.
+func (c Calibration) curve(v float64) float64 {
+	first, last := c.Curve[0], c.Curve[len(c.Curve)-1]
+	if v <= first.Raw {
+		return v + first.Value - first.Raw
+	}
+	if v >= last.Raw {
+		return v + last.Value - last.Raw
+	}
+	i := sort.Search(len(c.Curve), func(i int) bool {
+		return c.Curve[i].Raw >= v
+	})
+	a, b := c.Curve[i-1], c.Curve[i]
+	return a.Value + (v-a.Raw)*(b.Value-a.Value)/(b.Raw-a.Raw)
+}
+
+// SetCalibration configures the calibration of the numeric Report fields,
+// keyed by JSON name, applied to the conditions of every transmitter as they
+// are received. When the temperature, humidity or wind speed is calibrated,
+// the dewpoint, wetbulb, heat index and wind chill are recomputed from the
+// calibrated values; the THW and THSW indices are left as reported. Calibrated
+// humidity is limited to 0-100%. The RainSize is never calibrated. Nil
+// calibrations disable calibration, except for transmitters configured with
+// SetSensorCalibration.
+func (r *Report) SetCalibration(calibrations map[string]Calibration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.setCalibration(calibrationDefault, calibrations)
+}
+
+// SetSensorCalibration configures the calibration of the numeric fields of the
+// provided transmitter, keyed by JSON name, see SetCalibration. A field
+// calibrated for the transmitter replaces the calibration of the field set by
+// SetCalibration. Nil calibrations remove the calibrations of the
+// transmitter. Transmitter IDs of 0 or less are ignored.
+func (r *Report) SetSensorCalibration(txid int, calibrations map[string]Calibration) {
+	if txid <= 0 {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.setCalibration(txid, calibrations)
+}
+
+// setCalibration replaces the calibrations of the provided transmitter without
+// locking the Report.
+func (r *Report) setCalibration(txid int, calibrations map[string]Calibration) {
+	for key := range r.calibrations {
+		if key.txid == txid {
+			delete(r.calibrations, key)
+		}
+	}
+	if len(calibrations) == 0 {
+		if len(r.calibrations) == 0 {
+			r.calibrations = nil
+		}
+		return
+	}
+	if r.calibrations == nil {
+		r.calibrations = make(map[calibrationKey]Calibration, len(calibrations))
+	}
+	for name, c := range calibrations {
+		// sort a copy of the curve for interpolation
+		curve := append([]CurvePoint(nil), c.Curve...)
+		sort.Slice(curve, func(i, j int) bool {
+			return curve[i].Raw < curve[j].Raw
+		})
+		c.Curve = curve
+		r.calibrations[calibrationKey{txid: txid, field: name}] = c
+	}
+}
+
+// WithCalibration configures the calibration of the numeric Report fields, see
+// SetCalibration.
+func WithCalibration(calibrations map[string]Calibration) Option {
+	return func(c *Client) {
+		c.report.SetCalibration(calibrations)
+	}
+}
+
+// WithSensorCalibration configures the calibration of the numeric fields of
+// the provided transmitter, see SetSensorCalibration.
+func WithSensorCalibration(txid int, calibrations map[string]Calibration) Option {
+	return func(c *Client) {
+		c.report.SetSensorCalibration(txid, calibrations)
+	}
+}
+
+// calibration returns the calibration of the field of the provided
+// transmitter, falling back to the calibration of every transmitter. It
+// returns false if the field is not calibrated.
+func (r *Report) calibration(txid int, name string) (Calibration, bool) {
+	if c, ok := r.calibrations[calibrationKey{txid: txid, field: name}]; ok {
+		return c, true
+	}
+	c, ok := r.calibrations[calibrationKey{txid: calibrationDefault, field: name}]
+	return c, ok
+}
+
+// calibrate returns the calibrated value of the provided field of the
+// transmitter. It returns the value unchanged if the field is not calibrated.
+func (r *Report) calibrate(txid int, name string, v *float64) *float64 {
+	c, ok := r.calibration(txid, name)
+	if !ok || v == nil {
+		return v
+	}
+	out := units.Round(c.Apply(*v), calibrationPrecision)
+	return &out
+}
+
+// calibrateHumidity returns the calibrated value of the provided humidity
+// field of the transmitter, limited to 0-100%.
+func (r *Report) calibrateHumidity(txid int, name string, v *float64) *float64 {
+	out := r.calibrate(txid, name, v)
+	if out == nil || out == v {
+		return out
+	}
+	rh := math.Max(0, math.Min(100, *out))
+	return &rh
+}
+
+// calibrateDir returns the calibrated wind direction of the provided field of
+// the transmitter, normalized to [0, 360).
+func (r *Report) calibrateDir(txid int, name string, v *float64) *float64 {
+	out := r.calibrate(txid, name, v)
+	if out == nil || out == v {
+		return out
+	}
+	dir := math.Mod(*out, 360)
+	if dir < 0 {
+		dir += 360
+	}
+	return &dir
+}
+
+// calibrated returns true if any of the provided fields of the transmitter are
+// calibrated.
+func (r *Report) calibrated(txid int, names ...string) bool {
+	for _, name := range names {
+		if _, ok := r.calibration(txid, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// calibrateISS calibrates the Sensor fields provided by an ISS record.
+func (r *Report) calibrateISS(s *Sensor) {
+	if r.calibrations == nil {
+		return
+	}
+	txid := s.TransmitterID
+	s.Temperature = r.calibrate(txid, "temperature", s.Temperature)
+	s.Humidity = r.calibrateHumidity(txid, "humidity", s.Humidity)
+
+	s.WindSpeedLast = r.calibrate(txid, "windSpeedLast", s.WindSpeedLast)
+	s.WindDirLast = r.calibrateDir(txid, "windDirLast", s.WindDirLast)
+	s.WindSpeedAvgLast1Min = r.calibrate(txid, "windSpeedAvg1Min", s.WindSpeedAvgLast1Min)
+	s.WindDirAvgLast1Min = r.calibrateDir(txid, "windDirAvg1Min", s.WindDirAvgLast1Min)
+	s.WindSpeedAvgLast2Min = r.calibrate(txid, "windSpeedAvg2Min", s.WindSpeedAvgLast2Min)
+	s.WindDirAvgLast2Min = r.calibrateDir(txid, "windDirAvg2Min", s.WindDirAvgLast2Min)
+	s.WindSpeedHighLast2Min = r.calibrate(txid, "windGustSpeedLast2Min", s.WindSpeedHighLast2Min)
+	s.WindDirAtHighLast2Min = r.calibrateDir(txid, "windGustDirLast2Min", s.WindDirAtHighLast2Min)
+	s.WindSpeedAvgLast10Min = r.calibrate(txid, "windSpeedAvg10Min", s.WindSpeedAvgLast10Min)
+	s.WindDirAvgLast10Min = r.calibrateDir(txid, "windDirAvg10Min", s.WindDirAvgLast10Min)
+	s.WindSpeedHighLast10Min = r.calibrate(txid, "windGustSpeedLast10Min", s.WindSpeedHighLast10Min)
+	s.WindDirAtHighLast10Min = r.calibrateDir(txid, "windGustDirLast10Min", s.WindDirAtHighLast10Min)
+
+	s.RainRateLast = r.calibrate(txid, "rainRateLast", s.RainRateLast)
+	s.RainRateHigh = r.calibrate(txid, "rainRateHigh", s.RainRateHigh)
+	s.RainLast15Min = r.calibrate(txid, "rainLast15Min", s.RainLast15Min)
+	s.RainRateHighLast15Min = r.calibrate(txid, "rainRateHighLast15Min", s.RainRateHighLast15Min)
+	s.RainLast60Min = r.calibrate(txid, "rainLast60Min", s.RainLast60Min)
+	s.RainLast24Hour = r.calibrate(txid, "rainLast24Hour", s.RainLast24Hour)
+	s.RainStorm = r.calibrate(txid, "rainStorm", s.RainStorm)
+
+	s.SolarRad = r.calibrate(txid, "solarRad", s.SolarRad)
+	s.UVIndex = r.calibrate(txid, "uvIndex", s.UVIndex)
+
+	s.RainfallDaily = r.calibrate(txid, "rainDaily", s.RainfallDaily)
+	s.RainfallMonthly = r.calibrate(txid, "rainMonthly", s.RainfallMonthly)
+	s.RainfallYear = r.calibrate(txid, "rainYear", s.RainfallYear)
+	s.RainStormLast = r.calibrate(txid, "rainStormLast", s.RainStormLast)
+
+	// recompute derived values from calibrated values
+	if r.calibrated(txid, "temperature", "humidity") && s.Temperature != nil && s.Humidity != nil {
+		s.Dewpoint = roundDerived(derived.Dewpoint(*s.Temperature, *s.Humidity))
+		s.Wetbulb = roundDerived(derived.Wetbulb(*s.Temperature, *s.Humidity))
+		s.HeatIndex = roundDerived(derived.HeatIndex(*s.Temperature, *s.Humidity))
+	}
+	if r.calibrated(txid, "temperature", "windSpeedAvg10Min") && s.Temperature != nil && s.WindSpeedAvgLast10Min != nil {
+		s.WindChill = roundDerived(derived.WindChill(*s.Temperature, *s.WindSpeedAvgLast10Min))
+	}
+	s.Dewpoint = r.calibrate(txid, "dewpoint", s.Dewpoint)
+	s.Wetbulb = r.calibrate(txid, "wetbulb", s.Wetbulb)
+	s.HeatIndex = r.calibrate(txid, "heatindex", s.HeatIndex)
+	s.WindChill = r.calibrate(txid, "windchill", s.WindChill)
+	s.THWIndex = r.calibrate(txid, "thwIndex", s.THWIndex)
+	s.THSWIndex = r.calibrate(txid, "thswIndex", s.THSWIndex)
+}
+
+// calibrateLeafSoil calibrates the Sensor fields provided by a leaf and soil
+// record.
+func (r *Report) calibrateLeafSoil(s *Sensor) {
+	if r.calibrations == nil {
+		return
+	}
+	txid := s.TransmitterID
+	s.SoilTemperature1 = r.calibrate(txid, "soilTemperature1", s.SoilTemperature1)
+	s.SoilTemperature2 = r.calibrate(txid, "soilTemperature2", s.SoilTemperature2)
+	s.SoilTemperature3 = r.calibrate(txid, "soilTemperature3", s.SoilTemperature3)
+	s.SoilTemperature4 = r.calibrate(txid, "soilTemperature4", s.SoilTemperature4)
+	s.SoilMoisture1 = r.calibrate(txid, "soilMoisture1", s.SoilMoisture1)
+	s.SoilMoisture2 = r.calibrate(txid, "soilMoisture2", s.SoilMoisture2)
+	s.SoilMoisture3 = r.calibrate(txid, "soilMoisture3", s.SoilMoisture3)
+	s.SoilMoisture4 = r.calibrate(txid, "soilMoisture4", s.SoilMoisture4)
+	s.LeafWetness1 = r.calibrate(txid, "leafWetness1", s.LeafWetness1)
+	s.LeafWetness2 = r.calibrate(txid, "leafWetness2", s.LeafWetness2)
+}
+
+// calibrateUDP calibrates the Sensor fields provided by a UDP broadcast.
+func (r *Report) calibrateUDP(s *Sensor) {
+	if r.calibrations == nil {
+		return
+	}
+	txid := s.TransmitterID
+	s.WindSpeedLast = r.calibrate(txid, "windSpeedLast", s.WindSpeedLast)
+	s.WindDirLast = r.calibrateDir(txid, "windDirLast", s.WindDirLast)
+
+	s.RainRateLast = r.calibrate(txid, "rainRateLast", s.RainRateLast)
+	s.RainLast15Min = r.calibrate(txid, "rainLast15Min", s.RainLast15Min)
+	s.RainLast60Min = r.calibrate(txid, "rainLast60Min", s.RainLast60Min)
+	s.RainLast24Hour = r.calibrate(txid, "rainLast24Hour", s.RainLast24Hour)
+	s.RainStorm = r.calibrate(txid, "rainStorm", s.RainStorm)
+	s.RainfallDaily = r.calibrate(txid, "rainDaily", s.RainfallDaily)
+	s.RainfallMonthly = r.calibrate(txid, "rainMonthly", s.RainfallMonthly)
+	s.RainfallYear = r.calibrate(txid, "rainYear", s.RainfallYear)
+
+	s.WindSpeedHighLast10Min = r.calibrate(txid, "windGustSpeedLast10Min", s.WindSpeedHighLast10Min)
+	s.WindDirAtHighLast10Min = r.calibrateDir(txid, "windGustDirLast10Min", s.WindDirAtHighLast10Min)
+}
+
+// calibrateLSSTempRh calibrates the Report fields provided by an LSS
+// temperature humidity record.
+func (r *Report) calibrateLSSTempRh() {
+	if r.calibrations == nil {
+		return
+	}
+	r.TemperatureIndoor = r.calibrate(calibrationDefault, "indoorTemperature", r.TemperatureIndoor)
+	r.HumidityIndoor = r.calibrateHumidity(calibrationDefault, "indoorHumidity", r.HumidityIndoor)
+
+	// recompute derived values from calibrated values
+	if r.calibrated(calibrationDefault, "indoorTemperature", "indoorHumidity") && r.TemperatureIndoor != nil && r.HumidityIndoor != nil {
+		r.DewPointIndoor = roundDerived(derived.Dewpoint(*r.TemperatureIndoor, *r.HumidityIndoor))
+		r.HeatIndexIndoor = roundDerived(derived.HeatIndex(*r.TemperatureIndoor, *r.HumidityIndoor))
+	}
+	r.DewPointIndoor = r.calibrate(calibrationDefault, "indoorDewpoint", r.DewPointIndoor)
+	r.HeatIndexIndoor = r.calibrate(calibrationDefault, "indoorHeatIndex", r.HeatIndexIndoor)
+}
+
+// roundDerived returns a pointer to the derived value rounded to the precision
+// reported by the WLL unit.
+func roundDerived(v float64) *float64 {
+	out := units.Round(v, derivedPrecision)
+	return &out
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"testing"
+
+	"github.com/tannerryan/davisweather/derived"
+)
+
+func TestCalibrationApply(t *testing.T) {
+	// curve is sorted by SetCalibration
+	curve := Calibration{Curve: []CurvePoint{{Raw: 0, Value: 0}, {Raw: 100, Value: 90}, {Raw: 200, Value: 210}}}
+	for _, test := range []struct {
+		c    Calibration
+		in   float64
+		want float64
+	}{
+		{Calibration{}, 12.5, 12.5},
+		{Calibration{Offset: -0.5}, 70, 69.5},
+		{Calibration{Multiplier: 1.5, Offset: 1}, 10, 16},
+		// interpolated between points
+		{curve, 50, 45},
+		{curve, 150, 150},
+		{curve, 100, 90},
+		// extrapolated by the nearest point
+		{curve, -10, -10},
+		{curve, 250, 260},
+		// curve applied before the multiplier and offset
+		{Calibration{Curve: curve.Curve, Multiplier: 2, Offset: 1}, 50, 91},
+	} {
+		if got := test.c.Apply(test.in); got != test.want {
+			t.Errorf("%+v.Apply(%v) = %v, want %v", test.c, test.in, got, test.want)
+		}
+	}
+}
+
+func TestSensorCalibration(t *testing.T) {
+	r, _ := NewReport(false)
+	r.SetCalibration(map[string]Calibration{
+		"temperature": {Offset: -1},
+		"humidity": {Curve: []CurvePoint{
+			{Raw: 100, Value: 100}, {Raw: 0, Value: 0}, {Raw: 50, Value: 45},
+		}},
+	})
+	r.SetSensorCalibration(2, map[string]Calibration{"temperature": {Offset: 2}, "humidity": {Multiplier: 1.1}})
+	r.SetSensorCalibration(0, map[string]Calibration{"temperature": {Offset: 100}})
+
+	updateHTTP(t, r, conditionsISS(1592400000, 1, "70", "25"))
+	updateHTTP(t, r, conditionsISS(1592400000, 2, "60", "95"))
+	for _, test := range []struct {
+		txid     int
+		temp     float64
+		humidity float64
+	}{
+		// calibration of every transmitter
+		{1, 69, 22.5},
+		// calibration of the transmitter, humidity limited to 100%
+		{2, 62, 100},
+	} {
+		s := r.Sensors[issKey(test.txid)]
+		if s.Temperature == nil || *s.Temperature != test.temp || s.Humidity == nil || *s.Humidity != test.humidity {
+			t.Errorf("transmitter %d = %v°F %v%%, want %v°F %v%%", test.txid, s.Temperature, s.Humidity, test.temp, test.humidity)
+			continue
+		}
+		// derived values recomputed from calibrated values
+		if want := *roundDerived(derived.Dewpoint(test.temp, test.humidity)); s.Dewpoint == nil || *s.Dewpoint != want {
+			t.Errorf("transmitter %d Dewpoint = %v, want %v", test.txid, s.Dewpoint, want)
+		}
+		if want := *roundDerived(derived.HeatIndex(test.temp, test.humidity)); s.HeatIndex == nil || *s.HeatIndex != want {
+			t.Errorf("transmitter %d HeatIndex = %v, want %v", test.txid, s.HeatIndex, want)
+		}
+	}
+	if r.Dewpoint == nil || *r.Dewpoint != *r.Sensors[issKey(1)].Dewpoint {
+		t.Errorf("Report Dewpoint = %v, want Dewpoint of primary transmitter", r.Dewpoint)
+	}
+
+	// transmitter calibrations remain without calibrations of every transmitter
+	r.SetSensorCalibration(2, nil)
+	r.SetCalibration(nil)
+	r.SetSensorCalibration(1, map[string]Calibration{"temperature": {Offset: 0.5}})
+	updateHTTP(t, r, conditionsISS(1592400010, 1, "70", "25"))
+	updateHTTP(t, r, conditionsISS(1592400010, 2, "60", "95"))
+	if s := r.Sensors[issKey(1)]; *s.Temperature != 70.5 || *s.Humidity != 25 {
+		t.Errorf("transmitter 1 = %v°F %v%%, want 70.5°F 25%%", *s.Temperature, *s.Humidity)
+	}
+	if s := r.Sensors[issKey(2)]; *s.Temperature != 60 || *s.Humidity != 95 {
+		t.Errorf("transmitter 2 = %v°F %v%%, want uncalibrated", *s.Temperature, *s.Humidity)
+	}
+}
+
+func TestIndoorCalibration(t *testing.T) {
+	r, _ := NewReport(false)
+	r.SetCalibration(map[string]Calibration{"indoorHumidity": {Offset: -50}})
+	updateHTTP(t, r, `{"data":{"did":"001D0A700002","ts":1592400000,"conditions":[
+		{"lsid":48301,"data_structure_type":1,"txid":1,"temp":70,"hum":50,"rx_state":0,"trans_battery_flag":0},
+		{"lsid":48302,"data_structure_type":4,"temp_in":72,"hum_in":40,"dew_point_in":46.5,"heat_index_in":70.8}]},"error":null}`)
+	if r.HumidityIndoor == nil || *r.HumidityIndoor != 0 {
+		t.Fatalf("HumidityIndoor = %v, want limited to 0", r.HumidityIndoor)
+	}
+	if want := *roundDerived(derived.Dewpoint(72, 0)); r.DewPointIndoor == nil || *r.DewPointIndoor != want {
+		t.Errorf("DewPointIndoor = %v, want %v", r.DewPointIndoor, want)
+	}
+	if r.Humidity == nil || *r.Humidity != 50 {
+		t.Errorf("Humidity = %v, want uncalibrated", r.Humidity)
+	}
+}
@@ -6,8 +6,8 @@ package davisweather
 import (
 	"context"
 	"errors"
-	"log"
 	"net"
+	"net/http"
 	"sync"
 	"time"
 )
@@ -26,11 +26,25 @@ const (
 type Client struct {
 	Notify <-chan bool // Notify emits a bool when a new weather report is generated
 
-	report          *Report   // report is the weather report state
-	verbose         bool      // verbose enables Client logging to stdout
-	unit            *wllUnit  // unit contains the network parameters for connecting to WLL unit
-	udpPort         int       // udpPort is the port of the UDP broadcasts
-	udpLastReported time.Time // udpLastReported is the time the last UDP report was received
+	report          *Report     // report is the weather report state
+	logger          Logger      // logger is the Client logger
+	unit            *wllUnit    // unit contains the network parameters for connecting to WLL unit
+	udpPort         int         // udpPort is the port of the UDP broadcasts
+	udpLastReported time.Time   // udpLastReported is the time the last UDP report was received
+	udpMutex        *sync.Mutex // udpMutex is for atomic udpPort and udpLastReported actions
+
+	httpInterval   time.Duration // httpInterval is how often to poll for HTTP weather conditions
+	httpTimeout    time.Duration // httpTimeout is the HTTP client timeout
+	httpStartDelay time.Duration // httpStartDelay is the delay before the first HTTP poll
+	httpClient     *http.Client  // httpClient is the HTTP client for requests to the WLL unit
+	udpDeadline    time.Duration // udpDeadline is UDP read deadline before sending broadcast response
+	udpDuration    time.Duration // udpDuration is how long UDP broadcasts are enabled for
+	udpBufferSize  int           // udpBufferSize is buffer size for reading UDP messages
+	mDNSTimeout    time.Duration // mDNSTimeout is the mDNS discovery timeout
+	mDNSInterval   time.Duration // mDNSInterval is sleep between mDNS discovery (gets modified to TTL)
+
+	health   *health  // health tracks the Client status
+	recorder Recorder // recorder receives raw payloads (nil if disabled)
 
 	wg *sync.WaitGroup // wg is for checking if all goroutines are done
 }
@@ -39,18 +53,12 @@ type Client struct {
 // cancelling the Client. It automatically discovers the WeatherLink Live (WLL)
 // unit on the local network. If multicast DNS is disabled on the network, use
 // the unmanaged client. It returns a new client for consuming weather data.
-// Verbose enables Client logging.
-func Managed(ctx context.Context, verbose bool) *Client {
-	// initialize report and notification channel
-	report, notify := NewReport(verbose)
+// Verbose enables Client logging, unless a Logger is provided in the options.
+// Options configure the Client.
+func Managed(ctx context.Context, verbose bool, opts ...Option) *Client {
 	// generate client
-	c := &Client{
-		Notify:  notify,
-		report:  report,
-		verbose: verbose,
-		wg:      &sync.WaitGroup{},
-	}
-	c.println("[davisweather] managed client initialized")
+	c := newClient(verbose, DiscoverySearching, opts)
+	c.log(LevelInfo, "client", "managed client initialized")
 
 	// mDNS context to notify engine when to start
 	mDNSCtx, mDNSDone := context.WithCancel(ctx)
@@ -59,6 +67,7 @@ func Managed(ctx context.Context, verbose bool) *Client {
 	c.wg.Add(2)
 	go c.discovery(ctx, mDNSDone)
 	go c.engine(ctx, mDNSCtx)
+	c.startArchive(ctx)
 	return c
 }
 
@@ -66,8 +75,9 @@ func Managed(ctx context.Context, verbose bool) *Client {
 // cancelling the Client and a hostname (IP or domain) and port of the
 // WeatherLink Live (WLL) unit. It returns a new client for consuming weather
 // data. It returns an error if no hostname is provided. Verbose enables Client
-// logging.
-func Unmanaged(ctx context.Context, verbose bool, hostname string, port int) (*Client, error) {
+// logging, unless a Logger is provided in the options. Options configure the
+// Client.
+func Unmanaged(ctx context.Context, verbose bool, hostname string, port int, opts ...Option) (*Client, error) {
 	if hostname == "" {
 		return nil, errInvalidHostname
 	}
@@ -75,9 +85,7 @@ func Unmanaged(ctx context.Context, verbose bool, hostname string, port int) (*C
 	if port <= 0 {
 		port = clientDefaultPort
 	}
-	// initialize report and notification channel
 	var u wllUnit
-	report, notify := NewReport(verbose)
 
 	// parse provided hostname
 	ip := net.ParseIP(hostname)
@@ -99,42 +107,69 @@ func Unmanaged(ctx context.Context, verbose bool, hostname string, port int) (*C
 		}
 	}
 	// generate client
-	c := &Client{
-		Notify:  notify,
-		report:  report,
-		verbose: verbose,
-		unit:    &u,
-		wg:      &sync.WaitGroup{},
-	}
-	c.printf("[davisweather] unmanaged client initialized, using WeatherLink Live unit at %s:%d", u.HostName, u.Port)
+	c := newClient(verbose, DiscoveryDisabled, opts)
+	c.unit = &u
+	c.health.status.Address = u.GetURL()
+	c.log(LevelInfo, "client", "unmanaged client initialized", "address", u.GetURL())
 
 	// start event engine, no mDNS context
 	c.wg.Add(1)
 	go c.engine(ctx, nil)
+	c.startArchive(ctx)
 	return c, nil
 }
 
+// newClient returns a Client with the default configuration and the provided
+// options applied. The discovery state is the initial Client status.
+func newClient(verbose bool, discovery DiscoveryState, opts []Option) *Client {
+	// initialize report and notification channel
+	report, notify := NewReport(verbose)
+	c := &Client{
+		Notify: notify,
+		report: report,
+		logger: verboseLogger(verbose),
+
+		httpInterval:   engineIntervalHTTP,
+		httpTimeout:    httpTimeout,
+		httpStartDelay: httpStartDelay,
+		httpClient:     httpClient,
+		udpDeadline:    udpDeadline,
+		udpDuration:    udpDuration,
+		udpBufferSize:  udpBufferSize,
+		mDNSTimeout:    mDNSTimeout,
+		mDNSInterval:   mDNSInterval,
+
+		health: newHealth(discovery),
+
+		udpMutex: &sync.Mutex{},
+		wg:       &sync.WaitGroup{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.report.restoreET(time.Now())
+	return c
+}
+
 // Report returns the latest weather report or an error.
 func (c *Client) Report() (*Report, error) {
 	return c.report.Copy()
 }
 
-// Closed blocks until the client has been gracefully terminated.
-func (c *Client) Closed() {
-	c.wg.Wait()
+// LastDiff returns the fields modified by the most recent update of the Report
+// state. It returns nil if the most recent update did not modify the Report.
+func (c *Client) LastDiff() []Change {
+	return c.report.LastDiff()
 }
 
-// println calls log.Println if verbose logging is enabled.
-func (c *Client) println(v ...interface{}) {
-	if c.verbose {
-		log.Println(v...)
-	}
+// SetPrimary configures the transmitter used for populating the Report fields
+// of the provided measurement. Conditions of every transmitter remain available
+// in Report.Sensors.
+func (c *Client) SetPrimary(m Measurement, txid int) {
+	c.report.SetPrimary(m, txid)
 }
 
-// printf calls log.Printf is verbose logging is enabled. Like Println, it
-// terminates with a new line.
-func (c *Client) printf(format string, v ...interface{}) {
-	if c.verbose {
-		log.Printf(format+"\n", v...)
-	}
+// Closed blocks until the client has been gracefully terminated.
+func (c *Client) Closed() {
+	c.wg.Wait()
 }
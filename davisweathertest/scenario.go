@@ -0,0 +1,126 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweathertest
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Conditions are the simulated weather conditions at an instant.
+type Conditions struct {
+	Temperature float64 // Temperature (°F)
+	Humidity    float64 // Humidity (%RH)
+	WindSpeed   float64 // WindSpeed is wind speed (mph)
+	WindDir     float64 // WindDir is wind direction (°)
+	RainRate    float64 // RainRate is rain rate (count/hour)
+	SolarRad    float64 // SolarRad is solar radiation (W/m²)
+	UVIndex     float64 // UVIndex is solar UV index
+
+	Barometer         float64 // Barometer is barometer reading at current elevation (inches)
+	TemperatureIndoor float64 // TemperatureIndoor is indoor temp (°F)
+	HumidityIndoor    float64 // HumidityIndoor is indoor humidity (%)
+}
+
+// Scenario generates the simulated weather conditions over time.
+type Scenario interface {
+	// Conditions returns the weather conditions at the provided time elapsed
+	// since the simulated unit started.
+	Conditions(elapsed time.Duration) Conditions
+}
+
+// Typical are mild weather conditions, used by the default Scenario.
+var Typical = Conditions{
+	Temperature:       68.5,
+	Humidity:          55,
+	WindSpeed:         6,
+	WindDir:           225,
+	RainRate:          0,
+	SolarRad:          450,
+	UVIndex:           3.2,
+	Barometer:         29.92,
+	TemperatureIndoor: 71.2,
+	HumidityIndoor:    40,
+}
+
+// steady is a Scenario with constant conditions.
+type steady Conditions
+
+// Steady returns a Scenario with constant weather conditions.
+func Steady(c Conditions) Scenario {
+	return steady(c)
+}
+
+// Conditions returns the constant weather conditions.
+func (s steady) Conditions(elapsed time.Duration) Conditions {
+	return Conditions(s)
+}
+
+// diurnal is a Scenario following a daily cycle.
+type diurnal struct {
+	base   Conditions    // base are the mean conditions
+	period time.Duration // period is the length of a simulated day
+}
+
+// Diurnal returns a Scenario cycling around the base conditions once per
+// period: temperature and solar radiation peak mid-cycle, humidity is lowest
+// mid-cycle, and wind gusts and veers around its base values. A shortened
+// period accelerates the simulated day.
+func Diurnal(base Conditions, period time.Duration) Scenario {
+	if period <= 0 {
+		period = 24 * time.Hour
+	}
+	return diurnal{base: base, period: period}
+}
+
+// Conditions returns the weather conditions of the daily cycle.
+func (d diurnal) Conditions(elapsed time.Duration) Conditions {
+	phase := 2 * math.Pi * float64(elapsed%d.period) / float64(d.period)
+	day := -math.Cos(phase) // -1 at start of cycle, 1 mid-cycle
+
+	c := d.base
+	c.Temperature += 10 * day
+	c.Humidity = math.Max(5, math.Min(100, c.Humidity-20*day))
+	c.WindSpeed = math.Max(0, c.WindSpeed*(1+0.5*math.Sin(7*phase)))
+	c.WindDir = math.Mod(c.WindDir+30*math.Sin(3*phase)+360, 360)
+	c.SolarRad = math.Max(0, c.SolarRad*2*day)
+	c.UVIndex = math.Max(0, c.UVIndex*2*day)
+	c.Barometer += 0.05 * math.Sin(phase)
+	return c
+}
+
+// Step is a scripted change of weather conditions.
+type Step struct {
+	At         time.Duration // At is the elapsed time the conditions apply from
+	Conditions Conditions    // Conditions are the weather conditions
+}
+
+// script is a Scenario of scripted steps.
+type script []Step
+
+// Script returns a Scenario applying each step from its elapsed time until the
+// next step. The first step applies before its elapsed time.
+func Script(steps ...Step) Scenario {
+	s := append(script(nil), steps...)
+	sort.SliceStable(s, func(i, j int) bool {
+		return s[i].At < s[j].At
+	})
+	return s
+}
+
+// Conditions returns the weather conditions of the current step.
+func (s script) Conditions(elapsed time.Duration) Conditions {
+	if len(s) == 0 {
+		return Typical
+	}
+	current := s[0].Conditions
+	for _, step := range s {
+		if step.At > elapsed {
+			break
+		}
+		current = step.Conditions
+	}
+	return current
+}
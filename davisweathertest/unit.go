@@ -0,0 +1,552 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+// Package davisweathertest provides a simulated WeatherLink Live (WLL) unit for
+// testing davisweather clients without a physical unit on the network.
+//
+// The simulated unit serves the current conditions and broadcast routes over
+// HTTP on localhost, sends UDP broadcasts once enabled, and optionally
+// advertises itself over mDNS for the managed client.
+package davisweathertest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/grandcat/zeroconf"
+	"github.com/tannerryan/davisweather/derived"
+)
+
+const (
+	// routeConditions is route for fetching weather conditions
+	routeConditions = "/v1/current_conditions"
+	// routeBroadcastResponse is route for enabling broadcasts
+	routeBroadcastResponse = "/v1/real_time"
+
+	// defaultDeviceID is the default simulated device ID
+	defaultDeviceID = "001D0A7000DE"
+	// defaultTransmitterID is the default simulated ISS transmitter ID
+	defaultTransmitterID = 1
+	// defaultRainSize is the default simulated rain collector (0.01")
+	defaultRainSize = 1
+	// defaultBroadcastHost is the default destination of UDP broadcasts
+	defaultBroadcastHost = "127.0.0.1"
+	// defaultBroadcastInterval is how often the WLL unit sends UDP broadcasts
+	defaultBroadcastInterval = 2500 * time.Millisecond
+
+	// mDNSInstance is mDNS instance name
+	mDNSInstance = "_weatherlinklive"
+	// mDNSService is mDNS service name
+	mDNSService = "_tcp"
+	// mDNSDomain is mDNS domain name
+	mDNSDomain = "local."
+	// mDNSHost is the advertised host name
+	mDNSHost = "davisweathertest"
+
+	// lsidISS is the logical sensor ID of the simulated ISS
+	lsidISS = 48308
+	// lsidBarometer is the logical sensor ID of the simulated LSS barometer
+	lsidBarometer = 48306
+	// lsidTempRh is the logical sensor ID of the simulated LSS temp/hum sensor
+	lsidTempRh = 48307
+)
+
+var (
+	// errClosed is returned when the simulated unit is already closed
+	errClosed = errors.New("davisweathertest: unit already closed")
+)
+
+// Config configures the simulated WLL unit. The zero value simulates typical
+// conditions and broadcasts to localhost.
+type Config struct {
+	DeviceID      string   // DeviceID is unique device ID
+	Scenario      Scenario // Scenario generates the weather conditions (default steady typical conditions)
+	TransmitterID int      // TransmitterID is ID of the ISS transmitter (default 1)
+	RainSize      int      // RainSize is size of rain collector (1: 0.01", 2: 0.2mm)
+
+	BroadcastHost     string        // BroadcastHost is the destination of UDP broadcasts (default 127.0.0.1)
+	BroadcastPort     int           // BroadcastPort is the port of UDP broadcasts (default unused ephemeral port)
+	BroadcastInterval time.Duration // BroadcastInterval is time between UDP broadcasts (default 2.5 seconds)
+	PacketLoss        float64       // PacketLoss is the probability of dropping a UDP broadcast (0-1)
+
+	MDNS bool  // MDNS advertises the unit over mDNS
+	Seed int64 // Seed seeds the packet loss generator
+}
+
+// Stats are the request and broadcast counters of the simulated unit.
+type Stats struct {
+	ConditionRequests int // ConditionRequests is number of current conditions requests
+	BroadcastRequests int // BroadcastRequests is number of broadcast requests
+	Broadcasts        int // Broadcasts is number of UDP broadcasts sent
+	Dropped           int // Dropped is number of UDP broadcasts dropped by packet loss
+}
+
+// httpFailure is an injected HTTP error response.
+type httpFailure struct {
+	status  int    // status is the HTTP status code
+	code    int    // code is the WLL error code
+	message string // message is the WLL error message
+}
+
+// rainSample is the cumulative rain count at an instant.
+type rainSample struct {
+	at    time.Time // at is the time of the sample
+	total float64   // total is the cumulative rain count
+}
+
+// Unit is a simulated WLL unit.
+type Unit struct {
+	config   Config           // config is the unit configuration
+	listener net.Listener     // listener is the HTTP listener
+	server   *http.Server     // server is the HTTP server
+	conn     net.Conn         // conn is the UDP broadcast connection
+	mdns     *zeroconf.Server // mdns is the mDNS responder
+
+	start          time.Time    // start is when the unit started
+	broadcastUntil time.Time    // broadcastUntil is when UDP broadcasts expire
+	failure        *httpFailure // failure is the injected HTTP error
+	rain           []rainSample // rain are the cumulative rain samples of the last 24 hours
+	rainTotal      float64      // rainTotal is the cumulative rain count
+	rainAt         time.Time    // rainAt is when rainTotal was last advanced
+	stats          Stats        // stats are the unit counters
+	random         *rand.Rand   // random is the packet loss generator
+	closed         bool         // closed indicates the unit was closed
+
+	cancel context.CancelFunc // cancel terminates the broadcast loop
+	wg     *sync.WaitGroup    // wg is for checking if all goroutines are done
+	mutex  *sync.Mutex        // mutex is for atomic unit actions
+}
+
+// Start starts a simulated WLL unit on localhost. It returns an error if the
+// HTTP listener, UDP connection or mDNS responder cannot be created.
+func Start(config Config) (*Unit, error) {
+	if config.DeviceID == "" {
+		config.DeviceID = defaultDeviceID
+	}
+	if config.Scenario == nil {
+		config.Scenario = Steady(Typical)
+	}
+	if config.TransmitterID <= 0 {
+		config.TransmitterID = defaultTransmitterID
+	}
+	if config.RainSize <= 0 {
+		config.RainSize = defaultRainSize
+	}
+	if config.BroadcastHost == "" {
+		config.BroadcastHost = defaultBroadcastHost
+	}
+	if config.BroadcastInterval <= 0 {
+		config.BroadcastInterval = defaultBroadcastInterval
+	}
+
+	if config.BroadcastPort <= 0 {
+		port, err := freePort()
+		if err != nil {
+			return nil, err
+		}
+		config.BroadcastPort = port
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("udp", net.JoinHostPort(config.BroadcastHost, strconv.Itoa(config.BroadcastPort)))
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	now := time.Now()
+	u := &Unit{
+		config:   config,
+		listener: listener,
+		conn:     conn,
+		start:    now,
+		rainAt:   now,
+		random:   rand.New(rand.NewSource(config.Seed)),
+		wg:       &sync.WaitGroup{},
+		mutex:    &sync.Mutex{},
+	}
+
+	// advertise unit over mDNS
+	if config.MDNS {
+		u.mdns, err = zeroconf.RegisterProxy(mDNSInstance, mDNSService, mDNSDomain,
+			u.Port(), mDNSHost, []string{u.Host()}, []string{"did=" + config.DeviceID}, nil)
+		if err != nil {
+			listener.Close()
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	// serve HTTP routes
+	mux := http.NewServeMux()
+	mux.HandleFunc(routeConditions, u.handleConditions)
+	mux.HandleFunc(routeBroadcastResponse, u.handleBroadcastResponse)
+	u.server = &http.Server{Handler: mux}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	u.cancel = cancel
+	u.wg.Add(2)
+	go func() {
+		defer u.wg.Done()
+		u.server.Serve(listener)
+	}()
+	go u.broadcastLoop(ctx)
+	return u, nil
+}
+
+// Host returns the IP address of the simulated unit.
+func (u *Unit) Host() string {
+	return u.listener.Addr().(*net.TCPAddr).IP.String()
+}
+
+// Port returns the HTTP port of the simulated unit.
+func (u *Unit) Port() int {
+	return u.listener.Addr().(*net.TCPAddr).Port
+}
+
+// BroadcastPort returns the port of UDP broadcasts, which is also reported to
+// clients enabling broadcasts.
+func (u *Unit) BroadcastPort() int {
+	return u.config.BroadcastPort
+}
+
+// URL returns the HTTP URL of the simulated unit.
+func (u *Unit) URL() string {
+	return "http://" + u.listener.Addr().String()
+}
+
+// SetScenario replaces the Scenario generating the weather conditions.
+func (u *Unit) SetScenario(s Scenario) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.advanceRain(time.Now())
+	u.config.Scenario = s
+}
+
+// SetPacketLoss configures the probability of dropping a UDP broadcast (0-1).
+func (u *Unit) SetPacketLoss(p float64) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.config.PacketLoss = p
+}
+
+// SetHTTPError makes every HTTP route respond with the provided HTTP status and
+// WLL error until ClearHTTPError is called.
+func (u *Unit) SetHTTPError(status int, code int, message string) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.failure = &httpFailure{status: status, code: code, message: message}
+}
+
+// ClearHTTPError restores normal HTTP responses.
+func (u *Unit) ClearHTTPError() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.failure = nil
+}
+
+// Stats returns the request and broadcast counters of the simulated unit.
+func (u *Unit) Stats() Stats {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.stats
+}
+
+// Close stops the simulated unit. It returns an error if the unit is already
+// closed.
+func (u *Unit) Close() error {
+	u.mutex.Lock()
+	if u.closed {
+		u.mutex.Unlock()
+		return errClosed
+	}
+	u.closed = true
+	u.mutex.Unlock()
+
+	u.cancel()
+	err := u.server.Close()
+	u.conn.Close()
+	if u.mdns != nil {
+		u.mdns.Shutdown()
+	}
+	u.wg.Wait()
+	return err
+}
+
+// handleConditions serves the current weather conditions.
+func (u *Unit) handleConditions(w http.ResponseWriter, req *http.Request) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.stats.ConditionRequests++
+
+	if u.writeFailure(w) {
+		return
+	}
+	now := time.Now()
+	u.advanceRain(now)
+	c := u.config.Scenario.Conditions(now.Sub(u.start))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"did": u.config.DeviceID,
+			"ts":  now.Unix(),
+			"conditions": []interface{}{
+				u.recordISS(c, now),
+				recordBarometer(c),
+				recordTempRh(c),
+			},
+		},
+		"error": nil,
+	})
+}
+
+// handleBroadcastResponse enables UDP broadcasts for the requested duration.
+func (u *Unit) handleBroadcastResponse(w http.ResponseWriter, req *http.Request) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.stats.BroadcastRequests++
+
+	if u.writeFailure(w) {
+		return
+	}
+	duration, err := strconv.Atoi(req.URL.Query().Get("duration"))
+	if err != nil || duration <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"data":  nil,
+			"error": map[string]interface{}{"code": 400, "message": "invalid duration"},
+		})
+		return
+	}
+	u.broadcastUntil = time.Now().Add(time.Duration(duration) * time.Second)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"broadcast_port": u.config.BroadcastPort,
+			"duration":       duration,
+		},
+		"error": nil,
+	})
+}
+
+// writeFailure writes the injected HTTP error, if any. It returns true if a
+// failure was written. The unit mutex must be held.
+func (u *Unit) writeFailure(w http.ResponseWriter) bool {
+	if u.failure == nil {
+		return false
+	}
+	writeJSON(w, u.failure.status, map[string]interface{}{
+		"data":  nil,
+		"error": map[string]interface{}{"code": u.failure.code, "message": u.failure.message},
+	})
+	return true
+}
+
+// broadcastLoop sends UDP broadcasts while broadcasts are enabled.
+func (u *Unit) broadcastLoop(ctx context.Context) {
+	defer u.wg.Done()
+
+	ticker := time.NewTicker(u.config.BroadcastInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if payload := u.broadcast(now); payload != nil {
+				u.conn.Write(payload)
+			}
+		}
+	}
+}
+
+// broadcast returns the UDP broadcast payload for the provided time. It
+// returns nil if broadcasts are disabled or the broadcast is dropped.
+func (u *Unit) broadcast(now time.Time) []byte {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if now.After(u.broadcastUntil) {
+		return nil
+	}
+	if u.random.Float64() < u.config.PacketLoss {
+		u.stats.Dropped++
+		return nil
+	}
+	u.stats.Broadcasts++
+
+	u.advanceRain(now)
+	c := u.config.Scenario.Conditions(now.Sub(u.start))
+	payload, _ := json.Marshal(map[string]interface{}{
+		"did": u.config.DeviceID,
+		"ts":  now.Unix(),
+		"conditions": []interface{}{
+			map[string]interface{}{
+				"lsid":                             lsidISS,
+				"data_structure_type":              1,
+				"txid":                             u.config.TransmitterID,
+				"wind_speed_last":                  round(c.WindSpeed, 2),
+				"wind_dir_last":                    math.Round(c.WindDir),
+				"rain_size":                        u.config.RainSize,
+				"rain_rate_last":                   math.Round(c.RainRate),
+				"rain_15_min":                      u.rainSince(now, 15*time.Minute),
+				"rain_60_min":                      u.rainSince(now, time.Hour),
+				"rain_24_hr":                       u.rainSince(now, 24*time.Hour),
+				"rain_storm":                       u.rainSince(now, 24*time.Hour),
+				"rainfall_daily":                   u.rainSince(now, sinceMidnight(now)),
+				"rainfall_monthly":                 math.Floor(u.rainTotal),
+				"rainfall_year":                    math.Floor(u.rainTotal),
+				"wind_speed_hi_last_10_min":        round(c.WindSpeed*1.3, 2),
+				"wind_dir_at_hi_speed_last_10_min": math.Round(c.WindDir),
+			},
+		},
+	})
+	return payload
+}
+
+// recordISS returns the ISS record of the current conditions. The unit mutex
+// must be held.
+func (u *Unit) recordISS(c Conditions, now time.Time) map[string]interface{} {
+	gust := c.WindSpeed * 1.3
+	return map[string]interface{}{
+		"lsid":                lsidISS,
+		"data_structure_type": 1,
+		"txid":                u.config.TransmitterID,
+
+		"temp":       round(c.Temperature, 1),
+		"hum":        round(c.Humidity, 1),
+		"dew_point":  round(derived.Dewpoint(c.Temperature, c.Humidity), 1),
+		"wet_bulb":   round(derived.Wetbulb(c.Temperature, c.Humidity), 1),
+		"heat_index": round(derived.HeatIndex(c.Temperature, c.Humidity), 1),
+		"wind_chill": round(derived.WindChill(c.Temperature, c.WindSpeed), 1),
+		"thw_index":  round(derived.HeatIndex(derived.WindChill(c.Temperature, c.WindSpeed), c.Humidity), 1),
+		"thsw_index": round(derived.HeatIndex(derived.WindChill(c.Temperature, c.WindSpeed), c.Humidity)+c.SolarRad/100, 1),
+
+		"wind_speed_last":                  round(c.WindSpeed, 2),
+		"wind_dir_last":                    math.Round(c.WindDir),
+		"wind_speed_avg_last_1_min":        round(c.WindSpeed, 2),
+		"wind_dir_scalar_avg_last_1_min":   math.Round(c.WindDir),
+		"wind_speed_avg_last_2_min":        round(c.WindSpeed, 2),
+		"wind_dir_scalar_avg_last_2_min":   math.Round(c.WindDir),
+		"wind_speed_hi_last_2_min":         round(gust, 2),
+		"wind_dir_at_hi_speed_last_2_min":  math.Round(c.WindDir),
+		"wind_speed_avg_last_10_min":       round(c.WindSpeed, 2),
+		"wind_dir_scalar_avg_last_10_min":  math.Round(c.WindDir),
+		"wind_speed_hi_last_10_min":        round(gust, 2),
+		"wind_dir_at_hi_speed_last_10_min": math.Round(c.WindDir),
+
+		"rain_size":                u.config.RainSize,
+		"rain_rate_last":           math.Round(c.RainRate),
+		"rain_rate_hi":             math.Round(c.RainRate),
+		"rainfall_last_15_min":     u.rainSince(now, 15*time.Minute),
+		"rain_rate_hi_last_15_min": math.Round(c.RainRate),
+		"rainfall_last_60_min":     u.rainSince(now, time.Hour),
+		"rainfall_last_24_hr":      u.rainSince(now, 24*time.Hour),
+		"rain_storm":               u.rainSince(now, 24*time.Hour),
+
+		"solar_rad": math.Round(c.SolarRad),
+		"uv_index":  round(c.UVIndex, 1),
+
+		"rx_state":           0,
+		"trans_battery_flag": 0,
+
+		"rainfall_daily":   u.rainSince(now, sinceMidnight(now)),
+		"rainfall_monthly": math.Floor(u.rainTotal),
+		"rainfall_year":    math.Floor(u.rainTotal),
+		"rain_storm_last":  0,
+	}
+}
+
+// recordBarometer returns the LSS barometer record of the current conditions.
+func recordBarometer(c Conditions) map[string]interface{} {
+	return map[string]interface{}{
+		"lsid":                lsidBarometer,
+		"data_structure_type": 3,
+		"bar_sea_level":       round(c.Barometer+0.02, 3),
+		"bar_trend":           0,
+		"bar_absolute":        round(c.Barometer, 3),
+	}
+}
+
+// recordTempRh returns the LSS temperature and humidity record of the current
+// conditions.
+func recordTempRh(c Conditions) map[string]interface{} {
+	return map[string]interface{}{
+		"lsid":                lsidTempRh,
+		"data_structure_type": 4,
+		"temp_in":             round(c.TemperatureIndoor, 1),
+		"hum_in":              round(c.HumidityIndoor, 1),
+		"dew_point_in":        round(derived.Dewpoint(c.TemperatureIndoor, c.HumidityIndoor), 1),
+		"heat_index_in":       round(derived.HeatIndex(c.TemperatureIndoor, c.HumidityIndoor), 1),
+	}
+}
+
+// advanceRain accumulates rain up to the provided time using the current rain
+// rate. The unit mutex must be held.
+func (u *Unit) advanceRain(now time.Time) {
+	if !now.After(u.rainAt) {
+		return
+	}
+	rate := u.config.Scenario.Conditions(now.Sub(u.start)).RainRate
+	u.rainTotal += rate * now.Sub(u.rainAt).Hours()
+	u.rainAt = now
+	u.rain = append(u.rain, rainSample{at: now, total: u.rainTotal})
+
+	// discard samples older than 24 hours
+	cutoff := now.Add(-24 * time.Hour)
+	for len(u.rain) > 1 && u.rain[1].at.Before(cutoff) {
+		u.rain = u.rain[1:]
+	}
+}
+
+// rainSince returns the whole rain count accumulated over the provided
+// duration. The unit mutex must be held.
+func (u *Unit) rainSince(now time.Time, d time.Duration) float64 {
+	cutoff := now.Add(-d)
+	base := 0.0
+	for _, s := range u.rain {
+		if s.at.After(cutoff) {
+			break
+		}
+		base = s.total
+	}
+	return math.Floor(u.rainTotal) - math.Floor(base)
+}
+
+// freePort returns an unused UDP port, so that simulated units of parallel
+// tests do not broadcast to the same port.
+func freePort() (int, error) {
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port, nil
+}
+
+// sinceMidnight returns the time elapsed since local midnight.
+func sinceMidnight(now time.Time) time.Duration {
+	y, m, d := now.Date()
+	return now.Sub(time.Date(y, m, d, 0, 0, 0, 0, now.Location()))
+}
+
+// round rounds the value to the provided decimal places.
+func round(v float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(v*scale) / scale
+}
+
+// writeJSON writes the JSON encoded value with the provided HTTP status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
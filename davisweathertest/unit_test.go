@@ -0,0 +1,129 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweathertest_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/davisweather"
+	"github.com/tannerryan/davisweather/davisweathertest"
+)
+
+// startClient starts a simulated unit and an unmanaged Client polling it.
+func startClient(t *testing.T, ctx context.Context, config davisweathertest.Config) (*davisweathertest.Unit, *davisweather.Client) {
+	t.Helper()
+	if config.BroadcastInterval == 0 {
+		config.BroadcastInterval = 100 * time.Millisecond
+	}
+	unit, err := davisweathertest.Start(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := davisweather.Unmanaged(ctx, false, unit.Host(), unit.Port(),
+		davisweather.WithHTTPStartDelay(0),
+		davisweather.WithHTTPInterval(200*time.Millisecond),
+		davisweather.WithUDPDeadline(time.Second))
+	if err != nil {
+		unit.Close()
+		t.Fatal(err)
+	}
+	return unit, c
+}
+
+// waitFor polls the condition until it is true or the timeout expires.
+func waitFor(t *testing.T, timeout time.Duration, msg string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for " + msg)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestUnmanaged(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	unit, c := startClient(t, ctx, davisweathertest.Config{DeviceID: "001D0A700001"})
+	defer unit.Close()
+
+	events := c.Subscribe(ctx, davisweather.SubscribeOptions{Buffer: 16})
+	select {
+	case event := <-events:
+		if event.Method != "http" {
+			t.Errorf("first Event method = %q, want http", event.Method)
+		}
+		r := event.Report
+		if r.DeviceID != "001D0A700001" {
+			t.Errorf("DeviceID = %q, want 001D0A700001", r.DeviceID)
+		}
+		if r.Temperature == nil || *r.Temperature != davisweathertest.Typical.Temperature {
+			t.Errorf("Temperature = %v, want %v", r.Temperature, davisweathertest.Typical.Temperature)
+		}
+		if r.BarometerAbsolute == nil || *r.BarometerAbsolute != davisweathertest.Typical.Barometer {
+			t.Errorf("BarometerAbsolute = %v, want %v", r.BarometerAbsolute, davisweathertest.Typical.Barometer)
+		}
+		if s, ok := r.Sensors[davisweather.SensorKey{LogicalSensorID: 48308, TransmitterID: 1}]; !ok || s.WindSpeedLast == nil {
+			t.Errorf("Sensors = %+v, want ISS conditions", r.Sensors)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no Event received")
+	}
+
+	// broadcasts are enabled on the port reported by the unit
+	waitFor(t, 10*time.Second, "UDP broadcast", func() bool {
+		return !c.Status().LastUDP.IsZero()
+	})
+	if status := c.Status(); status.State != davisweather.StateLive || status.UDPPort != unit.BroadcastPort() {
+		t.Errorf("Status = %v on port %d, want live on port %d", status.State, status.UDPPort, unit.BroadcastPort())
+	}
+	if stats := unit.Stats(); stats.ConditionRequests == 0 || stats.BroadcastRequests == 0 || stats.Broadcasts == 0 {
+		t.Errorf("Stats = %+v, want requests and broadcasts", stats)
+	}
+
+	cancel()
+	c.Closed()
+}
+
+func TestHTTPError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	unit, c := startClient(t, ctx, davisweathertest.Config{})
+	defer unit.Close()
+
+	unit.SetHTTPError(http.StatusServiceUnavailable, 503, "unavailable")
+	waitFor(t, 10*time.Second, "HTTP failure", func() bool {
+		return c.Status().HTTPFailures > 0
+	})
+	if _, err := c.Report(); err != nil {
+		t.Fatal(err)
+	}
+
+	unit.ClearHTTPError()
+	waitFor(t, 10*time.Second, "HTTP recovery", func() bool {
+		return c.Status().HTTPFailures == 0 && !c.Status().LastHTTP.IsZero()
+	})
+	cancel()
+	c.Closed()
+}
+
+func TestBroadcastPort(t *testing.T) {
+	a, err := davisweathertest.Start(davisweathertest.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := davisweathertest.Start(davisweathertest.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if a.BroadcastPort() == 0 || a.BroadcastPort() == b.BroadcastPort() {
+		t.Errorf("broadcast ports = %d and %d, want distinct ports", a.BroadcastPort(), b.BroadcastPort())
+	}
+}
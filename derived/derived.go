@@ -0,0 +1,228 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+// Package derived computes meteorological quantities derived from the weather
+// conditions reported by the WeatherLink Live unit. Inputs are in the US
+// customary units of the Report.
+package derived
+
+import (
+	"math"
+
+	"github.com/tannerryan/davisweather/units"
+)
+
+const (
+	// gasConstantDry is the specific gas constant of dry air (J/(kg·K))
+	gasConstantDry = 287.058
+	// gasConstantVapor is the specific gas constant of water vapor (J/(kg·K))
+	gasConstantVapor = 461.495
+	// cloudBaseLapse is the dewpoint spread (°F) per 1000 ft of cloud base
+	cloudBaseLapse = 4.4
+)
+
+var (
+	// beaufortLimits are the upper limits of each Beaufort number (m/s)
+	beaufortLimits = []float64{0.5, 1.6, 3.4, 5.5, 8.0, 10.8, 13.9, 17.2, 20.8, 24.5, 28.5, 32.7}
+	// compassPoints are the 16 points of the compass, clockwise from north
+	compassPoints = []string{
+		"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE",
+		"S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW",
+	}
+)
+
+// Inputs are the weather conditions used to derive the Values. Values are nil
+// if not provided.
+type Inputs struct {
+	Temperature *float64 // Temperature (°F)
+	Humidity    *float64 // Humidity (%RH)
+	WindSpeed   *float64 // WindSpeed is average wind speed (mph)
+	WindDir     *float64 // WindDir is average wind direction (°)
+	Barometer   *float64 // Barometer is barometer reading at current elevation (inches)
+}
+
+// Values are the derived meteorological quantities. Each value is nil if its
+// inputs are not provided.
+type Values struct {
+	VaporPressure       *float64 `json:"vaporPressure,omitempty"`       // VaporPressure is partial pressure of water vapor (hPa)
+	AbsoluteHumidity    *float64 `json:"absoluteHumidity,omitempty"`    // AbsoluteHumidity is water vapor density (g/m³)
+	FrostPoint          *float64 `json:"frostPoint,omitempty"`          // FrostPoint is saturation temperature over ice (°F)
+	Humidex             *float64 `json:"humidex,omitempty"`             // Humidex is Canadian humidity index (comparable to °C)
+	ApparentTemperature *float64 `json:"apparentTemperature,omitempty"` // ApparentTemperature is Steadman apparent temperature (°F)
+	AirDensity          *float64 `json:"airDensity,omitempty"`          // AirDensity is density of moist air (kg/m³)
+	DensityAltitude     *float64 `json:"densityAltitude,omitempty"`     // DensityAltitude is altitude of equal air density in the standard atmosphere (ft)
+	CloudBase           *float64 `json:"cloudBase,omitempty"`           // CloudBase is estimated cumulus cloud base above ground (ft)
+	Beaufort            *int     `json:"beaufort,omitempty"`            // Beaufort is Beaufort wind force number (0-12)
+	CompassPoint        *string  `json:"compassPoint,omitempty"`        // CompassPoint is 16 point compass direction of the wind
+}
+
+// Compute returns the Values derived from the provided Inputs. It returns nil
+// if no value can be derived.
+func Compute(in Inputs) *Values {
+	var v Values
+	empty := true
+	set := func(value float64, places int) *float64 {
+		empty = false
+		out := units.Round(value, places)
+		return &out
+	}
+
+	if in.Temperature != nil && in.Humidity != nil {
+		t, rh := *in.Temperature, *in.Humidity
+		v.VaporPressure = set(VaporPressure(t, rh), 2)
+		v.AbsoluteHumidity = set(AbsoluteHumidity(t, rh), 2)
+		v.FrostPoint = set(FrostPoint(t, rh), 1)
+		v.Humidex = set(Humidex(t, rh), 1)
+		v.CloudBase = set(CloudBase(t, rh), 0)
+		if in.WindSpeed != nil {
+			v.ApparentTemperature = set(ApparentTemperature(t, rh, *in.WindSpeed), 1)
+		}
+		if in.Barometer != nil {
+			v.AirDensity = set(AirDensity(t, rh, *in.Barometer), 4)
+			v.DensityAltitude = set(DensityAltitude(t, rh, *in.Barometer), 0)
+		}
+	}
+	if in.WindSpeed != nil {
+		b := Beaufort(*in.WindSpeed)
+		v.Beaufort = &b
+		empty = false
+	}
+	if in.WindDir != nil {
+		p := CompassPoint(*in.WindDir)
+		v.CompassPoint = &p
+		empty = false
+	}
+
+	if empty {
+		return nil
+	}
+	return &v
+}
+
+// SaturationVaporPressure returns the saturation vapor pressure over water
+// (hPa) using the Magnus formula.
+func SaturationVaporPressure(tempF float64) float64 {
+	const b, c = 17.62, 243.12
+	t := units.Celsius.FromFahrenheit(tempF)
+	return 6.112 * math.Exp(b*t/(c+t))
+}
+
+// VaporPressure returns the partial pressure of water vapor (hPa).
+func VaporPressure(tempF float64, humidity float64) float64 {
+	return humidity / 100 * SaturationVaporPressure(tempF)
+}
+
+// AbsoluteHumidity returns the water vapor density (g/m³).
+func AbsoluteHumidity(tempF float64, humidity float64) float64 {
+	kelvin := units.Kelvin.FromFahrenheit(tempF)
+	return VaporPressure(tempF, humidity) * 100 / (gasConstantVapor * kelvin) * 1000
+}
+
+// Dewpoint returns the dewpoint (°F) using the Magnus formula.
+func Dewpoint(tempF float64, humidity float64) float64 {
+	const b, c = 17.62, 243.12
+	tempC := units.Celsius.FromFahrenheit(tempF)
+	gamma := math.Log(math.Max(humidity, 1)/100) + b*tempC/(c+tempC)
+	return c*gamma/(b-gamma)*9/5 + 32
+}
+
+// FrostPoint returns the temperature (°F) at which the air is saturated with
+// respect to ice, using the Magnus formula over ice.
+func FrostPoint(tempF float64, humidity float64) float64 {
+	const b, c = 22.46, 272.62
+	gamma := math.Log(math.Max(VaporPressure(tempF, humidity), 0.001) / 6.112)
+	return c*gamma/(b-gamma)*9/5 + 32
+}
+
+// Wetbulb returns the wetbulb (°F) using the Stull formula.
+func Wetbulb(tempF float64, humidity float64) float64 {
+	t := units.Celsius.FromFahrenheit(tempF)
+	rh := humidity
+	tw := t*math.Atan(0.151977*math.Sqrt(rh+8.313659)) + math.Atan(t+rh) -
+		math.Atan(rh-1.676331) + 0.00391838*math.Pow(rh, 1.5)*math.Atan(0.023101*rh) - 4.686035
+	return tw*9/5 + 32
+}
+
+// HeatIndex returns the heat index (°F) using the NWS Rothfusz regression.
+func HeatIndex(tempF float64, humidity float64) float64 {
+	simple := 0.5 * (tempF + 61 + (tempF-68)*1.2 + humidity*0.094)
+	if (simple+tempF)/2 < 80 {
+		return simple
+	}
+	t, rh := tempF, humidity
+	return -42.379 + 2.04901523*t + 10.14333127*rh - 0.22475541*t*rh -
+		0.00683783*t*t - 0.05481717*rh*rh + 0.00122874*t*t*rh +
+		0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+}
+
+// WindChill returns the wind chill (°F) using the NWS formula.
+func WindChill(tempF float64, windMPH float64) float64 {
+	if tempF > 50 || windMPH < 3 {
+		return tempF
+	}
+	v := math.Pow(windMPH, 0.16)
+	return 35.74 + 0.6215*tempF - 35.75*v + 0.4275*tempF*v
+}
+
+// Humidex returns the Canadian humidity index, which is comparable to a
+// temperature in °C.
+func Humidex(tempF float64, humidity float64) float64 {
+	t := units.Celsius.FromFahrenheit(tempF)
+	return t + 0.5555*(VaporPressure(tempF, humidity)-10)
+}
+
+// ApparentTemperature returns the Steadman apparent temperature (°F) in the
+// shade, as used by the Australian Bureau of Meteorology.
+func ApparentTemperature(tempF float64, humidity float64, windMPH float64) float64 {
+	t := units.Celsius.FromFahrenheit(tempF)
+	ws := units.MetresPerSecond.FromMilesPerHour(windMPH)
+	at := t + 0.33*VaporPressure(tempF, humidity) - 0.70*ws - 4.00
+	return at*9/5 + 32
+}
+
+// AirDensity returns the density of moist air (kg/m³) at the provided
+// barometer reading at current elevation (inches).
+func AirDensity(tempF float64, humidity float64, barometer float64) float64 {
+	kelvin := units.Kelvin.FromFahrenheit(tempF)
+	p := units.Hectopascals.FromInchesOfMercury(barometer) * 100
+	pv := VaporPressure(tempF, humidity) * 100
+	return (p-pv)/(gasConstantDry*kelvin) + pv/(gasConstantVapor*kelvin)
+}
+
+// DensityAltitude returns the altitude (ft) in the standard atmosphere with
+// the same air density, using the NWS formula with virtual temperature.
+func DensityAltitude(tempF float64, humidity float64, barometer float64) float64 {
+	p := units.Hectopascals.FromInchesOfMercury(barometer)
+	rankine := tempF + 459.67
+	virtual := rankine / (1 - 0.379*VaporPressure(tempF, humidity)/p)
+	return 145442.16 * (1 - math.Pow(17.326*barometer/virtual, 0.235))
+}
+
+// CloudBase returns the estimated base of cumulus clouds above ground (ft)
+// from the dewpoint spread.
+func CloudBase(tempF float64, humidity float64) float64 {
+	spread := tempF - Dewpoint(tempF, humidity)
+	return math.Max(spread, 0) / cloudBaseLapse * 1000
+}
+
+// Beaufort returns the Beaufort wind force number (0-12) of the average wind
+// speed (mph).
+func Beaufort(windMPH float64) int {
+	ws := units.MetresPerSecond.FromMilesPerHour(windMPH)
+	for i, limit := range beaufortLimits {
+		if ws < limit {
+			return i
+		}
+	}
+	return len(beaufortLimits)
+}
+
+// CompassPoint returns the 16 point compass direction (such as "NNE") of the
+// wind direction (°).
+func CompassPoint(dir float64) string {
+	i := int(math.Floor(math.Mod(dir+11.25, 360)/22.5)) % len(compassPoints)
+	if i < 0 {
+		i += len(compassPoints)
+	}
+	return compassPoints[i]
+}
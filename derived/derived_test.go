@@ -0,0 +1,103 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package derived
+
+import (
+	"math"
+	"testing"
+)
+
+// reference is a published value of a derived quantity.
+type reference struct {
+	a, b float64 // a and b are the inputs of the quantity
+	want float64 // want is the published value
+}
+
+// check compares the quantity with the published values, within the provided
+// tolerance.
+func check(t *testing.T, name string, fn func(float64, float64) float64, tolerance float64, refs []reference) {
+	t.Helper()
+	for _, ref := range refs {
+		if got := fn(ref.a, ref.b); math.Abs(got-ref.want) > tolerance {
+			t.Errorf("%s(%v, %v) = %v, want %v ±%v", name, ref.a, ref.b, got, ref.want, tolerance)
+		}
+	}
+}
+
+func TestDewpoint(t *testing.T) {
+	// NWS dewpoint calculator
+	check(t, "Dewpoint", Dewpoint, 0.2, []reference{
+		{77, 50, 56.9},
+		{32, 80, 26.5},
+		{86, 70, 75.0},
+	})
+}
+
+func TestWetbulb(t *testing.T) {
+	// Stull (2011), 20°C at 50% is 13.7°C
+	check(t, "Wetbulb", Wetbulb, 0.2, []reference{
+		{68, 50, 56.7},
+		{95, 30, 71.8},
+	})
+}
+
+func TestHeatIndex(t *testing.T) {
+	// NWS heat index chart, rounded to the degree
+	check(t, "HeatIndex", HeatIndex, 0.5, []reference{
+		{90, 50, 95},
+		{100, 40, 109},
+		{84, 80, 94},
+		// simple formula below 80°F
+		{70, 50, 69},
+	})
+}
+
+func TestWindChill(t *testing.T) {
+	// NWS wind chill chart, rounded to the degree
+	check(t, "WindChill", WindChill, 0.5, []reference{
+		{0, 15, -19},
+		{30, 10, 21},
+		{-20, 30, -53},
+		// undefined above 50°F or below 3 mph
+		{60, 20, 60},
+		{20, 2, 20},
+	})
+}
+
+func TestHumidex(t *testing.T) {
+	// Environment Canada humidex table, rounded to the degree
+	check(t, "Humidex", Humidex, 0.5, []reference{
+		{86, 50, 36},
+		{95, 60, 48},
+		{77, 40, 26},
+	})
+}
+
+func TestAirDensity(t *testing.T) {
+	at := func(barometer float64) func(float64, float64) float64 {
+		return func(tempF, humidity float64) float64 {
+			return AirDensity(tempF, humidity, barometer)
+		}
+	}
+	// ISA sea level density, and dry and moist air at 1013.25 hPa
+	check(t, "AirDensity", at(29.92), 0.001, []reference{
+		{59, 0, 1.225},
+		{32, 0, 1.292},
+		{86, 80, 1.150},
+	})
+	// ISA density at 5000 ft (24.90 inHg, 41.2°F)
+	check(t, "AirDensity", at(24.90), 0.001, []reference{
+		{41.2, 0, 1.056},
+	})
+}
+
+func TestCloudBase(t *testing.T) {
+	// 1000 ft per 4.4°F of dewpoint spread
+	check(t, "CloudBase", CloudBase, 10, []reference{
+		{77, 50, 4560},
+		{86, 70, 2480},
+		// saturated air is fog
+		{70, 100, 0},
+	})
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package derived
+
+import (
+	"math"
+	"time"
+
+	"github.com/tannerryan/davisweather/units"
+)
+
+const (
+	// solarConstant is the solar constant (MJ/(m²·min))
+	solarConstant = 0.0820
+	// stefanBoltzmannHourly is the Stefan-Boltzmann constant (MJ/(K⁴·m²·hour))
+	stefanBoltzmannHourly = 2.043e-10
+	// albedo is the albedo of the grass reference crop
+	albedo = 0.23
+	// defaultRadiationRatio is the relative shortwave radiation (Rs/Rso) used at
+	// night when no daytime ratio is known
+	defaultRadiationRatio = 0.8
+)
+
+// ETInputs are the conditions of the FAO-56 Penman-Monteith equation.
+type ETInputs struct {
+	Time        time.Time // Time is the time of the conditions
+	Temperature float64   // Temperature (°F)
+	Humidity    float64   // Humidity (%RH)
+	WindSpeed   float64   // WindSpeed is average wind speed (mph)
+	SolarRad    float64   // SolarRad is solar radiation (W/m²)
+	Barometer   float64   // Barometer is barometer reading at current elevation (inches), 0 estimates from Elevation
+
+	Latitude   float64 // Latitude is station latitude (°, north positive)
+	Longitude  float64 // Longitude is station longitude (°, east positive)
+	Elevation  float64 // Elevation is station elevation above sea level (m)
+	WindHeight float64 // WindHeight is anemometer height above ground (m), 0 for 2 m
+
+	RadiationRatio float64 // RadiationRatio is relative shortwave radiation (Rs/Rso) used at night, 0 for 0.8
+}
+
+// ReferenceET returns the hourly grass reference evapotranspiration ET0
+// (mm/hour) using the FAO-56 Penman-Monteith equation, and the relative
+// shortwave radiation (Rs/Rso) of the conditions. At night, the provided
+// RadiationRatio is used and returned; callers should provide the most recent
+// daytime ratio. Negative ET0 (condensation) is returned as 0.
+func ReferenceET(in ETInputs) (float64, float64) {
+	t := units.Celsius.FromFahrenheit(in.Temperature)
+	u2 := units.MetresPerSecond.FromMilesPerHour(in.WindSpeed)
+	if in.WindHeight > 0 && in.WindHeight != 2 {
+		u2 *= 4.87 / math.Log(67.8*in.WindHeight-5.42)
+	}
+	rs := in.SolarRad * 0.0036 // W/m² to MJ/(m²·hour)
+
+	// pressure and psychrometric constant (kPa)
+	p := units.Hectopascals.FromInchesOfMercury(in.Barometer) / 10
+	if in.Barometer <= 0 {
+		p = 101.3 * math.Pow((293-0.0065*in.Elevation)/293, 5.26)
+	}
+	gamma := 0.000665 * p
+
+	// vapor pressures (kPa) and slope of saturation vapor pressure curve
+	es := 0.6108 * math.Exp(17.27*t/(t+237.3))
+	ea := es * in.Humidity / 100
+	delta := 4098 * es / math.Pow(t+237.3, 2)
+
+	// net radiation (MJ/(m²·hour))
+	ra := extraterrestrialRadiation(in.Time, in.Latitude, in.Longitude)
+	ratio := in.RadiationRatio
+	if ratio <= 0 {
+		ratio = defaultRadiationRatio
+	}
+	daytime := ra > 0
+	if daytime {
+		rso := (0.75 + 2e-5*in.Elevation) * ra
+		if rso > 0 {
+			ratio = math.Max(0.25, math.Min(1, rs/rso))
+		}
+	}
+	rns := (1 - albedo) * rs
+	kelvin := t + 273.16
+	rnl := stefanBoltzmannHourly * math.Pow(kelvin, 4) * (0.34 - 0.14*math.Sqrt(ea)) * (1.35*ratio - 0.35)
+	rn := rns - rnl
+
+	// soil heat flux
+	g := 0.5 * rn
+	if daytime {
+		g = 0.1 * rn
+	}
+
+	et := (0.408*delta*(rn-g) + gamma*37/(t+273)*u2*(es-ea)) / (delta + gamma*(1+0.34*u2))
+	return math.Max(et, 0), ratio
+}
+
+// extraterrestrialRadiation returns the extraterrestrial radiation
+// (MJ/(m²·hour)) of the hour centred on the provided time.
+func extraterrestrialRadiation(at time.Time, latitude float64, longitude float64) float64 {
+	at = at.UTC()
+	j := float64(at.YearDay())
+	phi := latitude * math.Pi / 180
+
+	dr := 1 + 0.033*math.Cos(2*math.Pi*j/365)
+	decl := 0.409 * math.Sin(2*math.Pi*j/365-1.39)
+
+	// solar time angle at midpoint of period
+	b := 2 * math.Pi * (j - 81) / 364
+	sc := 0.1645*math.Sin(2*b) - 0.1255*math.Cos(b) - 0.025*math.Sin(b)
+	hours := float64(at.Hour()) + float64(at.Minute())/60 + float64(at.Second())/3600
+	omega := math.Pi / 12 * (hours + longitude/15 + sc - 12)
+	omega = math.Mod(omega+3*math.Pi, 2*math.Pi) - math.Pi
+
+	// sunset hour angle, limiting the period to daylight
+	ws := math.Acos(math.Max(-1, math.Min(1, -math.Tan(phi)*math.Tan(decl))))
+	omega1 := math.Max(omega-math.Pi/24, -ws)
+	omega2 := math.Min(omega+math.Pi/24, ws)
+	if omega1 >= omega2 {
+		return 0
+	}
+
+	return 12 * 60 / math.Pi * solarConstant * dr * ((omega2-omega1)*math.Sin(phi)*math.Sin(decl) +
+		math.Cos(phi)*math.Cos(decl)*(math.Sin(omega2)-math.Sin(omega1)))
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Change is a modified Report field.
+type Change struct {
+	Field string      `json:"field"` // Field is the JSON name of the modified field
+	Old   interface{} `json:"old"`   // Old is the previous value (nil if not provided)
+	New   interface{} `json:"new"`   // New is the current value (nil if not provided)
+}
+
+// reportField is an exported Report or Sensor field with a JSON name.
+type reportField struct {
+	name  string // name is the JSON name of the field
+	index int    // index is the struct field index
+}
+
+var (
+	// reportFields are the Report fields compared by Diff, in declaration order
+	reportFields = loadFields(reflect.TypeOf(Report{}))
+	// sensorFields are the Sensor fields, in declaration order
+	sensorFields = loadFields(reflect.TypeOf(Sensor{}))
+)
+
+// loadFields returns the exported fields of the Report or Sensor type with a
+// JSON name, excluding the Timestamp.
+func loadFields(t reflect.Type) []reportField {
+	var fields []reportField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || name == "timestamp" {
+			continue
+		}
+		fields = append(fields, reportField{name: name, index: i})
+	}
+	return fields
+}
+
+// Diff returns the fields that differ between the Report and the other
+// Report, in declaration order. The Old values are from the Report and the New
+// values are from the other Report. The Timestamp is not compared.
+func (r *Report) Diff(other *Report) []Change {
+	if r == other {
+		return nil
+	}
+	// each Report is locked separately to avoid lock ordering
+	return r.snapshot().diff(other.snapshot())
+}
+
+// snapshot returns a copy of the exported Report fields, locking the Report if
+// it has a mutex (Reports created by NewReport).
+func (r *Report) snapshot() *Report {
+	if r.mutex != nil {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+	}
+	snapshot := &Report{}
+	if buff, err := json.Marshal(r); err == nil {
+		json.Unmarshal(buff, snapshot)
+	}
+	return snapshot
+}
+
+// LastDiff returns the fields modified by the most recent update of the Report
+// state. It returns nil if the most recent update did not modify the Report.
+func (r *Report) LastDiff() []Change {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.lastDiff
+}
+
+// Values returns the provided numeric Report fields keyed by JSON name, in the
+// units of the Report. Fields that are not provided are omitted.
+func (r *Report) Values() map[string]float64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.values()
+}
+
+// values returns the provided numeric Report fields without locking the
+// Report.
+func (r *Report) values() map[string]float64 {
+	values := make(map[string]float64)
+	v := reflect.ValueOf(r).Elem()
+	for _, f := range reportFields {
+		field := v.Field(f.index)
+		if field.Type() != floatPtrType || field.IsNil() {
+			continue
+		}
+		values[f.name] = field.Elem().Float()
+	}
+	return values
+}
+
+// diff returns the fields that differ between the Report and the other Report
+// without locking either Report.
+func (r *Report) diff(other *Report) []Change {
+	var changes []Change
+	a := reflect.ValueOf(r).Elem()
+	b := reflect.ValueOf(other).Elem()
+	for _, f := range reportFields {
+		before := fieldValue(a.Field(f.index))
+		after := fieldValue(b.Field(f.index))
+		if equal(before, after) {
+			continue
+		}
+		changes = append(changes, Change{Field: f.name, Old: before, New: after})
+	}
+	return changes
+}
+
+// equal returns true if the field values are equal. Values that are not deeply
+// equal are compared by JSON representation, as times restored from JSON lose
+// their monotonic clock reading and location.
+func equal(a interface{}, b interface{}) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	x, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	y, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(x, y)
+}
+
+// fieldValue returns the value of a Report field, dereferencing pointers. It
+// returns nil for nil pointers and empty maps.
+func fieldValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return v.Elem().Interface()
+	case reflect.Map:
+		if v.Len() == 0 {
+			return nil
+		}
+	}
+	return v.Interface()
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/davisweather/parser"
+)
+
+// newTestReport returns a Report loaded from the JSON payload.
+func newTestReport(t *testing.T, payload string) *Report {
+	t.Helper()
+	r, _ := NewReport(false)
+	if err := r.UpdateJSON([]byte(payload)); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// updateUDP applies the UDP broadcast payload to the Report.
+func updateUDP(t *testing.T, r *Report, payload string) {
+	t.Helper()
+	var c parser.ConditionsUDP
+	if err := json.Unmarshal([]byte(payload), &c); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.UpdateUDP(&c); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// changed returns the field names of the changes.
+func changed(changes []Change) []string {
+	var fields []string
+	for _, c := range changes {
+		fields = append(fields, c.Field)
+	}
+	return fields
+}
+
+func TestDiff(t *testing.T) {
+	a := newTestReport(t, `{"temperature":70.1,"signal":"Synced","battery":"Nominal"}`)
+	b := newTestReport(t, `{"temperature":71.5,"signal":"Synced","battery":"Nominal"}`)
+
+	diff := a.Diff(b)
+	if len(diff) != 1 || diff[0].Field != "temperature" || diff[0].Old != 70.1 || diff[0].New != 71.5 {
+		t.Fatalf("Diff = %+v, want temperature 70.1 to 71.5", diff)
+	}
+	if diff := a.Diff(a); diff != nil {
+		t.Errorf("Diff of same Report = %+v, want nil", diff)
+	}
+
+	// zero value and unmarshalled Reports have no mutex
+	var unmarshalled Report
+	if err := json.Unmarshal(a.JSON(), &unmarshalled); err != nil {
+		t.Fatal(err)
+	}
+	if diff := unmarshalled.Diff(a); diff != nil {
+		t.Errorf("Diff of unmarshalled Report = %+v, want nil", diff)
+	}
+	if got := changed((&Report{}).Diff(a)); !reflect.DeepEqual(got, []string{"temperature", "signal", "battery"}) {
+		t.Errorf("Diff of zero Report = %v", got)
+	}
+}
+
+func TestDiffConcurrent(t *testing.T) {
+	a := newTestReport(t, `{"temperature":70.1,"signal":"Synced","battery":"Nominal"}`)
+	b := newTestReport(t, `{"temperature":71.5,"signal":"Synced","battery":"Nominal"}`)
+
+	done := make(chan bool)
+	go func() {
+		wg := &sync.WaitGroup{}
+		for i := 0; i < 100; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				a.Diff(b)
+			}()
+			go func() {
+				defer wg.Done()
+				b.Diff(a)
+			}()
+		}
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("concurrent Diff deadlocked")
+	}
+}
+
+func TestLastDiffTimes(t *testing.T) {
+	// parsed times are in the local time zone, previous state is from JSON
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Skip(err)
+	}
+	local := time.Local
+	time.Local = toronto
+	defer func() {
+		time.Local = local
+	}()
+
+	r := newTestReport(t, `{"signal":"Synced","battery":"Nominal"}`)
+	const broadcast = `{"did":"001D0A700002","ts":1592400000,"conditions":[{"lsid":1,"txid":1,
+		"wind_speed_last":%s,"wind_dir_last":180,"rain_size":1,"rain_storm":4,
+		"rain_storm_start_at":1592380000}]}`
+	updateUDP(t, r, fmt.Sprintf(broadcast, "5"))
+	updateUDP(t, r, fmt.Sprintf(broadcast, "6"))
+	if got := changed(r.LastDiff()); !reflect.DeepEqual(got, []string{"windSpeedLast", "sensors"}) {
+		t.Errorf("LastDiff = %v, want [windSpeedLast sensors]", got)
+	}
+	updateUDP(t, r, fmt.Sprintf(broadcast, "6"))
+	if diff := r.LastDiff(); diff != nil {
+		t.Errorf("LastDiff of unchanged update = %+v, want nil", diff)
+	}
+}
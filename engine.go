@@ -13,26 +13,33 @@ import (
 )
 
 const (
-	// engineIntervalHTTP is how often to poll for HTTP weather conditions
+	// engineIntervalHTTP is the default of how often to poll for HTTP weather
+	// conditions
 	engineIntervalHTTP = 10300 * time.Millisecond // 10.3 seconds
-	// engineIntervalWatchdog is how often to run the UDP watchdog
-	engineIntervalWatchdog = udpDeadline / 2.0
 
-	// httpTimeout is the HTTP client timeout
+	// httpTimeout is the default HTTP client timeout
 	httpTimeout = 3 * time.Second
+	// httpStartDelay is the default delay before the first HTTP poll
+	httpStartDelay = 5 * time.Second
 	// routeConditions is route for fetching weather conditions
 	routeConditions = "/v1/current_conditions"
 	// routeBroadcastResponse is route for fetching broadcast response
 	routeBroadcastResponse = "/v1/real_time"
 
-	// udpDeadline is UDP read deadline before sending broadcast response
+	// udpDeadline is the default UDP read deadline before sending broadcast
+	// response
 	udpDeadline = 15 * time.Second
-	// udpDuration is how long UDP broadcasts are enabled for
+	// udpDuration is the default of how long UDP broadcasts are enabled for
 	udpDuration = 4 * time.Hour
-	// udpBufferSize is buffer size for reading UDP messages
+	// udpBufferSize is the default buffer size for reading UDP messages
 	udpBufferSize = 2048
 )
 
+// watchdogInterval returns how often to run the UDP watchdog.
+func (c *Client) watchdogInterval() time.Duration {
+	return c.udpDeadline / 2.0
+}
+
 // engine starts the UDP and HTTP event loops after the mDNS autodiscovery is
 // completed. If the unit in Client is defined (unmanaged client), the engine
 // starts the UDP and HTTP loops without delay.
@@ -42,7 +49,7 @@ func (c *Client) engine(ctx context.Context, mDNS context.Context) {
 
 	// stall engine until mDNS has resolved
 	if c.unit == nil && mDNS != nil {
-		c.println("[davisweather] waiting for mDNS autodiscovery")
+		c.log(LevelInfo, "client", "waiting for mDNS autodiscovery")
 		<-mDNS.Done()
 	}
 	select {
@@ -51,7 +58,7 @@ func (c *Client) engine(ctx context.Context, mDNS context.Context) {
 		return
 	default:
 		// start HTTP and UDP event loops
-		c.println("[davisweather] initializing UDP and HTTP event loops")
+		c.log(LevelInfo, "client", "initializing UDP and HTTP event loops")
 		c.wg.Add(2)
 		go c.httpEventLoop(ctx)
 		go c.udpEventLoop(ctx)
@@ -69,31 +76,37 @@ func (c *Client) httpEventLoop(ctx context.Context) {
 	defer c.wg.Done()
 
 	// WLL does can't support concurrent HTTP, allow UDP to get first request
-	time.Sleep(5 * time.Second)
+	select {
+	case <-ctx.Done():
+		c.log(LevelInfo, "http", "terminating event loop")
+		return
+	case <-time.After(c.httpStartDelay):
+	}
 
 	// initialize event timer
-	eventTimer := time.NewTimer(engineIntervalHTTP)
+	eventTimer := time.NewTimer(c.httpInterval)
 	defer eventTimer.Stop()
-	c.println("[davisweather http] initializing, fetching weather conditions every", engineIntervalHTTP)
+	c.log(LevelInfo, "http", "initializing event loop", "interval", c.httpInterval)
 
 	for {
-		eventTimer.Reset(engineIntervalHTTP)
+		eventTimer.Reset(c.httpInterval)
 
 		// fetch latest conditions
 		conditions, err := c.fetchConditionsHTTP(ctx)
 		if err != nil {
-			c.println("[davisweather http] failed to fetch conditions", err)
+			c.log(LevelWarn, "http", "failed to fetch conditions", LogError, err)
 		} else {
 			// update Report state
 			err = c.report.UpdateHTTP(conditions)
 			if err != nil {
-				c.println("[davisweather http] failed to update Report", err)
+				c.log(LevelWarn, "http", "failed to update Report", LogMethod, parser.UpdateHTTP, LogError, err)
 			}
 		}
+		c.recordHTTP(err)
 		// terminate or sleep
 		select {
 		case <-ctx.Done():
-			c.println("[davisweather http] terminating event loop")
+			c.log(LevelInfo, "http", "terminating event loop")
 			eventTimer.Stop()
 			return
 		case <-eventTimer.C:
@@ -116,11 +129,11 @@ func (c *Client) udpEventLoop(ctx context.Context) {
 
 	for {
 		// check if UDP port provided
-		if c.udpPort == 0 {
+		if c.getUDPPort() == 0 {
 			// terminate or wait for UDP context to resolve
 			select {
 			case <-ctx.Done():
-				c.println("[davisweather udp] terminating event loop")
+				c.log(LevelInfo, "udp", "terminating event loop")
 				return
 			case <-udpCtx.Done():
 			}
@@ -128,31 +141,34 @@ func (c *Client) udpEventLoop(ctx context.Context) {
 		// terminate or wait error delay
 		select {
 		case <-ctx.Done():
-			c.println("[davisweather udp] terminating event loop")
+			c.log(LevelInfo, "udp", "terminating event loop")
 			return
-		case <-time.After(engineIntervalWatchdog):
+		case <-time.After(c.watchdogInterval()):
 		}
 
 		// generate connection address
-		connAddr, err := net.ResolveUDPAddr("udp", ":"+strconv.Itoa(c.udpPort))
+		port := c.getUDPPort()
+		connAddr, err := net.ResolveUDPAddr("udp", ":"+strconv.Itoa(port))
 		if err != nil {
-			c.println("[davisweather udp] failed to generate UDP address, retrying in", engineIntervalWatchdog)
+			c.log(LevelWarn, "udp", "failed to generate UDP address", "retry", c.watchdogInterval(), LogError, err)
+			c.recordUDP(err)
 			continue
 		}
 		// establish connection to UDP socket
 		conn, err := net.ListenUDP("udp", connAddr)
 		if err != nil {
-			c.println("[udp] failed to open UDP socket, trying again in", engineIntervalWatchdog)
+			c.log(LevelWarn, "udp", "failed to open UDP socket", "retry", c.watchdogInterval(), LogError, err)
+			c.recordUDP(err)
 			continue
 		}
 
 		// start connection watchdog
 		connCtx, connCancel := context.WithCancel(ctx)
 		go c.connWatchdog(connCtx, conn)
-		c.println("[davisweather udp] listening for weather broadcasts")
+		c.log(LevelInfo, "udp", "listening for weather broadcasts", "port", port)
 
 		// create internal buffer for reading UDP broadcasts
-		buff := make([]byte, udpBufferSize)
+		buff := make([]byte, c.udpBufferSize)
 		for {
 			select {
 			case <-ctx.Done():
@@ -163,33 +179,47 @@ func (c *Client) udpEventLoop(ctx context.Context) {
 			}
 
 			// configure timeouts
-			conn.SetReadDeadline(time.Now().Add(udpDeadline))
+			conn.SetReadDeadline(time.Now().Add(c.udpDeadline))
 
 			// read from UDP
-			n, _, err := conn.ReadFrom(buff)
+			n, addr, err := conn.ReadFrom(buff)
 			if err != nil {
-				c.println("[davisweather udp] failed to read from UDP socket, reprovisioning")
+				c.log(LevelWarn, "udp", "failed to read from UDP socket, reprovisioning", LogError, err)
+				c.recordUDP(err)
 				// terminate connection, establish new connection
 				connCancel()
 				break
 			}
+			c.record(parser.UpdateUDP, addr.String(), buff[:n])
 			// parse UDP broadcast message
 			conditions, err := parser.ParseUDP(buff[:n])
 			if err != nil {
-				c.println("[davisweather udp] failed to parse broadcast")
+				c.log(LevelWarn, "udp", "failed to parse broadcast", LogError, err)
+				c.recordUDP(err)
 				continue
 			}
 			// update Report state
 			err = c.report.UpdateUDP(conditions)
 			if err != nil {
-				c.println("[davisweather udp] failed to update Report", err)
+				c.log(LevelWarn, "udp", "failed to update Report", LogMethod, parser.UpdateUDP, LogError, err)
+				c.recordUDP(err)
 				continue
 			}
+			c.udpMutex.Lock()
 			c.udpLastReported = time.Now()
+			c.udpMutex.Unlock()
+			c.recordUDP(nil)
 		}
 	}
 }
 
+// getUDPPort returns the port of the UDP broadcasts, or 0 if not obtained.
+func (c *Client) getUDPPort() int {
+	c.udpMutex.Lock()
+	defer c.udpMutex.Unlock()
+	return c.udpPort
+}
+
 // connWatchdog listens for the context Done signal and terminates the UDP
 // connection.
 func (c *Client) connWatchdog(ctx context.Context, conn *net.UDPConn) {
@@ -205,36 +235,45 @@ func (c *Client) connWatchdog(ctx context.Context, conn *net.UDPConn) {
 // port is obtained. It calls the resolved cancel function when the UDP port is
 // established.
 func (c *Client) udpWatchdog(ctx context.Context, resolved context.CancelFunc) {
-	eventTimer := time.NewTimer(engineIntervalWatchdog)
+	eventTimer := time.NewTimer(c.watchdogInterval())
 	defer eventTimer.Stop()
 
-	c.println("[davisweather udp] initializing watchdog")
+	c.log(LevelInfo, "udp", "initializing watchdog")
 
 	for {
-		eventTimer.Reset(engineIntervalWatchdog)
+		eventTimer.Reset(c.watchdogInterval())
 
 		// calculate age of last UDP broadcast
+		c.udpMutex.Lock()
 		delta := time.Now().Sub(c.udpLastReported)
-		if delta > udpDeadline {
+		c.udpMutex.Unlock()
+		if delta > c.udpDeadline {
 			// exceeded UDP deadline, must fetch broadcast response
 			broadcast, err := c.fetchBroadcastResponse(ctx)
 			if err != nil {
-				c.println("[davisweather udp] failed to enable UDP broadcasts", err)
+				c.log(LevelWarn, "udp", "failed to enable UDP broadcasts", LogError, err)
+				c.recordUDP(err)
 			} else {
 				// received port, update port in Client and notify resolved port
+				port := broadcast.ConnInfo.Port
+				c.udpMutex.Lock()
 				previousPort := c.udpPort
-				c.udpPort = broadcast.ConnInfo.Port
+				c.udpPort = port
+				c.udpMutex.Unlock()
 				if previousPort == 0 {
 					resolved()
 				}
 				delta = time.Duration(broadcast.ConnInfo.Duration) * time.Second
-				c.println("[davisweather udp] enabled UDP broadcasts for", delta)
+				c.recordBroadcast(port, delta)
+				c.log(LevelInfo, "udp", "enabled UDP broadcasts", "port", port, "duration", delta)
 			}
 		}
+		// detect stalled event loops
+		c.checkHealth()
 		// terminate or sleep
 		select {
 		case <-ctx.Done():
-			c.println("[davisweather udp] terminating watchdog")
+			c.log(LevelInfo, "udp", "terminating watchdog")
 			return
 		case <-eventTimer.C:
 		}
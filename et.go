@@ -0,0 +1,116 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"time"
+
+	"github.com/tannerryan/davisweather/derived"
+	"github.com/tannerryan/davisweather/units"
+)
+
+const (
+	// etMaxGap is the longest interval between updates accumulated into ET0
+	etMaxGap = 15 * time.Minute
+	// etDateLayout is the layout of the ET0 accumulation date
+	etDateLayout = "2006-01-02"
+)
+
+// Evapotranspiration is the FAO-56 Penman-Monteith grass reference
+// evapotranspiration (ET0) of the station.
+type Evapotranspiration struct {
+	Hourly   float64 `json:"hourly"`   // Hourly is ET0 rate of the current conditions (mm/hour)
+	Daily    float64 `json:"daily"`    // Daily is ET0 accumulated since local midnight (mm)
+	Previous float64 `json:"previous"` // Previous is ET0 accumulated over the previous local day (mm)
+	Date     string  `json:"date"`     // Date is the local date of the Daily accumulation (YYYY-MM-DD)
+}
+
+// etState is the ET0 accumulation state of a Report.
+type etState struct {
+	daily    float64   // daily is the unrounded ET0 since local midnight (mm)
+	previous float64   // previous is the unrounded ET0 of the previous day (mm)
+	rate     float64   // rate is the most recent ET0 rate (mm/hour)
+	ratio    float64   // ratio is the most recent daytime Rs/Rso
+	last     time.Time // last is the time of the most recent rate
+	date     string    // date is the local date of the daily accumulation
+}
+
+// processET accumulates the reference evapotranspiration at the provided time
+// and synchronizes the ET0 field. Intervals longer than etMaxGap, such as
+// outages, are not accumulated.
+func (r *Report) processET(now time.Time) {
+	if r.et == nil {
+		return
+	}
+	s := r.et
+	date := now.In(r.station.location()).Format(etDateLayout)
+
+	// resume the accumulation of a restored Report (see UpdateJSON)
+	s.resume(r.ET0, now, r.station.location())
+
+	// accumulate previous rate over the interval
+	if !s.last.IsZero() {
+		if dt := now.Sub(s.last); dt > 0 && dt <= etMaxGap {
+			s.daily += s.rate * dt.Hours()
+		}
+	}
+	// reset at local midnight
+	if s.date != date {
+		if s.date != "" {
+			s.previous = s.daily
+		}
+		s.daily = 0
+		s.date = date
+	}
+
+	if r.Temperature == nil || r.Humidity == nil || r.WindSpeedAvgLast10Min == nil || r.SolarRad == nil {
+		s.last = time.Time{}
+	} else if now.After(s.last) {
+		in := derived.ETInputs{
+			Time:           now,
+			Temperature:    *r.Temperature,
+			Humidity:       *r.Humidity,
+			WindSpeed:      *r.WindSpeedAvgLast10Min,
+			SolarRad:       *r.SolarRad,
+			Latitude:       r.station.Latitude,
+			Longitude:      r.station.Longitude,
+			Elevation:      r.station.Elevation,
+			WindHeight:     r.station.WindHeight,
+			RadiationRatio: s.ratio,
+		}
+		if r.BarometerAbsolute != nil {
+			in.Barometer = *r.BarometerAbsolute
+		}
+		s.rate, s.ratio = derived.ReferenceET(in)
+		s.last = now
+	}
+
+	r.ET0 = &Evapotranspiration{
+		Hourly:   units.Round(s.rate, 3),
+		Daily:    units.Round(s.daily, 2),
+		Previous: units.Round(s.previous, 2),
+		Date:     s.date,
+	}
+}
+
+// resume seeds an empty accumulation state with a restored accumulation of the
+// current or previous local day, so that a restart does not reset the daily
+// ET0. Older accumulations are ignored.
+func (s *etState) resume(et *Evapotranspiration, now time.Time, loc *time.Location) {
+	if s.date != "" || et == nil {
+		return
+	}
+	local := now.In(loc)
+	date := local.Format(etDateLayout)
+	switch et.Date {
+	case date:
+		s.daily = et.Daily
+		s.previous = et.Previous
+	case local.AddDate(0, 0, -1).Format(etDateLayout):
+		s.previous = et.Daily
+	default:
+		return
+	}
+	s.date = date
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/davisweather/archive"
+)
+
+func TestETResume(t *testing.T) {
+	// conditions at 2020-06-17 13:20 UTC
+	for _, test := range []struct {
+		date     string
+		daily    float64
+		previous float64
+	}{
+		{"2020-06-17", 1.5, 2},
+		{"2020-06-16", 0, 1.5},
+		{"2020-06-10", 0, 0},
+	} {
+		r, _ := NewReport(false)
+		r.SetStation(Station{Latitude: 44.65, Longitude: -63.57, Location: time.UTC})
+		if err := r.UpdateJSON([]byte(`{"signal":"Synced","battery":"Nominal",
+			"et0":{"hourly":0.4,"daily":1.5,"previous":2,"date":"` + test.date + `"}}`)); err != nil {
+			t.Fatal(err)
+		}
+		updateHTTP(t, r, conditionsISS(1592400000, 1, "70", "50"))
+		if r.ET0 == nil || r.ET0.Date != "2020-06-17" || r.ET0.Daily != test.daily || r.ET0.Previous != test.previous {
+			t.Errorf("restored %s: ET0 = %+v, want daily %v previous %v", test.date, r.ET0, test.daily, test.previous)
+		}
+	}
+}
+
+func TestETRestoreArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "davisweather")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := archive.Open(dir, archive.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	now := time.Date(2020, 6, 17, 13, 20, 0, 0, time.UTC)
+	payload := []byte(`{"et0":{"hourly":0.4,"daily":1.25,"previous":3,"date":"2020-06-17"}}`)
+	if err := store.Append(now.Add(-10*time.Minute), encode(payload)); err != nil {
+		t.Fatal(err)
+	}
+
+	r, _ := NewReport(false)
+	r.SetStation(Station{Latitude: 44.65, Longitude: -63.57, Location: time.UTC})
+	r.archive = store
+	r.archiveZlib = true
+	r.restoreET(now)
+	if r.et.date != "2020-06-17" || r.et.daily != 1.25 || r.et.previous != 3 {
+		t.Errorf("ET0 state = %+v, want daily 1.25 previous 3", r.et)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tannerryan/davisweather/parser"
+)
+
+// DropPolicy indicates how a subscription behaves when its buffer is full.
+type DropPolicy int
+
+const (
+	// DropNewest discards the new Event when the buffer is full
+	DropNewest DropPolicy = 0
+	// DropOldest discards the oldest buffered Event when the buffer is full
+	DropOldest DropPolicy = 1
+)
+
+const (
+	// subscribeDefaultBuffer is the default subscription buffer size
+	subscribeDefaultBuffer = 1
+)
+
+// SubscribeOptions configures an Event subscription.
+type SubscribeOptions struct {
+	Buffer int        // Buffer is the subscription channel capacity (default 1)
+	Policy DropPolicy // Policy is the behaviour when the buffer is full
+}
+
+// Event is emitted to subscribers when the Report state is modified.
+type Event struct {
+	Report    *Report             // Report is a snapshot of the modified Report state
+	Method    parser.UpdateMethod // Method is how the Report state was modified
+	Changed   []string            // Changed are the JSON names of the modified Report fields
+	Diff      []Change            // Diff are the modified Report fields with previous and current values
+	Timestamp time.Time           // Timestamp is the device timestamp of the modification
+}
+
+// subscription is a single Event subscriber.
+type subscription struct {
+	events chan Event // events is the subscriber channel
+	policy DropPolicy // policy is the behaviour when events is full
+}
+
+// broker distributes Events to all subscriptions.
+type broker struct {
+	subscriptions map[*subscription]struct{} // subscriptions are the active subscribers
+	mutex         *sync.Mutex                // mutex is for atomic broker actions
+}
+
+// newBroker returns a broker with no subscriptions.
+func newBroker() *broker {
+	return &broker{
+		subscriptions: make(map[*subscription]struct{}),
+		mutex:         &sync.Mutex{},
+	}
+}
+
+// Subscribe returns a channel of Events emitted each time the Report state is
+// modified. Each subscriber receives an independent channel, buffered and
+// drained according to the provided options. The channel is closed when the
+// context is cancelled.
+func (c *Client) Subscribe(ctx context.Context, opts SubscribeOptions) <-chan Event {
+	return c.report.broker.subscribe(ctx, opts)
+}
+
+// subscribe registers a new subscription until the context is cancelled.
+func (b *broker) subscribe(ctx context.Context, opts SubscribeOptions) <-chan Event {
+	if opts.Buffer <= 0 {
+		opts.Buffer = subscribeDefaultBuffer
+	}
+	s := &subscription{
+		events: make(chan Event, opts.Buffer),
+		policy: opts.Policy,
+	}
+
+	b.mutex.Lock()
+	b.subscriptions[s] = struct{}{}
+	b.mutex.Unlock()
+
+	// remove subscription when context is cancelled
+	go func() {
+		<-ctx.Done()
+		b.mutex.Lock()
+		delete(b.subscriptions, s)
+		close(s.events)
+		b.mutex.Unlock()
+	}()
+	return s.events
+}
+
+// active returns true if the broker has at least one subscription.
+func (b *broker) active() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.subscriptions) > 0
+}
+
+// publish emits an Event to every subscription without blocking. The generate
+// function is called for each subscription so every subscriber receives an
+// independent Report snapshot.
+func (b *broker) publish(generate func() Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for s := range b.subscriptions {
+		e := generate()
+		select {
+		case s.events <- e:
+			continue
+		default:
+		}
+		if s.policy != DropOldest {
+			continue
+		}
+		// discard oldest buffered event and retry
+		select {
+		case <-s.events:
+		default:
+		}
+		select {
+		case s.events <- e:
+		default:
+		}
+	}
+}
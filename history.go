@@ -0,0 +1,39 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"errors"
+	"time"
+
+	"github.com/tannerryan/davisweather/history"
+)
+
+var (
+	// ErrHistoryDisabled is returned when querying history of a Client without
+	// WithHistory
+	ErrHistoryDisabled = errors.New("davisweather: history not enabled")
+)
+
+// WithHistory records the numeric Report fields of every modification of the
+// Report state in a bounded in-memory history, see Client.History.
+func WithHistory(opts history.Options) Option {
+	return func(c *Client) {
+		c.report.mutex.Lock()
+		defer c.report.mutex.Unlock()
+		c.report.history = history.New(opts)
+	}
+}
+
+// History returns the values of the numeric Report field (by JSON name)
+// between from and to, aggregated into steps. Values are kept at full
+// resolution for the most recent hour and downsampled to 1 minute and 10
+// minute buckets afterwards. It returns ErrHistoryDisabled if the Client was
+// not created with WithHistory, or an error if the aggregation is unknown.
+func (c *Client) History(field string, from time.Time, to time.Time, step time.Duration, agg history.Aggregation) ([]history.Point, error) {
+	if c.report.history == nil {
+		return nil, ErrHistoryDisabled
+	}
+	return c.report.history.Query(field, from, to, step, agg)
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+// Package history is a bounded in-memory time-series store of numeric fields.
+// Samples are kept at full resolution for a short window, then downsampled to
+// 1 minute and 10 minute buckets for longer retention.
+package history
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultRaw is the default full resolution retention
+	defaultRaw = time.Hour
+	// defaultMinute is the default 1 minute bucket retention
+	defaultMinute = 24 * time.Hour
+	// defaultTenMinute is the default 10 minute bucket retention
+	defaultTenMinute = 7 * 24 * time.Hour
+)
+
+var (
+	// ErrUnknownAggregation is returned when querying with an unknown
+	// Aggregation
+	ErrUnknownAggregation = errors.New("history: unknown aggregation")
+)
+
+// Aggregation is how samples within a step are combined.
+type Aggregation string
+
+const (
+	// Min is the lowest value of the step
+	Min Aggregation = "min"
+	// Max is the highest value of the step
+	Max Aggregation = "max"
+	// Avg is the mean value of the step
+	Avg Aggregation = "avg"
+	// Last is the most recent value of the step
+	Last Aggregation = "last"
+)
+
+// Point is an aggregated value.
+type Point struct {
+	Time  time.Time `json:"time"`  // Time is the start of the step
+	Value float64   `json:"value"` // Value is the aggregated value
+}
+
+// Options configures the retention of a Store. Zero durations use the
+// defaults.
+type Options struct {
+	Raw       time.Duration // Raw is the full resolution retention (default 1 hour)
+	Minute    time.Duration // Minute is the 1 minute bucket retention (default 24 hours)
+	TenMinute time.Duration // TenMinute is the 10 minute bucket retention (default 7 days)
+}
+
+// Store is a bounded in-memory history of numeric fields.
+type Store struct {
+	opts   Options            // opts are the retention durations
+	series map[string]*series // series are the samples of each field
+	mutex  *sync.Mutex        // mutex is for atomic store actions
+}
+
+// series is the history of a single field, split into tiers of decreasing
+// resolution. Tiers do not overlap: samples move to the next tier as they
+// age.
+type series struct {
+	raw       []bucket // raw are the full resolution samples
+	minute    []bucket // minute are the 1 minute buckets
+	tenMinute []bucket // tenMinute are the 10 minute buckets
+}
+
+// bucket is an aggregate of samples starting at a time.
+type bucket struct {
+	start time.Time // start is the start of the bucket (sample time for raw)
+	min   float64   // min is the lowest value
+	max   float64   // max is the highest value
+	sum   float64   // sum is the sum of values
+	count int       // count is the number of values
+	last  float64   // last is the most recent value
+}
+
+// New returns an empty Store with the provided retention.
+func New(opts Options) *Store {
+	if opts.Raw <= 0 {
+		opts.Raw = defaultRaw
+	}
+	if opts.Minute <= 0 {
+		opts.Minute = defaultMinute
+	}
+	if opts.TenMinute <= 0 {
+		opts.TenMinute = defaultTenMinute
+	}
+	return &Store{
+		opts:   opts,
+		series: make(map[string]*series),
+		mutex:  &sync.Mutex{},
+	}
+}
+
+// Add records the values observed at the provided time, keyed by field name.
+// Values older than the most recent sample of their field are ignored. Every
+// field is aged relative to the provided time, including fields that are no
+// longer reported, which are removed once expired.
+func (s *Store) Add(at time.Time, values map[string]float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for name, v := range values {
+		ser, ok := s.series[name]
+		if !ok {
+			ser = &series{}
+			s.series[name] = ser
+		}
+		if n := len(ser.raw); n > 0 && at.Before(ser.raw[n-1].start) {
+			continue
+		}
+		ser.raw = append(ser.raw, bucket{start: at, min: v, max: v, sum: v, count: 1, last: v})
+	}
+	for name, ser := range s.series {
+		ser.age(at, s.opts)
+		if ser.empty() {
+			delete(s.series, name)
+		}
+	}
+}
+
+// Fields returns the names of the recorded fields, sorted.
+func (s *Store) Fields() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	names := make([]string, 0, len(s.series))
+	for name := range s.series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Query returns the values of the field between from (inclusive) and to
+// (exclusive), aggregated into steps starting at from. Steps without samples
+// are omitted. A non-positive step returns every sample or bucket at its
+// stored resolution. It returns ErrUnknownAggregation if the aggregation is
+// not supported.
+func (s *Store) Query(field string, from time.Time, to time.Time, step time.Duration, agg Aggregation) ([]Point, error) {
+	switch agg {
+	case Min, Max, Avg, Last:
+	default:
+		return nil, ErrUnknownAggregation
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ser, ok := s.series[field]
+	if !ok {
+		return nil, nil
+	}
+
+	var points []Point
+	var current bucket
+	var currentStart time.Time
+	flush := func() {
+		if current.count > 0 {
+			points = append(points, Point{Time: currentStart, Value: current.value(agg)})
+		}
+		current = bucket{}
+	}
+	// tiers are ordered oldest to newest
+	for _, tier := range [][]bucket{ser.tenMinute, ser.minute, ser.raw} {
+		for _, b := range tier {
+			if b.start.Before(from) || !b.start.Before(to) {
+				continue
+			}
+			begin := b.start
+			if step > 0 {
+				begin = from.Add(b.start.Sub(from) / step * step)
+			}
+			if !begin.Equal(currentStart) || step <= 0 {
+				flush()
+				currentStart = begin
+			}
+			current.merge(b)
+		}
+	}
+	flush()
+	return points, nil
+}
+
+// age moves samples older than their tier retention into the next tier,
+// relative to the provided time, and drops expired buckets.
+func (ser *series) age(now time.Time, opts Options) {
+	var expired []bucket
+	ser.raw, expired = split(ser.raw, now.Add(-opts.Raw))
+	for _, b := range expired {
+		ser.minute = fold(ser.minute, b, time.Minute)
+	}
+	ser.minute, expired = split(ser.minute, now.Add(-opts.Minute))
+	for _, b := range expired {
+		ser.tenMinute = fold(ser.tenMinute, b, 10*time.Minute)
+	}
+	ser.tenMinute, _ = split(ser.tenMinute, now.Add(-opts.TenMinute))
+}
+
+// empty returns true if the series has no samples or buckets.
+func (ser *series) empty() bool {
+	return len(ser.raw) == 0 && len(ser.minute) == 0 && len(ser.tenMinute) == 0
+}
+
+// split returns the buckets starting at or after the cutoff and the buckets
+// before it.
+func split(buckets []bucket, cutoff time.Time) ([]bucket, []bucket) {
+	i := sort.Search(len(buckets), func(i int) bool {
+		return !buckets[i].start.Before(cutoff)
+	})
+	if i == 0 {
+		return buckets, nil
+	}
+	expired := append([]bucket(nil), buckets[:i]...)
+	return append(buckets[:0], buckets[i:]...), expired
+}
+
+// fold merges the bucket into the tier bucket of the provided resolution,
+// appending a new tier bucket if required.
+func fold(tier []bucket, b bucket, resolution time.Duration) []bucket {
+	start := b.start.Truncate(resolution)
+	if n := len(tier); n > 0 && tier[n-1].start.Equal(start) {
+		tier[n-1].merge(b)
+		return tier
+	}
+	b.start = start
+	return append(tier, b)
+}
+
+// merge combines the other bucket into the bucket. The other bucket must not
+// be older than the bucket.
+func (b *bucket) merge(other bucket) {
+	if b.count == 0 {
+		start := b.start
+		*b = other
+		b.start = start
+		return
+	}
+	b.min = math.Min(b.min, other.min)
+	b.max = math.Max(b.max, other.max)
+	b.sum += other.sum
+	b.count += other.count
+	b.last = other.last
+}
+
+// value returns the aggregated value of the bucket.
+func (b bucket) value(agg Aggregation) float64 {
+	switch agg {
+	case Min:
+		return b.min
+	case Max:
+		return b.max
+	case Avg:
+		return b.sum / float64(b.count)
+	}
+	return b.last
+}
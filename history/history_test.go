@@ -0,0 +1,60 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package history
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQuery(t *testing.T) {
+	s := New(Options{Raw: time.Minute})
+	start := time.Date(2020, 6, 17, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		s.Add(start.Add(time.Duration(i)*10*time.Second), map[string]float64{"temperature": float64(i)})
+	}
+
+	// samples older than a minute are downsampled to 1 minute buckets
+	points, err := s.Query("temperature", start, start.Add(time.Hour), 0, Avg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Point{
+		{Time: start, Value: 1},
+		{Time: start.Add(30 * time.Second), Value: 3},
+		{Time: start.Add(40 * time.Second), Value: 4},
+		{Time: start.Add(50 * time.Second), Value: 5},
+		{Time: start.Add(60 * time.Second), Value: 6},
+		{Time: start.Add(70 * time.Second), Value: 7},
+		{Time: start.Add(80 * time.Second), Value: 8},
+		{Time: start.Add(90 * time.Second), Value: 9},
+	}
+	if !reflect.DeepEqual(points, want) {
+		t.Errorf("Query = %v, want %v", points, want)
+	}
+
+	points, _ = s.Query("temperature", start, start.Add(time.Hour), time.Minute, Max)
+	want = []Point{{Time: start, Value: 5}, {Time: start.Add(time.Minute), Value: 9}}
+	if !reflect.DeepEqual(points, want) {
+		t.Errorf("Query by minute = %v, want %v", points, want)
+	}
+	if _, err := s.Query("temperature", start, start, 0, "median"); err != ErrUnknownAggregation {
+		t.Errorf("Query error = %v, want ErrUnknownAggregation", err)
+	}
+}
+
+func TestRetentionOfMissingFields(t *testing.T) {
+	s := New(Options{Raw: time.Minute, Minute: time.Hour, TenMinute: 2 * time.Hour})
+	start := time.Date(2020, 6, 17, 12, 0, 0, 0, time.UTC)
+	s.Add(start, map[string]float64{"temperature": 70, "soilMoisture1": 20})
+
+	// soil moisture stops reporting
+	for i := 1; i <= 200; i++ {
+		s.Add(start.Add(time.Duration(i)*time.Minute), map[string]float64{"temperature": 70})
+	}
+	if fields := s.Fields(); !reflect.DeepEqual(fields, []string{"temperature"}) {
+		t.Errorf("Fields = %v, want expired soilMoisture1 removed", fields)
+	}
+}
@@ -14,7 +14,7 @@ import (
 )
 
 var (
-	// httpClient is an HTTP client with keep alives disabled
+	// httpClient is the default HTTP client with keep alives disabled
 	httpClient = &http.Client{
 		Transport: &http.Transport{
 			DisableKeepAlives: true,
@@ -27,7 +27,7 @@ var (
 func (c *Client) fetchConditionsHTTP(ctx context.Context) (*parser.ConditionsHTTP, error) {
 	url := fmt.Sprintf("%s%s", c.unit.GetURL(), routeConditions)
 	// prepare request context
-	ctx, cancel := context.WithTimeout(ctx, httpTimeout)
+	ctx, cancel := context.WithTimeout(ctx, c.httpTimeout)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
@@ -35,7 +35,7 @@ func (c *Client) fetchConditionsHTTP(ctx context.Context) (*parser.ConditionsHTT
 		return nil, err
 	}
 	// perform request
-	resp, err := httpClient.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -45,6 +45,7 @@ func (c *Client) fetchConditionsHTTP(ctx context.Context) (*parser.ConditionsHTT
 	if err != nil {
 		return nil, err
 	}
+	c.record(parser.UpdateHTTP, url, body)
 	// parse body
 	conditions, err := parser.ParseHTTP(body)
 	if err != nil {
@@ -61,9 +62,9 @@ func (c *Client) fetchConditionsHTTP(ctx context.Context) (*parser.ConditionsHTT
 // correctly, or if the request fails.
 func (c *Client) fetchBroadcastResponse(ctx context.Context) (*parser.BroadcastResponse, error) {
 	url := fmt.Sprintf("%s%s?duration=%.0f",
-		c.unit.GetURL(), routeBroadcastResponse, udpDuration.Seconds())
+		c.unit.GetURL(), routeBroadcastResponse, c.udpDuration.Seconds())
 	// prepare request context
-	ctx, cancel := context.WithTimeout(ctx, httpTimeout)
+	ctx, cancel := context.WithTimeout(ctx, c.httpTimeout)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
@@ -71,7 +72,7 @@ func (c *Client) fetchBroadcastResponse(ctx context.Context) (*parser.BroadcastR
 		return nil, err
 	}
 	// perform request
-	resp, err := httpClient.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
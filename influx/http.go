@@ -0,0 +1,344 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package influx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tannerryan/davisweather"
+)
+
+const (
+	// writePath is the path of the InfluxDB write endpoint
+	writePath = "/api/v2/write"
+	// defaultBatchSize is the default number of lines per batch
+	defaultBatchSize = 1000
+	// defaultRetries is the default number of retries of a failed write
+	defaultRetries = 3
+	// defaultBackoff is the default delay before the first retry
+	defaultBackoff = time.Second
+	// defaultTimeout is the default timeout of each write request
+	defaultTimeout = 10 * time.Second
+	// defaultBufferSize is the default largest buffer of undelivered lines (16 MiB)
+	defaultBufferSize = 16 << 20
+	// maxRequestSize is the largest uncompressed request body of buffered lines (1 MiB)
+	maxRequestSize = 1 << 20
+)
+
+var (
+	// ErrURLMissing is returned when the URL or bucket is not provided
+	ErrURLMissing = errors.New("influx: URL and bucket not provided")
+	// ErrRejected is returned when InfluxDB rejects the lines as malformed,
+	// unprocessable or too large, and the lines are discarded
+	ErrRejected = errors.New("influx: lines rejected")
+	// ErrUnavailable is returned when InfluxDB is unavailable or rate limiting,
+	// and the lines are buffered
+	ErrUnavailable = errors.New("influx: server unavailable")
+	// ErrRefused is returned when InfluxDB refuses the write, such as for an
+	// invalid token or a missing bucket, and the lines are buffered
+	ErrRefused = errors.New("influx: write refused")
+)
+
+// HTTPOptions configures an HTTPWriter.
+type HTTPOptions struct {
+	URL    string // URL is the base URL of InfluxDB, such as "http://localhost:8086"
+	Org    string // Org is the organization name
+	Bucket string // Bucket is the destination bucket
+	Token  string // Token is the API token (optional)
+
+	BatchSize  int           // BatchSize is the number of lines that triggers a flush (default 1000)
+	Retries    int           // Retries is the number of retries of a failed write (default 3, negative disables)
+	Backoff    time.Duration // Backoff is the delay before the first retry, doubled for each retry (default 1 second)
+	Timeout    time.Duration // Timeout is the timeout of each write request (default 10 seconds)
+	BufferPath string        // BufferPath is the file buffering undelivered lines (default in memory)
+	BufferSize int64         // BufferSize is the largest buffer of undelivered lines, oldest discarded first (default 16 MiB)
+
+	Logger davisweather.Logger // Logger receives write failures (default discards)
+}
+
+// HTTPWriter is a Sink writing batches of gzip compressed lines to the
+// InfluxDB /api/v2/write endpoint. Lines that cannot be delivered are kept in
+// a bounded buffer and delivered first once InfluxDB is available.
+type HTTPWriter struct {
+	opts     HTTPOptions  // opts are the HTTPWriter options
+	endpoint string       // endpoint is the write URL
+	client   *http.Client // client is the HTTP client
+	buffer   *buffer      // buffer holds undelivered lines
+
+	batch    []byte      // batch are the lines pending delivery
+	lines    int         // lines is the number of lines in batch
+	mutex    *sync.Mutex // mutex is for atomic batch actions
+	flushing *sync.Mutex // flushing serializes deliveries
+}
+
+// NewHTTPWriter returns an HTTPWriter with the provided options. It returns an
+// error if the URL or bucket is not provided, or the URL is invalid.
+func NewHTTPWriter(opts HTTPOptions) (*HTTPWriter, error) {
+	if opts.URL == "" || opts.Bucket == "" {
+		return nil, ErrURLMissing
+	}
+	base, err := url.Parse(strings.TrimSuffix(opts.URL, "/") + writePath)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	query.Set("bucket", opts.Bucket)
+	query.Set("precision", "ns")
+	if opts.Org != "" {
+		query.Set("org", opts.Org)
+	}
+	base.RawQuery = query.Encode()
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.Retries == 0 {
+		opts.Retries = defaultRetries
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = defaultBackoff
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaultBufferSize
+	}
+	if opts.Logger == nil {
+		opts.Logger = davisweather.NopLogger()
+	}
+	return &HTTPWriter{
+		opts:     opts,
+		endpoint: base.String(),
+		client:   &http.Client{Timeout: opts.Timeout},
+		buffer:   &buffer{path: opts.BufferPath, max: opts.BufferSize},
+		mutex:    &sync.Mutex{},
+		flushing: &sync.Mutex{},
+	}, nil
+}
+
+// Write adds the lines to the pending batch, flushing the batch once it
+// reaches the BatchSize. It returns the error of the flush.
+func (w *HTTPWriter) Write(lines []byte) error {
+	w.mutex.Lock()
+	w.batch = append(w.batch, lines...)
+	w.lines += bytes.Count(lines, []byte{'\n'})
+	full := w.lines >= w.opts.BatchSize
+	w.mutex.Unlock()
+
+	if !full {
+		return nil
+	}
+	return w.Flush(context.Background())
+}
+
+// Flush delivers the buffered lines, then the pending batch. Lines that
+// cannot be delivered are buffered, and lines rejected by InfluxDB as
+// malformed, unprocessable or too large are discarded. It returns an error if
+// any lines were not delivered.
+func (w *HTTPWriter) Flush(ctx context.Context) error {
+	w.flushing.Lock()
+	defer w.flushing.Unlock()
+
+	w.mutex.Lock()
+	batch := w.batch
+	w.batch = nil
+	w.lines = 0
+	w.mutex.Unlock()
+
+	buffered, err := w.buffer.load()
+	if err != nil {
+		w.log("failed to read buffer", err)
+	}
+	// buffered lines are delivered first to preserve order
+	for len(buffered) > 0 {
+		chunk := buffered
+		if len(chunk) > maxRequestSize {
+			end := bytes.LastIndexByte(chunk[:maxRequestSize], '\n')
+			if end < 0 {
+				end = bytes.IndexByte(chunk, '\n')
+			}
+			if end >= 0 {
+				chunk = chunk[:end+1]
+			}
+		}
+		err := w.send(ctx, chunk)
+		if err == ErrRejected {
+			w.log("discarded buffered lines", err)
+		} else if err != nil {
+			w.store(append(buffered, batch...))
+			return err
+		}
+		buffered = buffered[len(chunk):]
+		w.store(buffered)
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+	err = w.send(ctx, batch)
+	switch err {
+	case nil:
+		return nil
+	case ErrRejected:
+		w.log("discarded lines", err)
+		return err
+	}
+	w.store(batch)
+	return err
+}
+
+// Close flushes the pending batch. Undelivered lines remain in the buffer
+// file, if configured. It returns the error of the flush.
+func (w *HTTPWriter) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.opts.Timeout)
+	defer cancel()
+	return w.Flush(ctx)
+}
+
+// store replaces the buffered lines, logging failures.
+func (w *HTTPWriter) store(lines []byte) {
+	if err := w.buffer.store(lines); err != nil {
+		w.log("failed to write buffer", err)
+	}
+}
+
+// send writes the lines, retrying failures with exponential backoff. Rejected
+// and refused writes are not retried. It returns ErrRejected if InfluxDB
+// rejects the lines.
+func (w *HTTPWriter) send(ctx context.Context, lines []byte) error {
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	zw.Write(lines)
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	backoff := w.opts.Backoff
+	for attempt := 0; ; attempt++ {
+		err := w.post(ctx, body.Bytes())
+		if err == nil || err == ErrRejected || err == ErrRefused || attempt >= w.opts.Retries {
+			return err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// post performs a single write request of the compressed lines. Only
+// malformed (400), oversized (413) and unprocessable (422) lines are rejected;
+// other client errors, such as an invalid token (401, 403) or a missing bucket
+// (404), are refused so the lines are kept until the configuration is fixed.
+func (w *HTTPWriter) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("Content-Encoding", "gzip")
+	if w.opts.Token != "" {
+		req.Header.Set("Authorization", "Token "+w.opts.Token)
+	}
+	resp, err := w.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	message, _ := ioutil.ReadAll(resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+		return ErrUnavailable
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusRequestEntityTooLarge ||
+		resp.StatusCode == http.StatusUnprocessableEntity:
+		w.opts.Logger.Log(davisweather.LevelWarn, "write rejected", davisweather.LogComponent, "influx",
+			"status", resp.StatusCode, "message", strings.TrimSpace(string(message)))
+		return ErrRejected
+	}
+	w.opts.Logger.Log(davisweather.LevelWarn, "write refused", davisweather.LogComponent, "influx",
+		"status", resp.StatusCode, "message", strings.TrimSpace(string(message)))
+	return ErrRefused
+}
+
+// log writes a warning with the error.
+func (w *HTTPWriter) log(msg string, err error) {
+	w.opts.Logger.Log(davisweather.LevelWarn, msg, davisweather.LogComponent, "influx", davisweather.LogError, err)
+}
+
+// buffer is a bounded store of undelivered lines, in a file or in memory.
+type buffer struct {
+	path string // path is the buffer file ("" for memory)
+	max  int64  // max is the largest buffer size
+	data []byte // data are the buffered lines in memory
+}
+
+// load returns the buffered lines.
+func (b *buffer) load() ([]byte, error) {
+	if b.path == "" {
+		return b.data, nil
+	}
+	data, err := ioutil.ReadFile(b.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// store replaces the buffered lines, discarding the oldest lines beyond the
+// largest buffer size. The buffer file is replaced atomically.
+func (b *buffer) store(lines []byte) error {
+	if over := int64(len(lines)) - b.max; over > 0 {
+		lines = lines[over:]
+		// discard partial line
+		if i := bytes.IndexByte(lines, '\n'); i >= 0 {
+			lines = lines[i+1:]
+		} else {
+			lines = nil
+		}
+	}
+	if b.path == "" {
+		b.data = append([]byte(nil), lines...)
+		return nil
+	}
+	if len(lines) == 0 {
+		if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(b.path), filepath.Base(b.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(lines); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), b.path)
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package influx
+
+import (
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// request is a write request received by the stand-in.
+type request struct {
+	header http.Header // header are the request headers
+	query  string      // query is the raw query
+	body   string      // body are the decompressed lines
+}
+
+// standIn is an InfluxDB write endpoint stand-in answering with the scripted
+// statuses, then 204 No Content.
+type standIn struct {
+	statuses []int       // statuses are the scripted response statuses
+	requests []request   // requests are the received write requests
+	mutex    *sync.Mutex // mutex is for atomic stand-in actions
+
+	server *httptest.Server // server is the HTTP server
+}
+
+// newStandIn starts a write endpoint stand-in with the scripted statuses.
+func newStandIn(t *testing.T, statuses ...int) *standIn {
+	s := &standIn{statuses: statuses, mutex: &sync.Mutex{}}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		zr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		body, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.requests = append(s.requests, request{header: req.Header, query: req.URL.RawQuery, body: string(body)})
+		status := http.StatusNoContent
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{"code":"error","message":"scripted"}`))
+	}))
+	return s
+}
+
+// received returns the received write requests.
+func (s *standIn) received() []request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]request(nil), s.requests...)
+}
+
+// newTestWriter returns an HTTPWriter of the stand-in buffering to the path.
+func newTestWriter(t *testing.T, s *standIn, bufferPath string) *HTTPWriter {
+	t.Helper()
+	w, err := NewHTTPWriter(HTTPOptions{
+		URL:        s.server.URL,
+		Org:        "home",
+		Bucket:     "weather",
+		Token:      "secret",
+		BatchSize:  2,
+		Backoff:    time.Millisecond,
+		BufferPath: bufferPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestHTTPWriterRetry(t *testing.T) {
+	s := newStandIn(t, http.StatusServiceUnavailable)
+	defer s.server.Close()
+	w := newTestWriter(t, s, "")
+
+	// second line fills the batch
+	if err := w.Write([]byte("m f=1 1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(s.received()); got != 0 {
+		t.Fatalf("requests before full batch = %d, want 0", got)
+	}
+	if err := w.Write([]byte("m f=2 2\n")); err != nil {
+		t.Fatal(err)
+	}
+	requests := s.received()
+	if len(requests) != 2 {
+		t.Fatalf("requests = %d, want 2", len(requests))
+	}
+	last := requests[1]
+	if last.body != "m f=1 1\nm f=2 2\n" {
+		t.Errorf("body = %q", last.body)
+	}
+	if last.query != "bucket=weather&org=home&precision=ns" {
+		t.Errorf("query = %q", last.query)
+	}
+	if last.header.Get("Authorization") != "Token secret" || last.header.Get("Content-Encoding") != "gzip" {
+		t.Errorf("header = %v", last.header)
+	}
+}
+
+func TestHTTPWriterRefused(t *testing.T) {
+	dir, err := ioutil.TempDir("", "influx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "buffer")
+
+	for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound} {
+		s := newStandIn(t, status)
+		w := newTestWriter(t, s, path)
+
+		// refused lines are buffered without retry
+		w.Write([]byte("m f=1 1\n"))
+		if err := w.Flush(context.Background()); err != ErrRefused {
+			t.Errorf("Flush after %d = %v, want %v", status, err, ErrRefused)
+		}
+		if got := len(s.received()); got != 1 {
+			t.Errorf("requests after %d = %d, want 1", status, got)
+		}
+		if data, _ := ioutil.ReadFile(path); string(data) != "m f=1 1\n" {
+			t.Errorf("buffer after %d = %q", status, data)
+		}
+
+		// buffered lines are delivered first once accepted
+		w.Write([]byte("m f=2 2\n"))
+		if err := w.Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		requests := s.received()
+		if len(requests) != 3 || requests[1].body != "m f=1 1\n" || requests[2].body != "m f=2 2\n" {
+			t.Errorf("requests after %d = %+v", status, requests)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("buffer file remains after delivery: %v", err)
+		}
+		s.server.Close()
+	}
+}
+
+func TestHTTPWriterRejected(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity} {
+		s := newStandIn(t, status)
+		w := newTestWriter(t, s, "")
+
+		// rejected lines are discarded
+		w.Write([]byte("m f=1 1\n"))
+		if err := w.Flush(context.Background()); err != ErrRejected {
+			t.Errorf("Flush after %d = %v, want %v", status, err, ErrRejected)
+		}
+		if err := w.Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if got := len(s.received()); got != 1 {
+			t.Errorf("requests after %d = %d, want 1", status, got)
+		}
+		s.server.Close()
+	}
+}
+
+func TestBufferBound(t *testing.T) {
+	b := &buffer{max: 12}
+	if err := b.store([]byte("m f=1 1\nm f=2 2\n")); err != nil {
+		t.Fatal(err)
+	}
+	// oldest lines are discarded, without partial lines
+	if data, _ := b.load(); string(data) != "m f=2 2\n" {
+		t.Errorf("buffer = %q, want newest line", data)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+// Package influx writes the Report of a Client as InfluxDB line protocol, to
+// the InfluxDB /api/v2/write endpoint or to a file or stdout for Telegraf.
+//
+// Each Report update produces a line tagged with the device ID and update
+// method, with a field for every provided numeric Report field. Lines for
+// each transmitter are optionally added, tagged with the transmitter ID and
+// logical sensor ID.
+package influx
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tannerryan/davisweather"
+	"github.com/tannerryan/davisweather/parser"
+)
+
+const (
+	// defaultMeasurement is the default measurement name
+	defaultMeasurement = "davisweather"
+	// defaultFlushInterval is the default time between flushes of Run
+	defaultFlushInterval = 10 * time.Second
+)
+
+var (
+	// sensorFields are the numeric Sensor fields, keyed by JSON name
+	sensorFields = loadSensorFields()
+
+	// measurementEscaper escapes measurement names
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	// keyEscaper escapes tag keys, tag values and field keys
+	keyEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// Options configures the lines of a Report.
+type Options struct {
+	Measurement   string            // Measurement is the measurement name (default "davisweather")
+	Tags          map[string]string // Tags are added to every line (optional)
+	Sensors       bool              // Sensors adds a line for each transmitter, tagged with its transmitter and logical sensor ID
+	FlushInterval time.Duration     // FlushInterval is the time between flushes of Run (default 10 seconds)
+
+	Logger davisweather.Logger // Logger receives write and flush failures of Run (default discards)
+}
+
+// loadSensorFields returns the struct field index of each numeric Sensor
+// field, keyed by JSON name.
+func loadSensorFields() map[string]int {
+	fields := make(map[string]int)
+	floatPtr := reflect.TypeOf((*float64)(nil))
+	t := reflect.TypeOf(davisweather.Sensor{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if f.PkgPath != "" || name == "" || name == "-" || f.Type != floatPtr {
+			continue
+		}
+		fields[name] = i
+	}
+	return fields
+}
+
+// Encode returns the line protocol of the Report, updated by the provided
+// method, timestamped with the Report Timestamp in nanoseconds. It returns
+// nil if the Report has no Timestamp or no numeric field.
+func Encode(r *davisweather.Report, method parser.UpdateMethod, opts Options) []byte {
+	if r.Timestamp.IsZero() {
+		return nil
+	}
+	measurement := opts.Measurement
+	if measurement == "" {
+		measurement = defaultMeasurement
+	}
+	tags := map[string]string{"device": r.DeviceID, "method": string(method)}
+	for k, v := range opts.Tags {
+		tags[k] = v
+	}
+	timestamp := r.Timestamp.UnixNano()
+
+	var b strings.Builder
+	writeLine(&b, measurement, tags, r.Values(), timestamp)
+	if !opts.Sensors {
+		return []byte(b.String())
+	}
+
+	// sensors are ordered by transmitter ID and logical sensor ID
+	keys := make([]davisweather.SensorKey, 0, len(r.Sensors))
+	for key := range r.Sensors {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].TransmitterID != keys[j].TransmitterID {
+			return keys[i].TransmitterID < keys[j].TransmitterID
+		}
+		return keys[i].LogicalSensorID < keys[j].LogicalSensorID
+	})
+	for _, key := range keys {
+		s := r.Sensors[key]
+		if s == nil {
+			continue
+		}
+		sensorTags := make(map[string]string, len(tags)+2)
+		for k, v := range tags {
+			sensorTags[k] = v
+		}
+		sensorTags["transmitter"] = strconv.Itoa(key.TransmitterID)
+		sensorTags["lsid"] = strconv.Itoa(key.LogicalSensorID)
+
+		values := make(map[string]float64)
+		v := reflect.ValueOf(s).Elem()
+		for name, i := range sensorFields {
+			if field := v.Field(i); !field.IsNil() {
+				values[name] = field.Elem().Float()
+			}
+		}
+		writeLine(&b, measurement, sensorTags, values, timestamp)
+	}
+	return []byte(b.String())
+}
+
+// writeLine writes a single line with sorted tags and fields. Empty tag values
+// and non-finite fields are omitted, and nothing is written if there are no
+// fields.
+func writeLine(b *strings.Builder, measurement string, tags map[string]string, fields map[string]float64, timestamp int64) {
+	fieldKeys := make([]string, 0, len(fields))
+	for k, v := range fields {
+		// line protocol has no representation of NaN or infinity
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			fieldKeys = append(fieldKeys, k)
+		}
+	}
+	if len(fieldKeys) == 0 {
+		return
+	}
+	sort.Strings(fieldKeys)
+
+	b.WriteString(measurementEscaper.Replace(measurement))
+
+	tagKeys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if v != "" {
+			tagKeys = append(tagKeys, k)
+		}
+	}
+	sort.Strings(tagKeys)
+	for _, k := range tagKeys {
+		b.WriteString("," + keyEscaper.Replace(k) + "=" + keyEscaper.Replace(tags[k]))
+	}
+
+	for i, k := range fieldKeys {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(keyEscaper.Replace(k) + "=" + strconv.FormatFloat(fields[k], 'f', -1, 64))
+	}
+	b.WriteString(" " + strconv.FormatInt(timestamp, 10) + "\n")
+}
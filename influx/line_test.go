@@ -0,0 +1,65 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package influx
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/davisweather"
+	"github.com/tannerryan/davisweather/parser"
+)
+
+// testReport returns a Report loaded from the JSON payload, observed at
+// 2020-06-16 14:25:00 UTC.
+func testReport(t *testing.T, payload string) *davisweather.Report {
+	t.Helper()
+	r, _ := davisweather.NewReport(false)
+	if err := r.UpdateJSON([]byte(payload)); err != nil {
+		t.Fatal(err)
+	}
+	r.Timestamp = time.Date(2020, 6, 16, 14, 25, 0, 0, time.UTC)
+	return r
+}
+
+func TestEncode(t *testing.T) {
+	r := testReport(t, `{"deviceID":"001D0A700001","temperature":77.5,"humidity":50,
+		"sensors":{"48302/2":{"lsid":48302,"txid":2,"temperature":71},"48301/1":{"lsid":48301,"txid":1,"temperature":77.5,"humidity":50}}}`)
+
+	got := string(Encode(r, parser.UpdateUDP, Options{}))
+	want := "davisweather,device=001D0A700001,method=udp humidity=50,temperature=77.5 1592317500000000000\n"
+	if got != want {
+		t.Errorf("Encode =\n%s\nwant\n%s", got, want)
+	}
+
+	got = string(Encode(r, parser.UpdateHTTP, Options{Measurement: "weather station", Tags: map[string]string{"site": "back yard"}, Sensors: true}))
+	want = `weather\ station,device=001D0A700001,method=http,site=back\ yard humidity=50,temperature=77.5 1592317500000000000` + "\n" +
+		`weather\ station,device=001D0A700001,lsid=48301,method=http,site=back\ yard,transmitter=1 humidity=50,temperature=77.5 1592317500000000000` + "\n" +
+		`weather\ station,device=001D0A700001,lsid=48302,method=http,site=back\ yard,transmitter=2 temperature=71 1592317500000000000` + "\n"
+	if got != want {
+		t.Errorf("Encode with sensors =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := Encode(&davisweather.Report{}, parser.UpdateUDP, Options{}); got != nil {
+		t.Errorf("Encode without Timestamp = %q, want nil", got)
+	}
+}
+
+func TestWriteLine(t *testing.T) {
+	var b strings.Builder
+	writeLine(&b, "m,1", map[string]string{"a=b": "c,d", "empty": ""},
+		map[string]float64{"x y": 1.25, "nan": math.NaN(), "inf": math.Inf(1)}, 7)
+	if want := `m\,1,a\=b=c\,d x\ y=1.25 7` + "\n"; b.String() != want {
+		t.Errorf("writeLine = %q, want %q", b.String(), want)
+	}
+
+	// no finite fields
+	b.Reset()
+	writeLine(&b, "m", nil, map[string]float64{"nan": math.NaN()}, 7)
+	if b.Len() != 0 {
+		t.Errorf("writeLine without fields = %q, want nothing", b.String())
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package influx
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tannerryan/davisweather"
+)
+
+// Sink receives line protocol.
+type Sink interface {
+	// Write accepts one or more complete lines.
+	Write(lines []byte) error
+	// Flush delivers the accepted lines.
+	Flush(ctx context.Context) error
+}
+
+// WriterSink is a Sink writing lines immediately to an io.Writer, such as
+// stdout for the Telegraf execd input or a file for the Telegraf tail input.
+type WriterSink struct {
+	w     io.Writer   // w is the destination
+	file  *os.File    // file is the destination file (nil if not opened by OpenFile)
+	mutex *sync.Mutex // mutex is for atomic writes
+}
+
+// NewWriterSink returns a Sink writing lines to the io.Writer.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w, mutex: &sync.Mutex{}}
+}
+
+// OpenFile returns a Sink appending lines to the file, creating it if it does
+// not exist. It returns an error if the file cannot be opened.
+func OpenFile(path string) (*WriterSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterSink{w: f, file: f, mutex: &sync.Mutex{}}, nil
+}
+
+// Write writes the lines. It returns an error if the write fails.
+func (s *WriterSink) Write(lines []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err := s.w.Write(lines)
+	return err
+}
+
+// Flush does nothing, as lines are written immediately.
+func (s *WriterSink) Flush(ctx context.Context) error {
+	return nil
+}
+
+// Close closes the file opened by OpenFile. It does nothing for other
+// destinations.
+func (s *WriterSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// Run writes the lines of every Event of the Client to the Sink until the
+// context is cancelled, flushing the Sink every FlushInterval and on return.
+// Failed writes and flushes are logged, and the lines are left to the Sink. It
+// returns the error of the final flush.
+func Run(ctx context.Context, c *davisweather.Client, sink Sink, opts Options) error {
+	interval := opts.FlushInterval
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = davisweather.NopLogger()
+	}
+	events := c.Subscribe(ctx, davisweather.SubscribeOptions{Buffer: 64})
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// final flush must not use the cancelled context
+	flush := func() error {
+		flushCtx, cancel := context.WithTimeout(context.Background(), interval)
+		defer cancel()
+		return sink.Flush(flushCtx)
+	}
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return flush()
+			}
+			lines := Encode(event.Report, event.Method, opts)
+			if lines == nil {
+				continue
+			}
+			if err := sink.Write(lines); err != nil {
+				logger.Log(davisweather.LevelWarn, "failed to write lines", davisweather.LogComponent, "influx",
+					davisweather.LogMethod, event.Method, davisweather.LogError, err)
+			}
+		case <-ticker.C:
+			if err := sink.Flush(ctx); err != nil && ctx.Err() == nil {
+				logger.Log(davisweather.LevelWarn, "failed to flush lines", davisweather.LogComponent, "influx",
+					davisweather.LogError, err)
+			}
+		case <-ctx.Done():
+			return flush()
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package influx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/davisweather"
+	"github.com/tannerryan/davisweather/davisweathertest"
+)
+
+// errSink is the error of a failing test Sink
+var errSink = errors.New("sink failure")
+
+// testSink is a Sink recording the written lines, failing every write and
+// flush with the provided error.
+type testSink struct {
+	err     error       // err is returned by every write and flush
+	lines   []string    // lines are the written lines
+	flushes int         // flushes is the number of flushes
+	mutex   *sync.Mutex // mutex is for atomic sink actions
+}
+
+// Write records the lines.
+func (s *testSink) Write(lines []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lines = append(s.lines, string(lines))
+	return s.err
+}
+
+// Flush counts the flush.
+func (s *testSink) Flush(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.flushes++
+	return s.err
+}
+
+// written returns the written lines and the number of flushes.
+func (s *testSink) written() ([]string, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.lines...), s.flushes
+}
+
+// testLogger is a Logger recording the logged messages.
+type testLogger struct {
+	messages []string    // messages are the logged messages
+	mutex    *sync.Mutex // mutex is for atomic logger actions
+}
+
+// Log records the message.
+func (l *testLogger) Log(level davisweather.Level, msg string, fields ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.messages = append(l.messages, msg)
+}
+
+// logged returns true if the message was logged.
+func (l *testLogger) logged(msg string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, m := range l.messages {
+		if m == msg {
+			return true
+		}
+	}
+	return false
+}
+
+// waitFor polls the condition until it is true or the timeout expires.
+func waitFor(t *testing.T, timeout time.Duration, msg string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for " + msg)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	var b bytes.Buffer
+	s := NewWriterSink(&b)
+	s.Write([]byte("m f=1 1\n"))
+	s.Write([]byte("m f=2 2\n"))
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "m f=1 1\nm f=2 2\n" {
+		t.Errorf("written = %q", b.String())
+	}
+
+	dir, err := ioutil.TempDir("", "influx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "lines")
+
+	// reopened file is appended to
+	var f *WriterSink
+	for _, line := range []string{"m f=1 1\n", "m f=2 2\n"} {
+		if f, err = OpenFile(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "m f=1 1\nm f=2 2\n" {
+		t.Errorf("file = %q", data)
+	}
+	if err := f.Write([]byte("m f=3 3\n")); err == nil {
+		t.Error("Write after Close succeeded")
+	}
+	if _, err := OpenFile(filepath.Join(dir, "missing", "lines")); err == nil {
+		t.Error("OpenFile in missing directory succeeded")
+	}
+}
+
+func TestRun(t *testing.T) {
+	// accelerated day changes the conditions with every broadcast
+	unit, err := davisweathertest.Start(davisweathertest.Config{
+		DeviceID:          "001D0A700001",
+		BroadcastInterval: 100 * time.Millisecond,
+		Scenario:          davisweathertest.Diurnal(davisweathertest.Typical, time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unit.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := davisweather.Unmanaged(ctx, false, unit.Host(), unit.Port(),
+		davisweather.WithHTTPStartDelay(0),
+		davisweather.WithUDPDeadline(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, failure := range []error{nil, errSink} {
+		sink := &testSink{err: failure, mutex: &sync.Mutex{}}
+		logger := &testLogger{mutex: &sync.Mutex{}}
+		runCtx, stop := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() {
+			done <- Run(runCtx, c, sink, Options{FlushInterval: 50 * time.Millisecond, Logger: logger})
+		}()
+
+		waitFor(t, 10*time.Second, "written lines and flushes", func() bool {
+			lines, flushes := sink.written()
+			return len(lines) > 0 && flushes > 1
+		})
+		stop()
+		select {
+		case err := <-done:
+			if err != failure {
+				t.Errorf("Run with %v = %v", failure, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Run did not return after cancel")
+		}
+
+		lines, _ := sink.written()
+		if !strings.HasPrefix(lines[0], "davisweather,device=001D0A700001,method=") {
+			t.Errorf("line = %q", lines[0])
+		}
+		for _, msg := range []string{"failed to write lines", "failed to flush lines"} {
+			if got := logger.logged(msg); got != (failure != nil) {
+				t.Errorf("logged %q with %v = %v", msg, failure, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Level indicates the severity of a log entry.
+type Level int
+
+const (
+	// LevelDebug is for detailed diagnostics, such as each Report update
+	LevelDebug Level = 0
+	// LevelInfo is for lifecycle events, such as locating the WLL unit
+	LevelInfo Level = 1
+	// LevelWarn is for recoverable failures, such as a failed HTTP poll
+	LevelWarn Level = 2
+	// LevelError is for failures that require intervention
+	LevelError Level = 3
+)
+
+// String returns the name of the level.
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+const (
+	// LogComponent is the log field key of the Client component
+	LogComponent = "component"
+	// LogDevice is the log field key of the WLL device ID
+	LogDevice = "device"
+	// LogMethod is the log field key of the Report update method
+	LogMethod = "method"
+	// LogError is the log field key of an error
+	LogError = "error"
+)
+
+// Logger is a structured logger. Fields are alternating key and value pairs,
+// using the Log field keys where applicable.
+type Logger interface {
+	Log(level Level, msg string, fields ...interface{})
+}
+
+// stdLogger is a Logger writing to a standard library logger.
+type stdLogger struct {
+	logger *log.Logger // logger is the destination (package logger if nil)
+	min    Level       // min is the minimum level written
+}
+
+// NewStdLogger returns a Logger writing entries at or above the minimum level
+// to the provided standard library logger. If the provided logger is nil, the
+// standard logger of the log package is used.
+func NewStdLogger(logger *log.Logger, min Level) Logger {
+	return &stdLogger{logger: logger, min: min}
+}
+
+// Log writes the entry as "[davisweather component] level: msg key=value".
+func (l *stdLogger) Log(level Level, msg string, fields ...interface{}) {
+	if level < l.min {
+		return
+	}
+	prefix := "[davisweather]"
+	var b strings.Builder
+	for i := 0; i < len(fields); i += 2 {
+		key := fmt.Sprint(fields[i])
+		var value interface{} = "(missing)"
+		if i+1 < len(fields) {
+			value = fields[i+1]
+		}
+		if key == LogComponent {
+			prefix = fmt.Sprintf("[davisweather %v]", value)
+			continue
+		}
+		fmt.Fprintf(&b, " %s=%v", key, value)
+	}
+	line := fmt.Sprintf("%s %s: %s%s", prefix, level, msg, b.String())
+	if l.logger == nil {
+		log.Println(line)
+		return
+	}
+	l.logger.Println(line)
+}
+
+// nopLogger is a Logger discarding every entry.
+type nopLogger struct{}
+
+// NopLogger returns a Logger that discards every entry.
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+// Log discards the entry.
+func (nopLogger) Log(level Level, msg string, fields ...interface{}) {}
+
+// verboseLogger returns the Logger used when only verbose logging is
+// configured.
+func verboseLogger(verbose bool) Logger {
+	if verbose {
+		return NewStdLogger(nil, LevelDebug)
+	}
+	return NopLogger()
+}
+
+// SetLogger configures the Logger of the Report. A nil Logger discards every
+// entry.
+func (r *Report) SetLogger(l Logger) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if l == nil {
+		l = NopLogger()
+	}
+	r.logger = l
+}
+
+// log writes an entry for the provided Client component, including the device
+// ID once it is known.
+func (c *Client) log(level Level, component string, msg string, fields ...interface{}) {
+	c.report.mutex.Lock()
+	device := c.report.DeviceID
+	c.report.mutex.Unlock()
+
+	prefix := []interface{}{LogComponent, component}
+	if device != "" {
+		prefix = append(prefix, LogDevice, device)
+	}
+	c.logger.Log(level, msg, append(prefix, fields...)...)
+}
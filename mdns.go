@@ -19,12 +19,9 @@ const (
 	mDNSService = "_tcp."
 	// mDNSDomain is mDNS domain name
 	mDNSDomain = "local."
-	// mDNSTimeout is the mDNS discovery timeout
+	// mDNSTimeout is the default mDNS discovery timeout
 	mDNSTimeout = 15 * time.Second
-)
-
-var (
-	// mDNSInterval is sleep between mDNS discovery (gets modified to TTL)
+	// mDNSInterval is the initial sleep between mDNS discovery
 	mDNSInterval = 5 * time.Second
 )
 
@@ -55,11 +52,12 @@ func (c *Client) discovery(ctx context.Context, resolved context.CancelFunc) {
 	defer resolved()
 
 	for {
-		c.println("[davisweather mdns] performing autodiscovery of WeatherLink Live unit")
-		recover := mDNSInterval / 2
+		c.log(LevelDebug, "mdns", "performing autodiscovery of WeatherLink Live unit")
+		recover := c.mDNSInterval / 2
 		err := c.mDNSDiscover(ctx, resolved)
 		if err != nil {
-			c.println("[davisweather mdns] failed to perform autodiscovery, retrying in", recover)
+			c.recordDiscovery("", err)
+			c.log(LevelWarn, "mdns", "failed to perform autodiscovery", "retry", recover, LogError, err)
 			time.Sleep(recover)
 			continue
 		}
@@ -67,9 +65,9 @@ func (c *Client) discovery(ctx context.Context, resolved context.CancelFunc) {
 		select {
 		case <-ctx.Done():
 			// Client was terminated
-			c.println("[davisweather mdns] terminating event loop")
+			c.log(LevelInfo, "mdns", "terminating event loop")
 			return
-		case <-time.After(mDNSInterval):
+		case <-time.After(c.mDNSInterval):
 			// sleep for next iteration
 		}
 	}
@@ -85,7 +83,7 @@ func (c *Client) mDNSDiscover(ctx context.Context, resolved context.CancelFunc)
 		return err
 	}
 	// terminate discovery when device is found or timeout
-	deadline := time.Now().Add(mDNSTimeout)
+	deadline := time.Now().Add(c.mDNSTimeout)
 	ctx, done := context.WithDeadline(ctx, deadline)
 	defer done()
 
@@ -106,7 +104,7 @@ func (c *Client) mDNSDiscover(ctx context.Context, resolved context.CancelFunc)
 
 // mDNSLoop is called by the mDNSDiscover process. It loops over the
 // ServiceEntry channel until the WLL unit is located. If the unit is located,
-// the unit in Client is updated and the mDNSInterval is updated to mDNS TTL.
+// the unit in Client is updated and the mDNS interval is updated to mDNS TTL.
 func mDNSLoop(c *Client, responders <-chan *zeroconf.ServiceEntry, done context.CancelFunc, resolved context.CancelFunc) {
 	start := time.Now()
 	for r := range responders {
@@ -117,20 +115,14 @@ func mDNSLoop(c *Client, responders <-chan *zeroconf.ServiceEntry, done context.
 			// generate wllUnit and update Client
 			u := wllUnit(*r)
 			c.unit = &u
+			c.recordDiscovery(u.GetURL(), nil)
 
 			// update mDNS interval to TTL
-			mDNSInterval = time.Duration(r.TTL) * time.Second
-
-			// location printing
-			if len(u.AddrIPv6) > 0 {
-				c.printf("[davisweather mdns] found WeatherLink Live unit in %.2fs at %s:%d",
-					duration.Seconds(), u.AddrIPv6[0].String(), u.Port)
-			} else if len(u.AddrIPv4) > 0 {
-				c.printf("[davisweather mdns] found WeatherLink Live unit in %.2fs at %s:%d",
-					duration.Seconds(), u.AddrIPv4[0].String(), u.Port)
-			}
-
-			c.println("[davisweather mdns] reperforming autodiscovery in", mDNSInterval)
+			c.mDNSInterval = time.Duration(r.TTL) * time.Second
+
+			c.log(LevelInfo, "mdns", "found WeatherLink Live unit",
+				"address", u.GetURL(), "duration", duration)
+			c.log(LevelDebug, "mdns", "scheduled autodiscovery", "interval", c.mDNSInterval)
 
 			// notify caller process is done
 			done()
@@ -0,0 +1,321 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultKeepAlive is the default keep alive interval
+	defaultKeepAlive = time.Minute
+	// minKeepAlive is the shortest keep alive interval
+	minKeepAlive = time.Second
+	// maxKeepAlive is the longest keep alive interval of the CONNECT packet
+	maxKeepAlive = 65535 * time.Second
+	// ackTimeout is how long to wait for a CONNACK or PUBACK
+	ackTimeout = 10 * time.Second
+)
+
+var (
+	// ErrClosed is returned when using a closed or lost connection
+	ErrClosed = errors.New("mqtt: connection closed")
+	// ErrTimeout is returned when the broker does not acknowledge in time
+	ErrTimeout = errors.New("mqtt: acknowledgement timeout")
+	// ErrRefused is returned when the broker refuses the connection
+	ErrRefused = errors.New("mqtt: connection refused")
+	// ErrNotAuthorized is returned when the broker rejects the credentials
+	ErrNotAuthorized = errors.New("mqtt: not authorized")
+	// ErrQoS is returned when publishing with a QoS other than 0 or 1
+	ErrQoS = errors.New("mqtt: unsupported qos")
+	// ErrPasswordOnly is returned when a password is provided without a
+	// username, which MQTT 3.1.1 does not permit
+	ErrPasswordOnly = errors.New("mqtt: password provided without username")
+)
+
+// Will is the message published by the broker when the connection is lost.
+type Will struct {
+	Topic   string // Topic is the topic of the will message
+	Payload []byte // Payload is the will message
+	QoS     byte   // QoS is the quality of service of the will message (0 or 1)
+	Retain  bool   // Retain indicates the will message is retained
+}
+
+// Conn is a minimal MQTT 3.1.1 client connection supporting QoS 0 and 1
+// publishing. Subscriptions are not supported.
+type Conn struct {
+	conn      net.Conn                 // conn is the broker connection
+	keepAlive time.Duration            // keepAlive is the keep alive interval
+	acks      map[uint16]chan struct{} // acks are the outstanding QoS 1 publishes
+	nextID    uint16                   // nextID is the next packet ID
+	done      chan struct{}            // done is closed when the connection is lost
+	err       error                    // err is the error that closed the connection
+	write     *sync.Mutex              // write is for atomic packet writes
+	mutex     *sync.Mutex              // mutex is for atomic connection actions
+}
+
+// Dial connects to the broker of the Options over TCP, or TLS if provided, and
+// completes the MQTT handshake with a clean session. The optional will is
+// published by the broker if the connection is lost. The keep alive interval
+// is rounded to whole seconds, between 1 second and 65535 seconds. It returns
+// an error if a password is provided without a username, or if the connection
+// or handshake fails.
+func Dial(ctx context.Context, opts Options, will *Will) (*Conn, error) {
+	keepAlive := keepAliveInterval(opts.KeepAlive)
+	if will != nil && will.QoS > 1 {
+		return nil, ErrQoS
+	}
+	if opts.Password != "" && opts.Username == "" {
+		return nil, ErrPasswordOnly
+	}
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", opts.Broker)
+	if err != nil {
+		return nil, err
+	}
+	if opts.TLS != nil {
+		config := opts.TLS.Clone()
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(opts.Broker)
+		}
+		conn = tls.Client(conn, config)
+	}
+
+	// handshake
+	deadline := time.Now().Add(ackTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	reader := bufio.NewReader(conn)
+	code, err := handshake(conn, reader, connect{
+		clientID:  opts.ClientID,
+		username:  opts.Username,
+		password:  opts.Password,
+		keepAlive: uint16(keepAlive / time.Second),
+		will:      will,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	switch code {
+	case 0:
+	case 4, 5:
+		conn.Close()
+		return nil, ErrNotAuthorized
+	default:
+		conn.Close()
+		return nil, ErrRefused
+	}
+	conn.SetDeadline(time.Time{})
+
+	c := &Conn{
+		conn:      conn,
+		keepAlive: keepAlive,
+		acks:      make(map[uint16]chan struct{}),
+		done:      make(chan struct{}),
+		write:     &sync.Mutex{},
+		mutex:     &sync.Mutex{},
+	}
+	go c.readLoop(reader)
+	go c.pingLoop()
+	return c, nil
+}
+
+// keepAliveInterval returns the keep alive interval rounded to whole seconds,
+// between the shortest and longest interval. Zero or negative intervals use
+// the default.
+func keepAliveInterval(d time.Duration) time.Duration {
+	if d <= 0 {
+		return defaultKeepAlive
+	}
+	d = d.Round(time.Second)
+	if d < minKeepAlive {
+		return minKeepAlive
+	}
+	if d > maxKeepAlive {
+		return maxKeepAlive
+	}
+	return d
+}
+
+// handshake sends the CONNECT packet and returns the CONNACK return code.
+func handshake(conn net.Conn, reader *bufio.Reader, c connect) (byte, error) {
+	request, err := encodeConnect(c)
+	if err != nil {
+		return 0, err
+	}
+	buff, err := request.encode()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := conn.Write(buff); err != nil {
+		return 0, err
+	}
+	p, err := readPacket(reader)
+	if err != nil {
+		return 0, err
+	}
+	return decodeConnack(p)
+}
+
+// Publish sends the payload to the topic. QoS 1 publishes wait for the broker
+// acknowledgement. It returns an error if the connection is lost or the
+// publish is not acknowledged.
+func (c *Conn) Publish(topic string, payload []byte, qos byte, retain bool) error {
+	if qos > 1 {
+		return ErrQoS
+	}
+
+	var id uint16
+	var ack chan struct{}
+	if qos == 1 {
+		c.mutex.Lock()
+		c.nextID++
+		if c.nextID == 0 {
+			c.nextID++
+		}
+		id = c.nextID
+		ack = make(chan struct{})
+		c.acks[id] = ack
+		c.mutex.Unlock()
+		defer func() {
+			c.mutex.Lock()
+			delete(c.acks, id)
+			c.mutex.Unlock()
+		}()
+	}
+
+	p, err := encodePublish(topic, payload, qos, retain, id)
+	if err != nil {
+		return err
+	}
+	if err := c.send(p); err != nil {
+		return err
+	}
+	if ack == nil {
+		return nil
+	}
+	timer := time.NewTimer(ackTimeout)
+	defer timer.Stop()
+	select {
+	case <-ack:
+		return nil
+	case <-c.done:
+		return c.Err()
+	case <-timer.C:
+		return ErrTimeout
+	}
+}
+
+// Done returns a channel that is closed when the connection is lost or closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the error that closed the connection, or nil if it is open.
+func (c *Conn) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+// Close sends a DISCONNECT packet and closes the connection. The will message
+// is not published after a clean disconnect.
+func (c *Conn) Close() error {
+	select {
+	case <-c.done:
+		return nil
+	default:
+	}
+	c.send(packet{kind: packetDisconnect})
+	c.fail(ErrClosed)
+	return nil
+}
+
+// send writes a single packet, closing the connection if the write fails.
+func (c *Conn) send(p packet) error {
+	buff, err := p.encode()
+	if err != nil {
+		return err
+	}
+	select {
+	case <-c.done:
+		return c.Err()
+	default:
+	}
+
+	c.write.Lock()
+	defer c.write.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(ackTimeout))
+	if _, err := c.conn.Write(buff); err != nil {
+		c.fail(err)
+		return err
+	}
+	return nil
+}
+
+// fail records the error and closes the connection, once.
+func (c *Conn) fail(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	c.conn.Close()
+	close(c.done)
+}
+
+// readLoop reads packets from the broker until the connection is lost. The
+// read deadline expires if the broker stops answering pings.
+func (c *Conn) readLoop(reader *bufio.Reader) {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+		p, err := readPacket(reader)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		if p.kind != packetPuback {
+			continue
+		}
+		id, err := decodePuback(p)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		c.mutex.Lock()
+		if ack, ok := c.acks[id]; ok {
+			close(ack)
+			delete(c.acks, id)
+		}
+		c.mutex.Unlock()
+	}
+}
+
+// pingLoop sends a PINGREQ every half keep alive interval until the connection
+// is lost.
+func (c *Conn) pingLoop() {
+	ticker := time.NewTicker(c.keepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if c.send(packet{kind: packetPingreq}) != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package mqtt
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/tannerryan/davisweather"
+)
+
+// field is a published Report field.
+type field struct {
+	path        string // path is the topic path of the field (JSON names joined by "/")
+	index       []int  // index is the struct field index of each path element
+	name        string // name is the human readable name of the field
+	deviceClass string // deviceClass is the Home Assistant device class ("" if none)
+	unit        string // unit is the unit of measurement ("" if none)
+	numeric     bool   // numeric indicates the field is a measurement
+}
+
+// classRule assigns a device class and unit to fields whose lowercase path
+// contains the match.
+type classRule struct {
+	match       string // match is the lowercase substring of the path
+	deviceClass string // deviceClass is the Home Assistant device class
+	unit        string // unit is the unit of measurement
+}
+
+var (
+	// fields are the published Report fields, in declaration order
+	fields = loadFields()
+	// timeType is the type of timestamp fields
+	timeType = reflect.TypeOf(time.Time{})
+
+	// classRules are the device class and unit rules, in match order. Report
+	// fields are in US customary units, rain counts unless converted to depth.
+	classRules = []classRule{
+		{"rainsize", "", ""},
+		{"raindepth/rainrate", "precipitation_intensity", "in/h"},
+		{"raindepth/", "precipitation", "in"},
+		{"rainrate", "", "count/h"},
+		{"rain", "", "count"},
+		{"et0/hourly", "", "mm/h"},
+		{"et0/", "", "mm"},
+		{"vaporpressure", "pressure", "hPa"},
+		{"absolutehumidity", "", "g/m³"},
+		{"humidex", "", ""},
+		{"humidity", "humidity", "%"},
+		{"barometertrend", "", "inHg"},
+		{"barometer", "pressure", "inHg"},
+		{"dir", "", "°"},
+		{"speed", "wind_speed", "mph"},
+		{"temperature", "temperature", "°F"},
+		{"dewpoint", "temperature", "°F"},
+		{"wetbulb", "temperature", "°F"},
+		{"heatindex", "temperature", "°F"},
+		{"windchill", "temperature", "°F"},
+		{"thwindex", "temperature", "°F"},
+		{"thswindex", "temperature", "°F"},
+		{"frostpoint", "temperature", "°F"},
+		{"solarrad", "irradiance", "W/m²"},
+		{"uvindex", "", "UV index"},
+		{"soilmoisture", "", "cb"},
+		{"airdensity", "", "kg/m³"},
+		{"densityaltitude", "distance", "ft"},
+		{"cloudbase", "distance", "ft"},
+	}
+)
+
+// loadFields returns the Report fields with a JSON name and a scalar value,
+// and the scalar fields of nested structures, excluding the DeviceID and
+// Timestamp.
+func loadFields() []field {
+	var out []field
+	t := reflect.TypeOf(davisweather.Report{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := jsonName(f)
+		if name == "" || name == "deviceID" || name == "timestamp" {
+			continue
+		}
+		if scalar(f.Type) {
+			out = append(out, newField(name, []int{i}, f.Type))
+			continue
+		}
+		// nested structure, such as the rain depths
+		nested := f.Type
+		if nested.Kind() == reflect.Ptr {
+			nested = nested.Elem()
+		}
+		if nested.Kind() != reflect.Struct {
+			continue
+		}
+		for j := 0; j < nested.NumField(); j++ {
+			sub := nested.Field(j)
+			subName := jsonName(sub)
+			if subName == "" || !scalar(sub.Type) {
+				continue
+			}
+			out = append(out, newField(name+"/"+subName, []int{i, j}, sub.Type))
+		}
+	}
+	return out
+}
+
+// newField returns the field of the path, classified by its JSON names.
+func newField(path string, index []int, t reflect.Type) field {
+	f := field{path: path, index: index, name: displayName(path)}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		f.deviceClass = "timestamp"
+		return f
+	case t.Kind() == reflect.String:
+		return f
+	}
+	f.numeric = true
+	lower := strings.ToLower(path)
+	for _, rule := range classRules {
+		if strings.Contains(lower, rule.match) {
+			f.deviceClass = rule.deviceClass
+			f.unit = rule.unit
+			break
+		}
+	}
+	return f
+}
+
+// jsonName returns the JSON name of an exported struct field, or "" if it is
+// not encoded.
+func jsonName(f reflect.StructField) string {
+	if f.PkgPath != "" {
+		return ""
+	}
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// scalar returns true if the type, or the type it points to, is published as
+// a single value.
+func scalar(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Float64, reflect.Int, reflect.String:
+		return true
+	}
+	return t == timeType
+}
+
+// displayName returns the human readable name of a field path, such as "Rain
+// Depth Rain Daily" for "rainDepth/rainDaily".
+func displayName(path string) string {
+	var b strings.Builder
+	prev := ' '
+	for _, r := range strings.Replace(path, "/", " ", -1) {
+		switch {
+		case r == ' ':
+		case b.Len() == 0 || prev == ' ':
+			r = unicode.ToUpper(r)
+			if b.Len() > 0 {
+				b.WriteRune(' ')
+			}
+		case unicode.IsUpper(r) && !unicode.IsUpper(prev):
+			b.WriteRune(' ')
+		case unicode.IsDigit(r) && !unicode.IsDigit(prev):
+			b.WriteRune(' ')
+		}
+		if r != ' ' {
+			b.WriteRune(r)
+		}
+		prev = r
+	}
+	return b.String()
+}
+
+// payload returns the published value of the field in the Report. It returns
+// false if the field is not provided.
+func (f field) payload(r *davisweather.Report) (string, bool) {
+	v := reflect.ValueOf(r).Elem()
+	for _, i := range f.index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return "", false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(time.RFC3339), true
+	}
+	switch v.Kind() {
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), true
+	case reflect.Int:
+		return strconv.FormatInt(v.Int(), 10), true
+	case reflect.String:
+		if v.String() == "" {
+			return "", false
+		}
+		return v.String(), true
+	}
+	return "", false
+}
@@ -0,0 +1,336 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+// Package mqtt publishes the Report of a Client to an MQTT broker using a
+// minimal built-in MQTT 3.1.1 client over TCP or TLS.
+//
+// Each Report field is published to its own retained topic when modified,
+// under "<prefix>/<deviceID>/<field>". The availability topic
+// "<prefix>/<deviceID>/availability" is "online" while the Client is receiving
+// weather conditions, and "offline" otherwise or if the connection is lost.
+// Home Assistant discovery configuration is optionally published for every
+// field, with the device class and unit derived from the JSON name of the
+// field.
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/tannerryan/davisweather"
+)
+
+const (
+	// defaultPrefix is the default topic prefix
+	defaultPrefix = "davisweather"
+	// defaultClientPrefix is the prefix of the default client identifier, short
+	// enough to fit the 23 bytes every MQTT 3.1.1 broker accepts
+	defaultClientPrefix = "dw-"
+	// defaultDiscoveryPrefix is the default Home Assistant discovery prefix
+	defaultDiscoveryPrefix = "homeassistant"
+	// defaultRetryInterval is the default time between connection attempts
+	defaultRetryInterval = 10 * time.Second
+
+	// availabilityTopic is the topic suffix of the availability topic
+	availabilityTopic = "availability"
+	// payloadOnline is the availability payload while the Client is healthy
+	payloadOnline = "online"
+	// payloadOffline is the availability payload while the Client is unhealthy
+	payloadOffline = "offline"
+	// logComponent is the log component of the Publisher
+	logComponent = "mqtt"
+)
+
+var (
+	// ErrBrokerMissing is returned when no broker address is provided
+	ErrBrokerMissing = errors.New("mqtt: broker address not provided")
+)
+
+// Options configures the broker connection and topics of a Publisher.
+type Options struct {
+	Broker    string        // Broker is the host:port of the MQTT broker
+	TLS       *tls.Config   // TLS enables TLS with the provided configuration (optional)
+	ClientID  string        // ClientID is the MQTT client identifier (default "dw-<deviceID>")
+	Username  string        // Username is the broker username (optional)
+	Password  string        // Password is the broker password (optional)
+	KeepAlive time.Duration // KeepAlive is the keep alive interval, in whole seconds from 1 second (default 1 minute)
+	QoS       byte          // QoS is the quality of service of published messages (0 or 1)
+
+	Prefix          string        // Prefix is the topic prefix (default "davisweather")
+	Discovery       bool          // Discovery publishes Home Assistant discovery configuration
+	DiscoveryPrefix string        // DiscoveryPrefix is the Home Assistant discovery prefix (default "homeassistant")
+	RetryInterval   time.Duration // RetryInterval is the time between connection attempts (default 10 seconds)
+
+	Logger davisweather.Logger // Logger receives connection failures (default discards)
+}
+
+// Publisher publishes the Report of a Client to an MQTT broker.
+type Publisher struct {
+	opts Options // opts are the Publisher options
+
+	deviceID     string            // deviceID is the device ID of the published Report
+	published    map[string]string // published are the retained payloads of each field path
+	discovered   map[string]bool   // discovered are the field paths with published discovery configuration
+	availability string            // availability is the published availability payload
+}
+
+// discoveryConfig is a Home Assistant MQTT sensor discovery configuration.
+type discoveryConfig struct {
+	Name              string          `json:"name"`
+	UniqueID          string          `json:"unique_id"`
+	StateTopic        string          `json:"state_topic"`
+	AvailabilityTopic string          `json:"availability_topic"`
+	DeviceClass       string          `json:"device_class,omitempty"`
+	StateClass        string          `json:"state_class,omitempty"`
+	Unit              string          `json:"unit_of_measurement,omitempty"`
+	Device            discoveryDevice `json:"device"`
+}
+
+// discoveryDevice is the Home Assistant device of a discovery configuration.
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+// New returns a Publisher with the provided options. It returns an error if no
+// broker address is provided, the QoS is not supported, or a password is
+// provided without a username.
+func New(opts Options) (*Publisher, error) {
+	if opts.Broker == "" {
+		return nil, ErrBrokerMissing
+	}
+	if opts.QoS > 1 {
+		return nil, ErrQoS
+	}
+	if opts.Password != "" && opts.Username == "" {
+		return nil, ErrPasswordOnly
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = defaultPrefix
+	}
+	if opts.DiscoveryPrefix == "" {
+		opts.DiscoveryPrefix = defaultDiscoveryPrefix
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = defaultRetryInterval
+	}
+	if opts.Logger == nil {
+		opts.Logger = davisweather.NopLogger()
+	}
+	return &Publisher{opts: opts}, nil
+}
+
+// Run publishes the Report of the Client until the context is cancelled,
+// reconnecting to the broker after every RetryInterval while disconnected.
+// Publishing starts once the device ID of the WLL unit is known. On return,
+// the availability is set offline and the connection is closed.
+func (p *Publisher) Run(ctx context.Context, c *davisweather.Client) {
+	events := c.Subscribe(ctx, davisweather.SubscribeOptions{Buffer: 16, Policy: davisweather.DropOldest})
+	transitions := c.Transitions(ctx)
+
+	// wait for device ID
+	report, _ := c.Report()
+	for report == nil || report.DeviceID == "" {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			report = event.Report
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	var conn *Conn
+	retry := time.NewTimer(0)
+	defer retry.Stop()
+	for {
+		var done <-chan struct{}
+		if conn != nil {
+			done = conn.Done()
+		}
+		select {
+		case <-ctx.Done():
+			p.disconnect(conn)
+			return
+		case event, ok := <-events:
+			if !ok {
+				p.disconnect(conn)
+				return
+			}
+			report = event.Report
+			if conn != nil {
+				p.check(conn, p.publishReport(conn, report))
+			}
+		case _, ok := <-transitions:
+			if !ok {
+				p.disconnect(conn)
+				return
+			}
+			if conn != nil {
+				p.check(conn, p.publishAvailability(conn, c.Status()))
+			}
+		case <-done:
+			p.opts.Logger.Log(davisweather.LevelWarn, "broker connection lost", davisweather.LogComponent, logComponent,
+				davisweather.LogError, conn.Err())
+			conn = nil
+			retry.Reset(p.opts.RetryInterval)
+		case <-retry.C:
+			var err error
+			conn, err = p.connect(ctx, report, c.Status())
+			if err != nil {
+				p.opts.Logger.Log(davisweather.LevelWarn, "broker connection failed", davisweather.LogComponent, logComponent,
+					davisweather.LogError, err)
+				conn = nil
+				retry.Reset(p.opts.RetryInterval)
+			}
+		}
+	}
+}
+
+// connect connects to the broker with an offline availability will, and
+// publishes the availability and every field of the Report. Retained topics
+// are republished on every connection.
+func (p *Publisher) connect(ctx context.Context, report *davisweather.Report, status davisweather.Status) (*Conn, error) {
+	p.deviceID = report.DeviceID
+	p.published = make(map[string]string)
+	p.discovered = make(map[string]bool)
+	p.availability = ""
+
+	opts := p.opts
+	if opts.ClientID == "" {
+		opts.ClientID = defaultClientPrefix + p.deviceID
+	}
+	conn, err := Dial(ctx, opts, &Will{
+		Topic:   p.topic(availabilityTopic),
+		Payload: []byte(payloadOffline),
+		QoS:     p.opts.QoS,
+		Retain:  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.opts.Logger.Log(davisweather.LevelInfo, "connected to broker", davisweather.LogComponent, logComponent,
+		davisweather.LogDevice, p.deviceID)
+
+	if err := p.publishAvailability(conn, status); err != nil {
+		conn.fail(err)
+		return nil, err
+	}
+	if err := p.publishReport(conn, report); err != nil {
+		conn.fail(err)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// disconnect sets the availability offline and closes the connection, if
+// connected.
+func (p *Publisher) disconnect(conn *Conn) {
+	if conn == nil {
+		return
+	}
+	conn.Publish(p.topic(availabilityTopic), []byte(payloadOffline), p.opts.QoS, true)
+	conn.Close()
+}
+
+// check drops the connection if the publish failed, so Run reconnects.
+func (p *Publisher) check(conn *Conn, err error) {
+	if err != nil {
+		conn.fail(err)
+	}
+}
+
+// publishReport publishes every field of the Report whose payload differs
+// from the retained payload. Fields that are no longer provided have their
+// retained payload removed. Discovery configuration is published before the
+// first payload of each field.
+func (p *Publisher) publishReport(conn *Conn, report *davisweather.Report) error {
+	for _, f := range fields {
+		payload, ok := f.payload(report)
+		previous, published := p.published[f.path]
+		if !ok {
+			if !published {
+				continue
+			}
+			// empty retained payload removes the retained message
+			if err := conn.Publish(p.topic(f.path), nil, p.opts.QoS, true); err != nil {
+				return err
+			}
+			delete(p.published, f.path)
+			continue
+		}
+		if published && payload == previous {
+			continue
+		}
+		if p.opts.Discovery && !p.discovered[f.path] {
+			if err := p.publishDiscovery(conn, f); err != nil {
+				return err
+			}
+			p.discovered[f.path] = true
+		}
+		if err := conn.Publish(p.topic(f.path), []byte(payload), p.opts.QoS, true); err != nil {
+			return err
+		}
+		p.published[f.path] = payload
+	}
+	return nil
+}
+
+// publishAvailability publishes the availability of the Client if modified.
+// The Client is available while live or polling.
+func (p *Publisher) publishAvailability(conn *Conn, status davisweather.Status) error {
+	availability := payloadOffline
+	if status.State == davisweather.StateLive || status.State == davisweather.StatePolling {
+		availability = payloadOnline
+	}
+	if availability == p.availability {
+		return nil
+	}
+	if err := conn.Publish(p.topic(availabilityTopic), []byte(availability), p.opts.QoS, true); err != nil {
+		return err
+	}
+	p.availability = availability
+	return nil
+}
+
+// publishDiscovery publishes the Home Assistant discovery configuration of the
+// field.
+func (p *Publisher) publishDiscovery(conn *Conn, f field) error {
+	objectID := strings.Replace(f.path, "/", "_", -1)
+	config := discoveryConfig{
+		Name:              f.name,
+		UniqueID:          p.deviceID + "_" + objectID,
+		StateTopic:        p.topic(f.path),
+		AvailabilityTopic: p.topic(availabilityTopic),
+		DeviceClass:       f.deviceClass,
+		Unit:              f.unit,
+		Device: discoveryDevice{
+			Identifiers:  []string{defaultPrefix + "_" + p.deviceID},
+			Name:         "WeatherLink Live " + p.deviceID,
+			Manufacturer: "Davis Instruments",
+			Model:        "WeatherLink Live",
+		},
+	}
+	if f.numeric {
+		config.StateClass = "measurement"
+	}
+	buff, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	topic := p.opts.DiscoveryPrefix + "/sensor/" + p.deviceID + "/" + objectID + "/config"
+	return conn.Publish(topic, buff, p.opts.QoS, true)
+}
+
+// topic returns the topic of the suffix for the device.
+func (p *Publisher) topic(suffix string) string {
+	return p.opts.Prefix + "/" + p.deviceID + "/" + suffix
+}
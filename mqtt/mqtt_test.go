@@ -0,0 +1,208 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/davisweather"
+	"github.com/tannerryan/davisweather/davisweathertest"
+	"github.com/tannerryan/davisweather/mqtt/mqtttest"
+)
+
+// testDevice is the device ID of the simulated unit
+const testDevice = "001D0A700001"
+
+// waitFor polls the condition until it is true or the timeout expires.
+func waitFor(t *testing.T, timeout time.Duration, msg string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for " + msg)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// retained returns true if the broker retains the payload on the topic.
+func retained(b *mqtttest.Broker, topic string, payload string) bool {
+	p, ok := b.Retained()[topic]
+	return ok && string(p) == payload
+}
+
+func TestKeepAliveInterval(t *testing.T) {
+	for _, test := range []struct {
+		in   time.Duration
+		want time.Duration
+	}{
+		{0, defaultKeepAlive},
+		{-time.Second, defaultKeepAlive},
+		{time.Nanosecond, time.Second},
+		{400 * time.Millisecond, time.Second},
+		{2600 * time.Millisecond, 3 * time.Second},
+		{24 * time.Hour, maxKeepAlive},
+	} {
+		if got := keepAliveInterval(test.in); got != test.want {
+			t.Errorf("keepAliveInterval(%v) = %v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestDial(t *testing.T) {
+	broker, err := mqtttest.Start(mqtttest.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer broker.Close()
+	ctx := context.Background()
+
+	if _, err := New(Options{Broker: broker.Addr(), Password: "secret"}); err != ErrPasswordOnly {
+		t.Errorf("New with password only = %v, want %v", err, ErrPasswordOnly)
+	}
+	if _, err := Dial(ctx, Options{Broker: broker.Addr(), Password: "secret"}, nil); err != ErrPasswordOnly {
+		t.Errorf("Dial with password only = %v, want %v", err, ErrPasswordOnly)
+	}
+
+	// sub-second keep alive is sent as 1 second and pinged without panic
+	conn, err := Dial(ctx, Options{Broker: broker.Addr(), ClientID: "test", KeepAlive: time.Nanosecond}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1200 * time.Millisecond)
+	// topic too long is not sent
+	if err := conn.Publish(strings.Repeat("t", maxString+1), []byte("payload"), 1, false); err != errTooLong {
+		t.Errorf("Publish with long topic = %v, want %v", err, errTooLong)
+	}
+	if err := conn.Publish("test/topic", []byte("payload"), 1, false); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	sessions := broker.Sessions()
+	if len(sessions) != 1 || sessions[0].KeepAlive != 1 {
+		t.Errorf("Sessions = %+v, want one with keep alive 1", sessions)
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	long := strings.Repeat("t", maxString+1)
+	if _, err := encodePublish(long[1:], nil, 0, false, 0); err != nil {
+		t.Errorf("encodePublish with %d byte topic = %v", maxString, err)
+	}
+	if _, err := encodePublish(long, nil, 0, false, 0); err != errTooLong {
+		t.Errorf("encodePublish with long topic = %v, want %v", err, errTooLong)
+	}
+	for _, c := range []connect{
+		{clientID: long},
+		{clientID: "test", will: &Will{Topic: long}},
+		{clientID: "test", will: &Will{Topic: "test", Payload: []byte(long)}},
+		{clientID: "test", username: long},
+		{clientID: "test", username: "test", password: long},
+	} {
+		if _, err := encodeConnect(c); err != errTooLong {
+			t.Errorf("encodeConnect = %v, want %v", err, errTooLong)
+		}
+	}
+	// large payloads are not length prefixed
+	if _, err := encodePublish("test", []byte(long), 0, false, 0); err != nil {
+		t.Errorf("encodePublish with long payload = %v", err)
+	}
+}
+
+func TestDialNotAuthorized(t *testing.T) {
+	broker, err := mqtttest.Start(mqtttest.Config{Username: "weather", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer broker.Close()
+
+	_, err = Dial(context.Background(), Options{Broker: broker.Addr(), Username: "weather", Password: "wrong"}, nil)
+	if err != ErrNotAuthorized {
+		t.Errorf("Dial with wrong password = %v, want %v", err, ErrNotAuthorized)
+	}
+}
+
+func TestPublisher(t *testing.T) {
+	unit, err := davisweathertest.Start(davisweathertest.Config{DeviceID: testDevice, BroadcastInterval: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unit.Close()
+	broker, err := mqtttest.Start(mqtttest.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer broker.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := davisweather.Unmanaged(ctx, false, unit.Host(), unit.Port(),
+		davisweather.WithHTTPStartDelay(0),
+		davisweather.WithUDPDeadline(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := New(Options{Broker: broker.Addr(), Discovery: true, RetryInterval: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		p.Run(runCtx, c)
+		close(done)
+	}()
+
+	// retained field, availability and discovery topics
+	availability := "davisweather/" + testDevice + "/availability"
+	waitFor(t, 5*time.Second, "online availability", func() bool {
+		return retained(broker, availability, "online")
+	})
+	waitFor(t, 5*time.Second, "temperature", func() bool {
+		return retained(broker, "davisweather/"+testDevice+"/temperature", "68.5")
+	})
+	var config discoveryConfig
+	if err := json.Unmarshal(broker.Retained()["homeassistant/sensor/"+testDevice+"/temperature/config"], &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.StateTopic != "davisweather/"+testDevice+"/temperature" || config.AvailabilityTopic != availability ||
+		config.DeviceClass != "temperature" || config.Unit != "°F" {
+		t.Errorf("discovery config = %+v", config)
+	}
+	sessions := broker.Sessions()
+	if len(sessions) != 1 || sessions[0].ClientID != "dw-"+testDevice || sessions[0].Will == nil ||
+		sessions[0].Will.Topic != availability || string(sessions[0].Will.Payload) != "offline" || !sessions[0].Will.Retain {
+		t.Fatalf("Sessions = %+v, want offline availability will", sessions)
+	}
+
+	// will is published when the connection is lost, then availability is
+	// restored on reconnection
+	broker.Disconnect()
+	waitFor(t, 5*time.Second, "will message", func() bool {
+		for _, msg := range broker.Messages() {
+			if msg.ClientID == "" && msg.Topic == availability && string(msg.Payload) == "offline" {
+				return true
+			}
+		}
+		return false
+	})
+	waitFor(t, 5*time.Second, "reconnection", func() bool {
+		return len(broker.Sessions()) == 2 && retained(broker, availability, "online")
+	})
+
+	// availability is set offline on return
+	stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	waitFor(t, 5*time.Second, "offline availability", func() bool {
+		return retained(broker, availability, "offline")
+	})
+}
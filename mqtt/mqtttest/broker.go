@@ -0,0 +1,354 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+// Package mqtttest provides a minimal MQTT 3.1.1 broker stand-in for testing
+// MQTT publishers without an external broker.
+//
+// The broker listens on localhost, acknowledges connections, QoS 1 publishes
+// and pings, records every published message and keeps retained messages.
+// Will messages are published when a client connection is lost without a
+// DISCONNECT. Subscriptions are not supported.
+package mqtttest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+const (
+	// packetConnect is the CONNECT packet type
+	packetConnect = 1
+	// packetPublish is the PUBLISH packet type
+	packetPublish = 3
+	// packetPingreq is the PINGREQ packet type
+	packetPingreq = 12
+	// packetDisconnect is the DISCONNECT packet type
+	packetDisconnect = 14
+
+	// connackAccepted is the CONNACK return code of an accepted connection
+	connackAccepted = 0
+	// connackNotAuthorized is the CONNACK return code of rejected credentials
+	connackNotAuthorized = 5
+)
+
+var (
+	// errClosed is returned when the broker is already closed
+	errClosed = errors.New("mqtttest: broker already closed")
+	// errMalformed is returned when a client sends a malformed packet
+	errMalformed = errors.New("mqtttest: malformed packet")
+)
+
+// Config configures the broker stand-in. The zero value accepts every
+// connection.
+type Config struct {
+	Username string // Username is the required username (optional)
+	Password string // Password is the required password (optional)
+}
+
+// Message is a published message.
+type Message struct {
+	ClientID string // ClientID is the identifier of the publishing client ("" for wills)
+	Topic    string // Topic is the topic of the message
+	Payload  []byte // Payload is the message
+	QoS      byte   // QoS is the quality of service of the message
+	Retain   bool   // Retain indicates the message is retained
+}
+
+// Session is an accepted client connection.
+type Session struct {
+	ClientID  string   // ClientID is the client identifier
+	Username  string   // Username is the provided username
+	KeepAlive int      // KeepAlive is the keep alive interval (seconds)
+	Will      *Message // Will is the will message (nil if not provided)
+}
+
+// Broker is an MQTT broker stand-in.
+type Broker struct {
+	config   Config                // config is the broker configuration
+	listener net.Listener          // listener is the TCP listener
+	conns    map[net.Conn]struct{} // conns are the open client connections
+	sessions []Session             // sessions are the accepted connections, in order
+	messages []Message             // messages are the published messages, in order
+	retained map[string][]byte     // retained are the retained payloads of each topic
+	closed   bool                  // closed indicates the broker is closed
+	wg       *sync.WaitGroup       // wg tracks the connection goroutines
+	mutex    *sync.Mutex           // mutex is for atomic broker actions
+}
+
+// Start starts a broker stand-in on localhost. It returns an error if the
+// listener cannot be created.
+func Start(config Config) (*Broker, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	b := &Broker{
+		config:   config,
+		listener: listener,
+		conns:    make(map[net.Conn]struct{}),
+		retained: make(map[string][]byte),
+		wg:       &sync.WaitGroup{},
+		mutex:    &sync.Mutex{},
+	}
+	b.wg.Add(1)
+	go b.acceptLoop()
+	return b, nil
+}
+
+// Addr returns the host:port of the broker.
+func (b *Broker) Addr() string {
+	return b.listener.Addr().String()
+}
+
+// Sessions returns the accepted connections, in order.
+func (b *Broker) Sessions() []Session {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]Session(nil), b.sessions...)
+}
+
+// Messages returns the published messages, in order.
+func (b *Broker) Messages() []Message {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]Message(nil), b.messages...)
+}
+
+// Retained returns the retained payload of each topic.
+func (b *Broker) Retained() map[string][]byte {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	retained := make(map[string][]byte, len(b.retained))
+	for topic, payload := range b.retained {
+		retained[topic] = payload
+	}
+	return retained
+}
+
+// Disconnect abruptly closes every client connection, publishing their will
+// messages, to simulate a lost connection.
+func (b *Broker) Disconnect() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for conn := range b.conns {
+		conn.Close()
+	}
+}
+
+// Close stops the broker and closes every client connection. It returns an
+// error if the broker is already closed.
+func (b *Broker) Close() error {
+	b.mutex.Lock()
+	if b.closed {
+		b.mutex.Unlock()
+		return errClosed
+	}
+	b.closed = true
+	err := b.listener.Close()
+	for conn := range b.conns {
+		conn.Close()
+	}
+	b.mutex.Unlock()
+
+	b.wg.Wait()
+	return err
+}
+
+// acceptLoop accepts client connections until the listener is closed.
+func (b *Broker) acceptLoop() {
+	defer b.wg.Done()
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		b.mutex.Lock()
+		b.conns[conn] = struct{}{}
+		b.mutex.Unlock()
+
+		b.wg.Add(1)
+		go b.serve(conn)
+	}
+}
+
+// serve handles a single client connection until it is closed.
+func (b *Broker) serve(conn net.Conn) {
+	defer b.wg.Done()
+	defer func() {
+		b.mutex.Lock()
+		delete(b.conns, conn)
+		b.mutex.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	kind, _, body, err := readPacket(reader)
+	if err != nil || kind != packetConnect {
+		return
+	}
+	session, password, err := decodeConnect(body)
+	if err != nil {
+		return
+	}
+	if b.config.Username != "" && (session.Username != b.config.Username || password != b.config.Password) {
+		conn.Write([]byte{0x20, 0x02, 0x00, connackNotAuthorized})
+		return
+	}
+	if _, err := conn.Write([]byte{0x20, 0x02, 0x00, connackAccepted}); err != nil {
+		return
+	}
+	b.mutex.Lock()
+	b.sessions = append(b.sessions, session)
+	b.mutex.Unlock()
+
+	for {
+		kind, flags, body, err := readPacket(reader)
+		if err != nil {
+			// lost connection
+			if session.Will != nil {
+				b.publish(*session.Will)
+			}
+			return
+		}
+		switch kind {
+		case packetPublish:
+			msg, id, err := decodePublish(flags, body)
+			if err != nil {
+				return
+			}
+			msg.ClientID = session.ClientID
+			b.publish(msg)
+			if msg.QoS == 1 {
+				conn.Write([]byte{0x40, 0x02, byte(id >> 8), byte(id)})
+			}
+		case packetPingreq:
+			conn.Write([]byte{0xd0, 0x00})
+		case packetDisconnect:
+			// clean disconnect discards the will
+			return
+		}
+	}
+}
+
+// publish records the message, updating the retained payload of its topic. An
+// empty retained payload removes the retained payload.
+func (b *Broker) publish(msg Message) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.messages = append(b.messages, msg)
+	if !msg.Retain {
+		return
+	}
+	if len(msg.Payload) == 0 {
+		delete(b.retained, msg.Topic)
+		return
+	}
+	b.retained[msg.Topic] = msg.Payload
+}
+
+// readPacket reads a single control packet, returning its type, flags and
+// body.
+func readPacket(r *bufio.Reader) (byte, byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	var length, multiplier int = 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, 0, nil, errMalformed
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		multiplier *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return header >> 4, header & 0x0f, body, nil
+}
+
+// decodeConnect returns the Session and password of a CONNECT packet body.
+func decodeConnect(body []byte) (Session, string, error) {
+	var s Session
+	protocol, body, err := readString(body)
+	if err != nil || protocol != "MQTT" || len(body) < 4 || body[0] != 4 {
+		return s, "", errMalformed
+	}
+	flags := body[1]
+	s.KeepAlive = int(binary.BigEndian.Uint16(body[2:4]))
+	body = body[4:]
+
+	if s.ClientID, body, err = readString(body); err != nil {
+		return s, "", err
+	}
+	if flags&0x04 != 0 {
+		will := &Message{QoS: (flags >> 3) & 0x03, Retain: flags&0x20 != 0}
+		var payload string
+		if will.Topic, body, err = readString(body); err != nil {
+			return s, "", err
+		}
+		if payload, body, err = readString(body); err != nil {
+			return s, "", err
+		}
+		will.Payload = []byte(payload)
+		s.Will = will
+	}
+	if flags&0x80 != 0 {
+		if s.Username, body, err = readString(body); err != nil {
+			return s, "", err
+		}
+	}
+	var password string
+	if flags&0x40 != 0 {
+		if password, _, err = readString(body); err != nil {
+			return s, "", err
+		}
+	}
+	return s, password, nil
+}
+
+// decodePublish returns the Message and packet ID of a PUBLISH packet.
+func decodePublish(flags byte, body []byte) (Message, uint16, error) {
+	msg := Message{QoS: (flags >> 1) & 0x03, Retain: flags&0x01 != 0}
+	topic, body, err := readString(body)
+	if err != nil {
+		return msg, 0, err
+	}
+	msg.Topic = topic
+	var id uint16
+	if msg.QoS > 0 {
+		if len(body) < 2 {
+			return msg, 0, errMalformed
+		}
+		id = binary.BigEndian.Uint16(body)
+		body = body[2:]
+	}
+	msg.Payload = append([]byte(nil), body...)
+	return msg, id, nil
+}
+
+// readString reads a length prefixed string, returning the remaining body.
+func readString(body []byte) (string, []byte, error) {
+	if len(body) < 2 {
+		return "", nil, errMalformed
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+n {
+		return "", nil, errMalformed
+	}
+	return string(body[2 : 2+n]), body[2+n:], nil
+}
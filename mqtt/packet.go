@@ -0,0 +1,223 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// packetType is the MQTT control packet type.
+type packetType byte
+
+const (
+	// packetConnect is a client request to connect to the broker
+	packetConnect packetType = 1
+	// packetConnack is the broker connect acknowledgement
+	packetConnack packetType = 2
+	// packetPublish is a publish message
+	packetPublish packetType = 3
+	// packetPuback is a QoS 1 publish acknowledgement
+	packetPuback packetType = 4
+	// packetPingreq is a client ping request
+	packetPingreq packetType = 12
+	// packetPingresp is the broker ping response
+	packetPingresp packetType = 13
+	// packetDisconnect is a client disconnect notification
+	packetDisconnect packetType = 14
+)
+
+const (
+	// protocolName is the MQTT 3.1.1 protocol name
+	protocolName = "MQTT"
+	// protocolLevel is the MQTT 3.1.1 protocol level
+	protocolLevel = 4
+	// maxRemaining is the largest encodable remaining length
+	maxRemaining = 268435455
+	// maxString is the largest length of a length prefixed string or binary
+	// data
+	maxString = 65535
+
+	// flagUsername indicates a username is present in the CONNECT payload
+	flagUsername = 0x80
+	// flagPassword indicates a password is present in the CONNECT payload
+	flagPassword = 0x40
+	// flagWillRetain indicates the will message is retained
+	flagWillRetain = 0x20
+	// flagWill indicates a will message is present in the CONNECT payload
+	flagWill = 0x04
+	// flagCleanSession requests a new session
+	flagCleanSession = 0x02
+)
+
+var (
+	// errMalformed is returned when reading a malformed packet
+	errMalformed = errors.New("mqtt: malformed packet")
+	// errTooLarge is returned when writing a packet larger than MQTT permits
+	errTooLarge = errors.New("mqtt: packet too large")
+	// errTooLong is returned when writing a string or will payload longer than
+	// MQTT permits, such as a topic over 65535 bytes
+	errTooLong = errors.New("mqtt: string too long")
+)
+
+// packet is a decoded MQTT control packet.
+type packet struct {
+	kind  packetType // kind is the control packet type
+	flags byte       // flags are the fixed header flags
+	body  []byte     // body is the variable header and payload
+}
+
+// connect is the contents of a CONNECT packet.
+type connect struct {
+	clientID  string // clientID is the client identifier
+	username  string // username is the username (optional)
+	password  string // password is the password (optional)
+	keepAlive uint16 // keepAlive is the keep alive interval (seconds)
+	will      *Will  // will is the will message (optional)
+}
+
+// readPacket reads a single control packet.
+func readPacket(r *bufio.Reader) (packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+	// remaining length is a variable length integer of up to 4 bytes
+	var length, multiplier int = 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return packet{}, errMalformed
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+		length += int(b&0x7f) * multiplier
+		multiplier *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+	return packet{kind: packetType(header >> 4), flags: header & 0x0f, body: body}, nil
+}
+
+// encode returns the packet with its fixed header.
+func (p packet) encode() ([]byte, error) {
+	length := len(p.body)
+	if length > maxRemaining {
+		return nil, errTooLarge
+	}
+	buff := []byte{byte(p.kind)<<4 | p.flags}
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		buff = append(buff, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(buff, p.body...), nil
+}
+
+// encodeConnect returns a CONNECT packet with a clean session. It returns an
+// error if a string or the will payload is too long.
+func encodeConnect(c connect) (packet, error) {
+	flags := byte(flagCleanSession)
+	if c.will != nil {
+		flags |= flagWill | (c.will.QoS&0x03)<<3
+		if c.will.Retain {
+			flags |= flagWillRetain
+		}
+	}
+	if c.username != "" {
+		flags |= flagUsername
+	}
+	if c.password != "" {
+		flags |= flagPassword
+	}
+
+	body, _ := appendString(nil, protocolName)
+	body = append(body, protocolLevel, flags)
+	body = appendUint16(body, c.keepAlive)
+	fields := [][]byte{[]byte(c.clientID)}
+	if c.will != nil {
+		fields = append(fields, []byte(c.will.Topic), c.will.Payload)
+	}
+	if c.username != "" {
+		fields = append(fields, []byte(c.username))
+	}
+	if c.password != "" {
+		fields = append(fields, []byte(c.password))
+	}
+	for _, field := range fields {
+		var err error
+		if body, err = appendBytes(body, field); err != nil {
+			return packet{}, err
+		}
+	}
+	return packet{kind: packetConnect, body: body}, nil
+}
+
+// encodePublish returns a PUBLISH packet. The packet ID is only encoded for QoS
+// 1. It returns an error if the topic is too long.
+func encodePublish(topic string, payload []byte, qos byte, retain bool, id uint16) (packet, error) {
+	flags := (qos & 0x03) << 1
+	if retain {
+		flags |= 0x01
+	}
+	body, err := appendString(nil, topic)
+	if err != nil {
+		return packet{}, err
+	}
+	if qos > 0 {
+		body = appendUint16(body, id)
+	}
+	return packet{kind: packetPublish, flags: flags, body: append(body, payload...)}, nil
+}
+
+// decodeConnack returns the return code of a CONNACK packet.
+func decodeConnack(p packet) (byte, error) {
+	if p.kind != packetConnack || len(p.body) != 2 {
+		return 0, errMalformed
+	}
+	return p.body[1], nil
+}
+
+// decodePuback returns the packet ID of a PUBACK packet.
+func decodePuback(p packet) (uint16, error) {
+	if len(p.body) != 2 {
+		return 0, errMalformed
+	}
+	return binary.BigEndian.Uint16(p.body), nil
+}
+
+// appendUint16 appends a big-endian two byte integer.
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+// appendString appends a length prefixed UTF-8 string. It returns an error if
+// the string is too long.
+func appendString(b []byte, s string) ([]byte, error) {
+	return appendBytes(b, []byte(s))
+}
+
+// appendBytes appends length prefixed binary data. It returns an error if the
+// data is too long.
+func appendBytes(b []byte, data []byte) ([]byte, error) {
+	if len(data) > maxString {
+		return nil, errTooLong
+	}
+	b = appendUint16(b, uint16(len(data)))
+	return append(b, data...), nil
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"net/http"
+	"time"
+)
+
+// Option configures a Client. Options are provided to Managed and Unmanaged.
+type Option func(*Client)
+
+// WithHTTPInterval configures how often weather conditions are polled over
+// HTTP. Non-positive durations are ignored.
+func WithHTTPInterval(d time.Duration) Option {
+	return func(c *Client) {
+		if d > 0 {
+			c.httpInterval = d
+		}
+	}
+}
+
+// WithHTTPTimeout configures the timeout of each HTTP request made to the WLL
+// unit. Non-positive durations are ignored.
+func WithHTTPTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		if d > 0 {
+			c.httpTimeout = d
+		}
+	}
+}
+
+// WithHTTPStartDelay configures how long the HTTP event loop waits before its
+// first request, allowing the UDP event loop to enable broadcasts first.
+// Negative durations are ignored.
+func WithHTTPStartDelay(d time.Duration) Option {
+	return func(c *Client) {
+		if d >= 0 {
+			c.httpStartDelay = d
+		}
+	}
+}
+
+// WithHTTPClient configures the HTTP client used for requests made to the WLL
+// unit. A nil client is ignored.
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) {
+		if h != nil {
+			c.httpClient = h
+		}
+	}
+}
+
+// WithUDPDeadline configures how long the Client waits for a UDP broadcast
+// before requesting broadcasts to be re-enabled. Non-positive durations are
+// ignored.
+func WithUDPDeadline(d time.Duration) Option {
+	return func(c *Client) {
+		if d > 0 {
+			c.udpDeadline = d
+		}
+	}
+}
+
+// WithUDPDuration configures how long UDP broadcasts are requested for. The WLL
+// unit accepts the duration in seconds. Durations under a second are ignored.
+func WithUDPDuration(d time.Duration) Option {
+	return func(c *Client) {
+		if d >= time.Second {
+			c.udpDuration = d
+		}
+	}
+}
+
+// WithUDPBufferSize configures the buffer size for reading UDP broadcasts.
+// Non-positive sizes are ignored.
+func WithUDPBufferSize(n int) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.udpBufferSize = n
+		}
+	}
+}
+
+// WithMDNSTimeout configures the timeout of each mDNS discovery attempt made by
+// the managed Client. Non-positive durations are ignored.
+func WithMDNSTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		if d > 0 {
+			c.mDNSTimeout = d
+		}
+	}
+}
+
+// WithPrimary configures the transmitter used for populating the Report fields
+// of the provided measurement.
+func WithPrimary(m Measurement, txid int) Option {
+	return func(c *Client) {
+		c.report.SetPrimary(m, txid)
+	}
+}
+
+// WithLogger configures the Logger of the Client and its Report, replacing
+// the logger selected by verbose. A nil Logger is ignored.
+func WithLogger(l Logger) Option {
+	return func(c *Client) {
+		if l != nil {
+			c.logger = l
+			c.report.SetLogger(l)
+		}
+	}
+}
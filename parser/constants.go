@@ -9,6 +9,8 @@ type RecordType int
 const (
 	// RecordISS is weather conditions from integrated sensor suite
 	RecordISS RecordType = 1
+	// RecordLeafSoil is weather conditions from leaf and soil station
+	RecordLeafSoil RecordType = 2
 	// RecordLSSBarometer is weather conditions from LSS barometer
 	RecordLSSBarometer RecordType = 3
 	// RecordLSSTempRh is weather condition from LSS temperature + humidity
@@ -21,9 +21,11 @@ type WeatherHTTP struct {
 // EntryHTTP is a union type for containing multiple types of weather
 // conditions.
 type EntryHTTP struct {
-	LogicalSensorID   *int        `json:"lsid"`                // LogicalSensorID is logical sensor ID
-	DataStructureType *RecordType `json:"data_structure_type"` // DataStructureType indicates data structure
-	Values            interface{} // Values are the weather condition values (generated)
+	LogicalSensorID   *int            `json:"lsid"`                // LogicalSensorID is logical sensor ID
+	DataStructureType *RecordType     `json:"data_structure_type"` // DataStructureType indicates data structure
+	Values            interface{}     // Values are the weather condition values (generated)
+	RawValues         json.RawMessage // RawValues is the raw weather condition entry (generated)
+	Unknown           bool            // Unknown indicates the data structure is not supported (generated)
 }
 
 // conditionHeader is used for partial weather conditions parsing.
@@ -82,6 +84,27 @@ type WeatherISS struct {
 	RainStormLastEndAt   *Time    `json:"rain_storm_last_end_at"`   // rainStormLastEndAt is time of last rain storm end
 }
 
+// WeatherLeafSoil is weather conditions from leaf and soil station.
+type WeatherLeafSoil struct {
+	TransmitterID *int `json:"txid"` // TransmitterID is ID of transmitter
+
+	SoilTemperature1 *float64 `json:"temp_1"` // SoilTemperature1 is soil temperature of slot 1 (°F)
+	SoilTemperature2 *float64 `json:"temp_2"` // SoilTemperature2 is soil temperature of slot 2 (°F)
+	SoilTemperature3 *float64 `json:"temp_3"` // SoilTemperature3 is soil temperature of slot 3 (°F)
+	SoilTemperature4 *float64 `json:"temp_4"` // SoilTemperature4 is soil temperature of slot 4 (°F)
+
+	SoilMoisture1 *float64 `json:"moist_soil_1"` // SoilMoisture1 is soil moisture of slot 1 (cb)
+	SoilMoisture2 *float64 `json:"moist_soil_2"` // SoilMoisture2 is soil moisture of slot 2 (cb)
+	SoilMoisture3 *float64 `json:"moist_soil_3"` // SoilMoisture3 is soil moisture of slot 3 (cb)
+	SoilMoisture4 *float64 `json:"moist_soil_4"` // SoilMoisture4 is soil moisture of slot 4 (cb)
+
+	LeafWetness1 *float64 `json:"wet_leaf_1"` // LeafWetness1 is leaf wetness of slot 1 (0-15)
+	LeafWetness2 *float64 `json:"wet_leaf_2"` // LeafWetness2 is leaf wetness of slot 2 (0-15)
+
+	RXState          *SignalState  `json:"rx_state"`           // RXState is leaf and soil receiver status
+	TransBatteryFlag *BatteryState `json:"trans_battery_flag"` // TransBatteryFlag is leaf and soil battery status
+}
+
 // WeatherLSSBarometer is weather conditions from LSS barometer sensor.
 type WeatherLSSBarometer struct {
 	BarometerSeaLevel *float64 `json:"bar_sea_level"` // BarometerSeaLevel is barometer reading with elevation adjustment (inches)
@@ -121,17 +144,31 @@ func (e *EntryHTTP) UnmarshalJSON(payload []byte) error {
 	// place retrieved values in main body
 	e.LogicalSensorID = c.LogicalSensorID
 	e.DataStructureType = c.DataStructureType
+	e.RawValues = append(json.RawMessage(nil), payload...)
+	e.Unknown = false
+
+	// keep raw entry if data structure is not provided
+	if c.DataStructureType == nil {
+		e.Values = nil
+		e.Unknown = true
+		return nil
+	}
 
 	// parse remaining using specified data structure
 	switch *c.DataStructureType {
 	case RecordISS:
 		e.Values = &WeatherISS{}
+	case RecordLeafSoil:
+		e.Values = &WeatherLeafSoil{}
 	case RecordLSSBarometer:
 		e.Values = &WeatherLSSBarometer{}
 	case RecordLSSTempRh:
 		e.Values = &WeatherLSSTempRh{}
 	default:
+		// unsupported data structure, keep raw entry for caller inspection
 		e.Values = nil
+		e.Unknown = true
+		return nil
 	}
 
 	// recursively parse inner values
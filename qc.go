@@ -0,0 +1,314 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"math"
+	"reflect"
+	"time"
+)
+
+const (
+	// qcStepWindow is the default duration a previous value is used for step
+	// checks
+	qcStepWindow = 10 * time.Minute
+)
+
+// QualityFlag indicates why a Report field failed quality control.
+type QualityFlag string
+
+const (
+	// QualityRange is a value outside of the plausible range
+	QualityRange QualityFlag = "range"
+	// QualitySpike is a value that changed more than the maximum step
+	QualitySpike QualityFlag = "spike"
+	// QualityStuck is a value that has not changed for too long
+	QualityStuck QualityFlag = "stuck"
+)
+
+// QCAction is the action taken on a value that fails quality control.
+type QCAction int
+
+const (
+	// QCFlag keeps the value and flags the field
+	QCFlag QCAction = 0
+	// QCReject removes the value (nil) and flags the field
+	QCReject QCAction = 1
+)
+
+// QCRule is the quality control checks of a single Report field. Each check is
+// disabled when left as the zero value.
+type QCRule struct {
+	Min        float64       // Min is the minimum plausible value (range check disabled if Min >= Max)
+	Max        float64       // Max is the maximum plausible value
+	MaxStep    float64       // MaxStep is the maximum change from the last accepted value
+	StepWindow time.Duration // StepWindow is how long the last accepted value is used for step checks (default 10 minutes)
+	StuckAfter time.Duration // StuckAfter is how long a value may remain unchanged
+	Action     QCAction      // Action is the action taken on a failed value
+}
+
+var (
+	// qcBarometerFields are the Report fields of the LSS barometer record
+	qcBarometerFields = selectFields("barometerSeaLevel", "barometerTrend", "barometerAbsolute")
+	// qcTempRhFields are the Report fields of the LSS temperature humidity record
+	qcTempRhFields = selectFields("indoorTemperature", "indoorHumidity", "indoorDewpoint", "indoorHeatIndex")
+	// floatPtrType is the type of numeric Report fields
+	floatPtrType = reflect.TypeOf((*float64)(nil))
+)
+
+// qcReport is the transmitter ID of quality control state of fields received
+// directly into the Report, such as the LSS barometer.
+const qcReport = -1
+
+// qc is the quality control stage of a Report.
+type qc struct {
+	rules  map[string]QCRule  // rules are the checks of each field (keyed by JSON name)
+	fields map[qcKey]*qcField // fields are the check state of each field of each transmitter
+}
+
+// qcKey identifies the quality control state of a field of a transmitter.
+type qcKey struct {
+	txid  int    // txid is the transmitter ID (qcReport for Report fields)
+	field string // field is the JSON name of the field
+}
+
+// qcField is the quality control state of a single Report field.
+type qcField struct {
+	raw        float64     // raw is the most recent unchecked value
+	since      time.Time   // since is when the raw value was first received
+	accepted   float64     // accepted is the most recent value passing range and step checks
+	acceptedAt time.Time   // acceptedAt is when the accepted value was received
+	flag       QualityFlag // flag is the current quality flag
+}
+
+// DefaultQCRules returns range checks rejecting values outside of the
+// specifications of the Davis sensors, which removes sentinel values (such as
+// 32767) and RF glitches. Step and stuck checks depend on the site and are not
+// included.
+func DefaultQCRules() map[string]QCRule {
+	temp := QCRule{Min: -40, Max: 150, Action: QCReject}
+	index := QCRule{Min: -100, Max: 200, Action: QCReject}
+	humidity := QCRule{Min: 0, Max: 100, Action: QCReject}
+	speed := QCRule{Min: 0, Max: 200, Action: QCReject}
+	dir := QCRule{Min: 0, Max: 360, Action: QCReject}
+	rain := QCRule{Min: 0, Max: 30000, Action: QCReject}
+	barometer := QCRule{Min: 16, Max: 32.5, Action: QCReject}
+
+	return map[string]QCRule{
+		"temperature": temp,
+		"humidity":    humidity,
+		"dewpoint":    index,
+		"wetbulb":     index,
+		"heatindex":   index,
+		"windchill":   index,
+		"thwIndex":    index,
+		"thswIndex":   index,
+
+		"windSpeedLast":          speed,
+		"windDirLast":            dir,
+		"windSpeedAvg1Min":       speed,
+		"windDirAvg1Min":         dir,
+		"windSpeedAvg2Min":       speed,
+		"windDirAvg2Min":         dir,
+		"windGustSpeedLast2Min":  speed,
+		"windGustDirLast2Min":    dir,
+		"windSpeedAvg10Min":      speed,
+		"windDirAvg10Min":        dir,
+		"windGustSpeedLast10Min": speed,
+		"windGustDirLast10Min":   dir,
+
+		"rainRateLast":          rain,
+		"rainRateHigh":          rain,
+		"rainLast15Min":         rain,
+		"rainRateHighLast15Min": rain,
+		"rainLast60Min":         rain,
+		"rainLast24Hour":        rain,
+		"rainStorm":             rain,
+
+		"solarRad": {Min: 0, Max: 1800, Action: QCReject},
+		"uvIndex":  {Min: 0, Max: 16, Action: QCReject},
+
+		"barometerSeaLevel": barometer,
+		"barometerTrend":    {Min: -1, Max: 1, Action: QCReject},
+		"barometerAbsolute": barometer,
+
+		"soilTemperature1": temp,
+		"soilTemperature2": temp,
+		"soilTemperature3": temp,
+		"soilTemperature4": temp,
+		"soilMoisture1":    {Min: 0, Max: 200, Action: QCReject},
+		"soilMoisture2":    {Min: 0, Max: 200, Action: QCReject},
+		"soilMoisture3":    {Min: 0, Max: 200, Action: QCReject},
+		"soilMoisture4":    {Min: 0, Max: 200, Action: QCReject},
+		"leafWetness1":     {Min: 0, Max: 15, Action: QCReject},
+		"leafWetness2":     {Min: 0, Max: 15, Action: QCReject},
+
+		"indoorTemperature": temp,
+		"indoorHumidity":    humidity,
+		"indoorDewpoint":    index,
+		"indoorHeatIndex":   index,
+	}
+}
+
+// SetQC configures quality control of the numeric Report fields, keyed by JSON
+// name (see DefaultQCRules). The conditions of each transmitter are checked as
+// they are received, before they are stored in Sensors. Failed fields are
+// listed in the Quality field of the Sensor and, for the primary transmitter
+// of each measurement, of the Report. Rules of unknown fields are ignored, and
+// nil rules disable quality control.
+func (r *Report) SetQC(rules map[string]QCRule) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.Quality = nil
+	for _, s := range r.Sensors {
+		s.Quality = nil
+	}
+	if len(rules) == 0 {
+		r.qc = nil
+		return
+	}
+	r.qc = &qc{
+		rules:  make(map[string]QCRule, len(rules)),
+		fields: make(map[qcKey]*qcField),
+	}
+	for name, rule := range rules {
+		if rule.StepWindow <= 0 {
+			rule.StepWindow = qcStepWindow
+		}
+		r.qc.rules[name] = rule
+	}
+}
+
+// WithQC configures quality control of the numeric Report fields, see SetQC.
+func WithQC(rules map[string]QCRule) Option {
+	return func(c *Client) {
+		c.report.SetQC(rules)
+	}
+}
+
+// checkFields checks the numeric fields of the struct received from the
+// transmitter at the provided time, rejecting values according to the rules.
+// It returns the flags of the failed fields, or nil if every field passes.
+func (r *Report) checkFields(txid int, v reflect.Value, fields []reportField, now time.Time) map[string]QualityFlag {
+	if r.qc == nil {
+		return nil
+	}
+	var quality map[string]QualityFlag
+	for _, f := range fields {
+		rule, ok := r.qc.rules[f.name]
+		if !ok {
+			continue
+		}
+		field := v.Field(f.index)
+		if field.Type() != floatPtrType {
+			continue
+		}
+		key := qcKey{txid: txid, field: f.name}
+		state, ok := r.qc.fields[key]
+
+		flag := QualityFlag("")
+		if field.IsNil() {
+			// retain flag of rejected values until a new value is received
+			if ok && rule.Action == QCReject {
+				flag = state.flag
+			}
+		} else {
+			value := field.Elem().Float()
+			if !ok {
+				state = &qcField{raw: value, since: now}
+				r.qc.fields[key] = state
+			}
+			flag = state.check(rule, value, now)
+			if flag != state.flag && flag != "" {
+				r.logger.Log(LevelInfo, "quality check failed", LogComponent, "qc", LogDevice, r.DeviceID,
+					"transmitter", txid, "field", f.name, "flag", flag, "value", value)
+			}
+			state.flag = flag
+			if flag != "" && rule.Action == QCReject {
+				field.Set(reflect.Zero(floatPtrType))
+			}
+		}
+		if flag == "" {
+			continue
+		}
+		if quality == nil {
+			quality = make(map[string]QualityFlag)
+		}
+		quality[f.name] = flag
+	}
+	return quality
+}
+
+// checkSensor checks the numeric Sensor fields received at the provided time,
+// updating the Quality field of the Sensor.
+func (r *Report) checkSensor(s *Sensor, now time.Time) {
+	s.Quality = r.checkFields(s.TransmitterID, reflect.ValueOf(s).Elem(), sensorFields, now)
+}
+
+// checkReport checks the provided Report fields, which are received directly
+// from the WLL unit, at the provided time.
+func (r *Report) checkReport(fields []reportField, now time.Time) {
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.name
+	}
+	r.syncQuality(r.checkFields(qcReport, reflect.ValueOf(r).Elem(), fields, now), names...)
+}
+
+// selectFields returns the Report fields with the provided JSON names.
+func selectFields(names ...string) []reportField {
+	var fields []reportField
+	for _, f := range reportFields {
+		for _, name := range names {
+			if f.name == name {
+				fields = append(fields, f)
+			}
+		}
+	}
+	return fields
+}
+
+// syncQuality replaces the Quality flags of the provided Report fields.
+func (r *Report) syncQuality(flags map[string]QualityFlag, names ...string) {
+	for _, name := range names {
+		delete(r.Quality, name)
+		flag, ok := flags[name]
+		if !ok {
+			continue
+		}
+		if r.Quality == nil {
+			r.Quality = make(map[string]QualityFlag)
+		}
+		r.Quality[name] = flag
+	}
+	if len(r.Quality) == 0 {
+		r.Quality = nil
+	}
+}
+
+// check returns the quality flag of the value received at the provided time,
+// or an empty flag if the value passes every check.
+func (s *qcField) check(rule QCRule, value float64, now time.Time) QualityFlag {
+	// track how long the value has been unchanged
+	if value != s.raw {
+		s.raw = value
+		s.since = now
+	}
+
+	if rule.Min < rule.Max && (value < rule.Min || value > rule.Max || math.IsNaN(value)) {
+		return QualityRange
+	}
+	if rule.MaxStep > 0 && !s.acceptedAt.IsZero() && now.Sub(s.acceptedAt) <= rule.StepWindow &&
+		math.Abs(value-s.accepted) > rule.MaxStep {
+		return QualitySpike
+	}
+	s.accepted = value
+	s.acceptedAt = now
+
+	if rule.StuckAfter > 0 && now.Sub(s.since) >= rule.StuckAfter {
+		return QualityStuck
+	}
+	return ""
+}
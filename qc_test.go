@@ -0,0 +1,84 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/tannerryan/davisweather/parser"
+)
+
+// updateHTTP applies the HTTP conditions payload to the Report.
+func updateHTTP(t *testing.T, r *Report, payload string) {
+	t.Helper()
+	c, err := parser.ParseHTTP([]byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.UpdateHTTP(c); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// conditionsISS returns an HTTP conditions payload with an ISS record of the
+// transmitter.
+func conditionsISS(ts int, txid int, temp string, hum string) string {
+	return fmt.Sprintf(`{"data":{"did":"001D0A700002","ts":%d,"conditions":[{"lsid":%d,
+		"data_structure_type":1,"txid":%d,"temp":%s,"hum":%s,"wind_speed_last":4,"wind_dir_last":90,
+		"rx_state":0,"trans_battery_flag":0}]},"error":null}`, ts, 48300+txid, txid, temp, hum)
+}
+
+// issKey returns the SensorKey of the ISS record of conditionsISS.
+func issKey(txid int) SensorKey {
+	return SensorKey{LogicalSensorID: 48300 + txid, TransmitterID: txid}
+}
+
+func TestQCReject(t *testing.T) {
+	r, _ := NewReport(false)
+	r.SetQC(DefaultQCRules())
+
+	updateHTTP(t, r, conditionsISS(1592400000, 1, "32767", "55"))
+	if r.Temperature != nil || r.Sensors[issKey(1)].Temperature != nil {
+		t.Errorf("Temperature = %v, Sensor = %v, want rejected", r.Temperature, r.Sensors[issKey(1)].Temperature)
+	}
+	if r.Quality["temperature"] != QualityRange || r.Sensors[issKey(1)].Quality["temperature"] != QualityRange {
+		t.Errorf("Quality = %v, Sensor = %v, want temperature range", r.Quality, r.Sensors[issKey(1)].Quality)
+	}
+	if r.Humidity == nil || *r.Humidity != 55 {
+		t.Errorf("Humidity = %v, want 55", r.Humidity)
+	}
+
+	// rejected UDP values never reach the Sensor
+	updateUDP(t, r, `{"did":"001D0A700002","ts":1592400002,"conditions":[{"lsid":48301,"txid":1,
+		"wind_speed_last":5,"wind_dir_last":400}]}`)
+	if r.WindDirLast != nil || r.Sensors[issKey(1)].WindDirLast != nil {
+		t.Errorf("WindDirLast = %v, Sensor = %v, want rejected", r.WindDirLast, r.Sensors[issKey(1)].WindDirLast)
+	}
+	if r.Quality["windDirLast"] != QualityRange || r.Quality["temperature"] != QualityRange {
+		t.Errorf("Quality = %v, want windDirLast and temperature range", r.Quality)
+	}
+
+	updateHTTP(t, r, conditionsISS(1592400010, 1, "70.5", "55"))
+	if r.Temperature == nil || *r.Temperature != 70.5 || r.Quality["temperature"] != "" {
+		t.Errorf("Temperature = %v, Quality = %v, want accepted", r.Temperature, r.Quality)
+	}
+}
+
+func TestQCSpike(t *testing.T) {
+	r, _ := NewReport(false)
+	r.SetQC(map[string]QCRule{
+		"temperature": {MaxStep: 5, Action: QCFlag},
+	})
+
+	updateHTTP(t, r, conditionsISS(1592400000, 1, "70", "55"))
+	updateHTTP(t, r, conditionsISS(1592400010, 1, "90", "55"))
+	if r.Temperature == nil || *r.Temperature != 90 || r.Quality["temperature"] != QualitySpike {
+		t.Errorf("Temperature = %v, Quality = %v, want flagged spike", r.Temperature, r.Quality)
+	}
+	updateHTTP(t, r, conditionsISS(1592400020, 1, "71", "55"))
+	if r.Quality != nil {
+		t.Errorf("Quality = %v, want nil", r.Quality)
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"errors"
+
+	"github.com/tannerryan/davisweather/units"
+)
+
+var (
+	// ErrRainSizeMissing is returned when the Report has no RainSize
+	ErrRainSizeMissing = errors.New("davisweather: rain collector size not provided")
+	// ErrRainSizeUnknown is returned when the Report RainSize is not supported
+	ErrRainSizeUnknown = errors.New("davisweather: unknown rain collector size")
+	// ErrRainCountMissing is returned when the requested rain count is not provided
+	ErrRainCountMissing = errors.New("davisweather: rain count not provided")
+	// errRainField is returned when the requested rain field does not exist
+	errRainField = errors.New("davisweather: unknown rain field")
+)
+
+const (
+	// rainDepthPrecision is the decimal places of rain depths (0.000001"), which
+	// keeps a single count of every collector exact to well below its resolution
+	// while removing floating point artifacts
+	rainDepthPrecision = 6
+)
+
+// RainCollector indicates the size of the rain collector (RainSize).
+type RainCollector int
+
+const (
+	// RainCollector001in is a 0.01" rain collector
+	RainCollector001in RainCollector = 1
+	// RainCollector02mm is a 0.2 mm rain collector
+	RainCollector02mm RainCollector = 2
+	// RainCollector01mm is a 0.1 mm rain collector
+	RainCollector01mm RainCollector = 3
+	// RainCollector0001in is a 0.001" rain collector
+	RainCollector0001in RainCollector = 4
+)
+
+// Depth is a rain depth (inches).
+type Depth float64
+
+// Inches returns the depth in inches.
+func (d Depth) Inches() float64 {
+	return float64(d)
+}
+
+// Millimetres returns the depth in millimetres.
+func (d Depth) Millimetres() float64 {
+	return units.Millimetres.FromInches(float64(d))
+}
+
+// In returns the depth in the provided unit.
+func (d Depth) In(u units.Length) float64 {
+	return u.FromInches(float64(d))
+}
+
+// RainField is a Report rain count field, named by its JSON name.
+type RainField string
+
+const (
+	// RainFieldRateLast is the most recent rain rate (depth/hour)
+	RainFieldRateLast RainField = "rainRateLast"
+	// RainFieldRateHigh is the highest rain rate over last minute (depth/hour)
+	RainFieldRateHigh RainField = "rainRateHigh"
+	// RainFieldLast15Min is the rain in last 15 minutes
+	RainFieldLast15Min RainField = "rainLast15Min"
+	// RainFieldRateHighLast15Min is the highest rain rate over last 15 minutes (depth/hour)
+	RainFieldRateHighLast15Min RainField = "rainRateHighLast15Min"
+	// RainFieldLast60Min is the rain over last 60 minutes
+	RainFieldLast60Min RainField = "rainLast60Min"
+	// RainFieldLast24Hour is the rain over last 24 hours
+	RainFieldLast24Hour RainField = "rainLast24Hour"
+	// RainFieldStorm is the rain since last 24 hour break in rain
+	RainFieldStorm RainField = "rainStorm"
+	// RainFieldDaily is the total rain since midnight
+	RainFieldDaily RainField = "rainDaily"
+	// RainFieldMonthly is the total rain since first of month
+	RainFieldMonthly RainField = "rainMonthly"
+	// RainFieldYear is the total rain since first of year
+	RainFieldYear RainField = "rainYear"
+	// RainFieldStormLast is the rain of the last rain storm
+	RainFieldStormLast RainField = "rainStormLast"
+)
+
+// RainDepths are the Report rain counts converted to depths using the
+// RainSize.
+type RainDepths struct {
+	RainRateLast          *float64 `json:"rainRateLast"`          // RainRateLast is most recent rain rate (in/hour)
+	RainRateHigh          *float64 `json:"rainRateHigh"`          // RainRateHigh is highest rain rate over last minute (in/hour)
+	RainLast15Min         *float64 `json:"rainLast15Min"`         // RainLast15Min is rain in last 15 minutes (in)
+	RainRateHighLast15Min *float64 `json:"rainRateHighLast15Min"` // RainRateHighLast15Min is highest rain rate over last 15 minutes (in/hour)
+	RainLast60Min         *float64 `json:"rainLast60Min"`         // RainLast60Min is rain over last 60 minutes (in)
+	RainLast24Hour        *float64 `json:"rainLast24Hour"`        // RainLast24Hour is rain over last 24 hours (in)
+	RainStorm             *float64 `json:"rainStorm"`             // RainStorm is rain since last 24 hour break in rain (in)
+	RainfallDaily         *float64 `json:"rainDaily"`             // RainfallDaily is total rain since midnight (in)
+	RainfallMonthly       *float64 `json:"rainMonthly"`           // RainfallMonthly is total rain since first of month (in)
+	RainfallYear          *float64 `json:"rainYear"`              // RainfallYear is total rain since first of year (in)
+	RainStormLast         *float64 `json:"rainStormLast"`         // RainStormLast is rain of the last rain storm (in)
+}
+
+// Depth returns the depth of a single count of the rain collector. It returns
+// ErrRainSizeUnknown if the rain collector is not supported.
+func (c RainCollector) Depth() (Depth, error) {
+	switch c {
+	case RainCollector001in:
+		return 0.01, nil
+	case RainCollector02mm:
+		return Depth(units.Inches.FromMillimetres(0.2)), nil
+	case RainCollector01mm:
+		return Depth(units.Inches.FromMillimetres(0.1)), nil
+	case RainCollector0001in:
+		return 0.001, nil
+	}
+	return 0, ErrRainSizeUnknown
+}
+
+// RainCollector returns the rain collector of the Report. It returns
+// ErrRainSizeMissing if the RainSize is not provided, or ErrRainSizeUnknown if
+// the RainSize is not supported.
+func (r *Report) RainCollector() (RainCollector, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return rainCollector(r.RainSize)
+}
+
+// RainDepth returns the depth of the provided rain field, computed from the
+// RainSize and rounded to 0.000001" like the RainDepths. Rates are returned as
+// depth per hour. It returns
+// ErrRainSizeMissing or ErrRainSizeUnknown if the RainSize cannot be used, or
+// ErrRainCountMissing if the rain field is not provided.
+func (r *Report) RainDepth(f RainField) (Depth, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	c, err := rainCollector(r.RainSize)
+	if err != nil {
+		return 0, err
+	}
+	size, err := c.Depth()
+	if err != nil {
+		return 0, err
+	}
+	count, err := r.rainCount(f)
+	if err != nil {
+		return 0, err
+	}
+	if count == nil {
+		return 0, ErrRainCountMissing
+	}
+	return Depth(units.Round(*count*float64(size), rainDepthPrecision)), nil
+}
+
+// SetRainDepth enables or disables the RainDepths field of the Report, which
+// contains the rain counts converted to depths (inches) when the RainSize is
+// supported.
+func (r *Report) SetRainDepth(enabled bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.rainDepth = enabled
+	if !enabled {
+		r.RainDepths = nil
+	}
+}
+
+// WithRainDepth enables the RainDepths field of the Report.
+func WithRainDepth() Option {
+	return func(c *Client) {
+		c.report.SetRainDepth(true)
+	}
+}
+
+// rainCollector returns the rain collector of the provided RainSize.
+func rainCollector(size *float64) (RainCollector, error) {
+	if size == nil {
+		return 0, ErrRainSizeMissing
+	}
+	c := RainCollector(*size)
+	if float64(c) != *size {
+		return 0, ErrRainSizeUnknown
+	}
+	if _, err := c.Depth(); err != nil {
+		return 0, err
+	}
+	return c, nil
+}
+
+// rainCount returns the rain count of the provided rain field.
+func (r *Report) rainCount(f RainField) (*float64, error) {
+	switch f {
+	case RainFieldRateLast:
+		return r.RainRateLast, nil
+	case RainFieldRateHigh:
+		return r.RainRateHigh, nil
+	case RainFieldLast15Min:
+		return r.RainLast15Min, nil
+	case RainFieldRateHighLast15Min:
+		return r.RainRateHighLast15Min, nil
+	case RainFieldLast60Min:
+		return r.RainLast60Min, nil
+	case RainFieldLast24Hour:
+		return r.RainLast24Hour, nil
+	case RainFieldStorm:
+		return r.RainStorm, nil
+	case RainFieldDaily:
+		return r.RainfallDaily, nil
+	case RainFieldMonthly:
+		return r.RainfallMonthly, nil
+	case RainFieldYear:
+		return r.RainfallYear, nil
+	case RainFieldStormLast:
+		return r.RainStormLast, nil
+	}
+	return nil, errRainField
+}
+
+// processRainDepth synchronizes the RainDepths field with the rain counts, if
+// enabled. The RainDepths are nil if the RainSize cannot be used.
+func (r *Report) processRainDepth() {
+	r.RainDepths = nil
+	if !r.rainDepth {
+		return
+	}
+	c, err := rainCollector(r.RainSize)
+	if err != nil {
+		return
+	}
+	size, _ := c.Depth()
+	depth := func(count *float64) *float64 {
+		return convert(count, func(v float64) float64 {
+			return v * float64(size)
+		}, rainDepthPrecision)
+	}
+	r.RainDepths = &RainDepths{
+		RainRateLast:          depth(r.RainRateLast),
+		RainRateHigh:          depth(r.RainRateHigh),
+		RainLast15Min:         depth(r.RainLast15Min),
+		RainRateHighLast15Min: depth(r.RainRateHighLast15Min),
+		RainLast60Min:         depth(r.RainLast60Min),
+		RainLast24Hour:        depth(r.RainLast24Hour),
+		RainStorm:             depth(r.RainStorm),
+		RainfallDaily:         depth(r.RainfallDaily),
+		RainfallMonthly:       depth(r.RainfallMonthly),
+		RainfallYear:          depth(r.RainfallYear),
+		RainStormLast:         depth(r.RainStormLast),
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRainDepth(t *testing.T) {
+	for _, test := range []struct {
+		size  RainCollector
+		count float64
+		want  float64
+	}{
+		{RainCollector001in, 3, 0.03},
+		{RainCollector02mm, 3, 0.023622},
+		{RainCollector01mm, 1, 0.003937},
+		{RainCollector01mm, 3, 0.011811},
+		{RainCollector0001in, 3, 0.003},
+	} {
+		r, _ := NewReport(false)
+		r.SetRainDepth(true)
+		if err := r.UpdateJSON([]byte(fmt.Sprintf(`{"rainSize":%d,"rainDaily":%v,"rainRateLast":%v}`, test.size, test.count, test.count))); err != nil {
+			t.Fatal(err)
+		}
+		depth, err := r.RainDepth(RainFieldDaily)
+		if err != nil || depth.Inches() != test.want {
+			t.Errorf("collector %d RainDepth(%v) = %v, %v, want %v", test.size, test.count, depth, err, test.want)
+		}
+		// RainDepths agree with RainDepth
+		if r.RainDepths == nil || r.RainDepths.RainfallDaily == nil || *r.RainDepths.RainfallDaily != test.want {
+			t.Errorf("collector %d RainDepths = %+v, want %v", test.size, r.RainDepths, test.want)
+		} else if *r.RainDepths.RainRateLast != test.want || r.RainDepths.RainfallYear != nil {
+			t.Errorf("collector %d RainDepths = %+v", test.size, r.RainDepths)
+		}
+	}
+}
+
+func TestRainDepthErrors(t *testing.T) {
+	for _, test := range []struct {
+		payload string
+		want    error
+	}{
+		{`{"rainDaily":3}`, ErrRainSizeMissing},
+		{`{"rainSize":5,"rainDaily":3}`, ErrRainSizeUnknown},
+		{`{"rainSize":1.5,"rainDaily":3}`, ErrRainSizeUnknown},
+		{`{"rainSize":1}`, ErrRainCountMissing},
+	} {
+		r, _ := NewReport(false)
+		r.SetRainDepth(true)
+		if err := r.UpdateJSON([]byte(test.payload)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.RainDepth(RainFieldDaily); err != test.want {
+			t.Errorf("RainDepth of %s = %v, want %v", test.payload, err, test.want)
+		}
+	}
+
+	r, _ := NewReport(false)
+	if _, err := r.RainDepth("rainHourly"); err != ErrRainSizeMissing {
+		t.Errorf("RainDepth without RainSize = %v, want %v", err, ErrRainSizeMissing)
+	}
+	r.UpdateJSON([]byte(`{"rainSize":1}`))
+	if _, err := r.RainDepth("rainHourly"); err != errRainField {
+		t.Errorf("RainDepth of unknown field = %v, want %v", err, errRainField)
+	}
+	if r.RainDepths != nil {
+		t.Errorf("RainDepths = %+v, want disabled", r.RainDepths)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tannerryan/davisweather/parser"
+)
+
+var (
+	// errUnknownMethod is returned when a Frame has an unsupported method
+	errUnknownMethod = errors.New("davisweather: unsupported frame method")
+)
+
+// Frame is a raw payload received from the WLL unit.
+type Frame struct {
+	Time    time.Time           `json:"time"`    // Time is when the payload was received
+	Source  string              `json:"source"`  // Source is the address of the sender
+	Method  parser.UpdateMethod `json:"method"`  // Method is how the payload was received
+	Payload []byte              `json:"payload"` // Payload is the raw payload
+}
+
+// Recorder records raw payloads received from the WLL unit.
+type Recorder interface {
+	Record(f Frame) error
+}
+
+// FileRecorder is a Recorder that appends each Frame as a line of JSON.
+type FileRecorder struct {
+	writer io.Writer   // writer is the recording destination
+	closer io.Closer   // closer closes the destination (nil if not owned)
+	mutex  *sync.Mutex // mutex is for atomic recorder actions
+}
+
+// NewRecorder returns a FileRecorder appending frames to the provided writer.
+func NewRecorder(w io.Writer) *FileRecorder {
+	return &FileRecorder{writer: w, mutex: &sync.Mutex{}}
+}
+
+// OpenRecorder returns a FileRecorder appending frames to the file at the
+// provided path, creating it if it does not exist. It returns an error if the
+// file cannot be opened.
+func OpenRecorder(path string) (*FileRecorder, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileRecorder{writer: f, closer: f, mutex: &sync.Mutex{}}, nil
+}
+
+// Record appends the Frame as a single write. It returns an error if the write
+// fails.
+func (r *FileRecorder) Record(f Frame) error {
+	line, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, err = r.writer.Write(line)
+	return err
+}
+
+// Close closes the recording file. It does nothing if the FileRecorder was
+// created with NewRecorder.
+func (r *FileRecorder) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// WithRecorder configures a Recorder receiving every raw payload received from
+// the WLL unit, before it is parsed.
+func WithRecorder(rec Recorder) Option {
+	return func(c *Client) {
+		c.recorder = rec
+	}
+}
+
+// record sends the raw payload to the Recorder, if configured.
+func (c *Client) record(method parser.UpdateMethod, source string, payload []byte) {
+	if c.recorder == nil {
+		return
+	}
+	f := Frame{
+		Time:    time.Now(),
+		Source:  source,
+		Method:  method,
+		Payload: append([]byte(nil), payload...),
+	}
+	if err := c.recorder.Record(f); err != nil {
+		c.log(LevelWarn, "recorder", "failed to record payload", LogMethod, method, LogError, err)
+	}
+}
+
+// Replay returns a Client updated from a recording of frames instead of a WLL
+// unit. Frames are replayed with their recorded spacing divided by the speed;
+// a speed of 0 replays every frame without delay. The Client is closed when
+// the recording ends or the context is cancelled. Verbose enables Client
+// logging, unless a Logger is provided in the options.
+func Replay(ctx context.Context, verbose bool, recording io.Reader, speed float64, opts ...Option) *Client {
+	c := newClient(verbose, DiscoveryDisabled, opts)
+	c.health.status.Address = "replay"
+	c.log(LevelInfo, "replay", "replay client initialized", "speed", speed)
+
+	// replay context to stop archiving when the recording ends
+	replayCtx, replayDone := context.WithCancel(ctx)
+
+	c.wg.Add(1)
+	go c.replayLoop(replayCtx, replayDone, recording, speed)
+	c.startArchive(replayCtx)
+	return c
+}
+
+// replayLoop updates the Report state with each Frame of the recording,
+// calling done once the replay ends.
+func (c *Client) replayLoop(ctx context.Context, done context.CancelFunc, recording io.Reader, speed float64) {
+	// goroutine monitoring
+	defer c.wg.Done()
+	defer done()
+
+	decoder := json.NewDecoder(recording)
+	var previous time.Time
+	for {
+		var f Frame
+		err := decoder.Decode(&f)
+		if err == io.EOF {
+			c.log(LevelInfo, "replay", "recording complete")
+			return
+		}
+		if err != nil {
+			c.log(LevelError, "replay", "failed to decode recording", LogError, err)
+			return
+		}
+
+		// wait for recorded spacing
+		if speed > 0 && !previous.IsZero() && f.Time.After(previous) {
+			delay := time.Duration(float64(f.Time.Sub(previous)) / speed)
+			select {
+			case <-ctx.Done():
+				c.log(LevelInfo, "replay", "terminating replay")
+				return
+			case <-time.After(delay):
+			}
+		} else {
+			select {
+			case <-ctx.Done():
+				c.log(LevelInfo, "replay", "terminating replay")
+				return
+			default:
+			}
+		}
+		previous = f.Time
+
+		err = c.replayFrame(f)
+		if err != nil {
+			c.log(LevelWarn, "replay", "failed to replay frame", LogMethod, f.Method, LogError, err)
+		}
+		switch f.Method {
+		case parser.UpdateHTTP:
+			c.recordHTTP(err)
+		case parser.UpdateUDP:
+			c.recordUDP(err)
+		}
+	}
+}
+
+// replayFrame parses the Frame and updates the Report state. It returns an
+// error if the Frame cannot be parsed or the update fails.
+func (c *Client) replayFrame(f Frame) error {
+	switch f.Method {
+	case parser.UpdateHTTP:
+		conditions, err := parser.ParseHTTP(f.Payload)
+		if err != nil {
+			return err
+		}
+		return c.report.UpdateHTTP(conditions)
+	case parser.UpdateUDP:
+		conditions, err := parser.ParseUDP(f.Payload)
+		if err != nil {
+			return err
+		}
+		return c.report.UpdateUDP(conditions)
+	case parser.UpdateJSON:
+		return c.report.UpdateJSON(f.Payload)
+	}
+	return errUnknownMethod
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/davisweather/davisweathertest"
+	"github.com/tannerryan/davisweather/parser"
+)
+
+// waitFor polls the condition until it is true or the timeout expires.
+func waitFor(t *testing.T, timeout time.Duration, msg string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for " + msg)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// reportJSON returns the JSON encoding of the Report of the Client.
+func reportJSON(t *testing.T, c *Client) string {
+	t.Helper()
+	r, err := c.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRecordReplay(t *testing.T) {
+	// accelerated day changes the conditions with every broadcast
+	unit, err := davisweathertest.Start(davisweathertest.Config{
+		DeviceID:          "001D0A700001",
+		BroadcastInterval: 100 * time.Millisecond,
+		Scenario:          davisweathertest.Diurnal(davisweathertest.Typical, time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unit.Close()
+
+	var recording bytes.Buffer
+	ctx, cancel := context.WithCancel(context.Background())
+	c, err := Unmanaged(ctx, false, unit.Host(), unit.Port(),
+		WithHTTPStartDelay(0),
+		WithHTTPInterval(200*time.Millisecond),
+		WithUDPDeadline(time.Second),
+		WithRecorder(NewRecorder(&recording)))
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	waitFor(t, 10*time.Second, "HTTP and UDP updates", func() bool {
+		status := c.Status()
+		return !status.LastHTTP.IsZero() && !status.LastUDP.IsZero()
+	})
+	cancel()
+	c.Closed()
+	want := reportJSON(t, c)
+
+	// every recorded Frame is a received payload
+	methods := make(map[parser.UpdateMethod]int)
+	decoder := json.NewDecoder(bytes.NewReader(recording.Bytes()))
+	for decoder.More() {
+		var f Frame
+		if err := decoder.Decode(&f); err != nil {
+			t.Fatal(err)
+		}
+		if f.Time.IsZero() || f.Source == "" || len(f.Payload) == 0 {
+			t.Errorf("recorded Frame = %+v", f)
+		}
+		methods[f.Method]++
+	}
+	if methods[parser.UpdateHTTP] == 0 || methods[parser.UpdateUDP] == 0 {
+		t.Fatalf("recorded methods = %v, want http and udp", methods)
+	}
+
+	// replayed Client reaches the recorded Report state
+	replayed := Replay(context.Background(), false, &recording, 0)
+	replayed.Closed()
+	if got := reportJSON(t, replayed); got != want {
+		t.Errorf("replayed Report =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestOpenRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "recording")
+
+	// reopened recording is appended to
+	frame := Frame{
+		Time:    time.Date(2020, 6, 16, 12, 0, 0, 0, time.UTC),
+		Source:  "test",
+		Method:  parser.UpdateJSON,
+		Payload: []byte(`{"temperature":70.1,"signal":"Synced","battery":"Nominal"}`),
+	}
+	for i := 0; i < 2; i++ {
+		rec, err := OpenRecorder(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rec.Record(frame); err != nil {
+			t.Fatal(err)
+		}
+		if err := rec.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	replayed := Replay(context.Background(), false, f, 0)
+	replayed.Closed()
+	r, err := replayed.Report()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Temperature == nil || *r.Temperature != 70.1 {
+		t.Errorf("replayed Temperature = %v, want 70.1", r.Temperature)
+	}
+	if status := replayed.Status(); status.Address != "replay" {
+		t.Errorf("replayed Status = %+v", status)
+	}
+}
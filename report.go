@@ -11,10 +11,12 @@ import (
 	"encoding/json"
 	"errors"
 	"io/ioutil"
-	"log"
 	"sync"
 	"time"
 
+	"github.com/tannerryan/davisweather/archive"
+	"github.com/tannerryan/davisweather/derived"
+	"github.com/tannerryan/davisweather/history"
 	"github.com/tannerryan/davisweather/parser"
 )
 
@@ -72,28 +74,66 @@ type Report struct {
 	BarometerTrend    *float64 `json:"barometerTrend"`    // BarometerTrend is 3 hour barometric trend (inches)
 	BarometerAbsolute *float64 `json:"barometerAbsolute"` // BarometerAbsolute is barometer reading at current elevation (inches)
 
+	SoilTemperature1 *float64 `json:"soilTemperature1"` // SoilTemperature1 is soil temperature of slot 1 (°F)
+	SoilTemperature2 *float64 `json:"soilTemperature2"` // SoilTemperature2 is soil temperature of slot 2 (°F)
+	SoilTemperature3 *float64 `json:"soilTemperature3"` // SoilTemperature3 is soil temperature of slot 3 (°F)
+	SoilTemperature4 *float64 `json:"soilTemperature4"` // SoilTemperature4 is soil temperature of slot 4 (°F)
+	SoilMoisture1    *float64 `json:"soilMoisture1"`    // SoilMoisture1 is soil moisture of slot 1 (cb)
+	SoilMoisture2    *float64 `json:"soilMoisture2"`    // SoilMoisture2 is soil moisture of slot 2 (cb)
+	SoilMoisture3    *float64 `json:"soilMoisture3"`    // SoilMoisture3 is soil moisture of slot 3 (cb)
+	SoilMoisture4    *float64 `json:"soilMoisture4"`    // SoilMoisture4 is soil moisture of slot 4 (cb)
+	LeafWetness1     *float64 `json:"leafWetness1"`     // LeafWetness1 is leaf wetness of slot 1 (0-15)
+	LeafWetness2     *float64 `json:"leafWetness2"`     // LeafWetness2 is leaf wetness of slot 2 (0-15)
+
 	TemperatureIndoor *float64 `json:"indoorTemperature"` // TemperatureIndoor is indoor temp (°F)
 	HumidityIndoor    *float64 `json:"indoorHumidity"`    // HumidityIndoor is indoor humidity (%)
 	DewPointIndoor    *float64 `json:"indoorDewpoint"`    // DewPointIndoor is indoor dewpoint (°F)
 	HeatIndexIndoor   *float64 `json:"indoorHeatIndex"`   // HeatIndexIndoor is indoor heat index (°F)
 
+	RainDepths *RainDepths            `json:"rainDepth,omitempty"` // RainDepths are the rain counts converted to depths (optional)
+	Derived    *derived.Values        `json:"derived,omitempty"`   // Derived are the meteorological quantities derived from the Report
+	ET0        *Evapotranspiration    `json:"et0,omitempty"`       // ET0 is reference evapotranspiration (requires Station)
+	Quality    map[string]QualityFlag `json:"quality,omitempty"`   // Quality are the fields failing quality control (keyed by JSON name)
+
+	Sensors map[SensorKey]*Sensor `json:"sensors"` // Sensors is the latest weather conditions of each logical sensor of each transmitter
+
 	notify       chan bool   // notify emits a boolean when the Report contents are modified
-	verbose      bool        // verbose enables Report logging to stdout
+	logger       Logger      // logger is the Report logger
 	lastChecksum string      // lastChecksum is MD5 checksum of the Report state
 	lastBytes    []byte      // lastBytes is the JSON representation of the Report state
 	mutex        *sync.Mutex // mutex is for atomic report actions
+
+	primary   map[Measurement]int               // primary is the transmitter ID used for each measurement
+	reporting map[Measurement]map[int]time.Time // reporting is when each transmitter last reported each measurement
+	broker    *broker                           // broker distributes Events to subscribers
+
+	rainDepth bool // rainDepth enables the RainDepths field
+	qc        *qc  // qc is the quality control stage (nil if disabled)
+
+	calibrations map[calibrationKey]Calibration // calibrations are the field calibrations of each transmitter
+	station      *Station                       // station is the location of the weather station (nil if not provided)
+	et           *etState                       // et is the ET0 accumulation state (nil if disabled)
+	history      *history.Store                 // history is the history of numeric fields (nil if disabled)
+	archive      archive.Store                  // archive stores every modification of the Report state (nil if disabled)
+	archiveZlib  bool                           // archiveZlib stores zlib encoded Reports instead of JSON
+	archiveQueue chan archive.Record            // archiveQueue are the Reports waiting to be archived (nil if disabled)
+
+	lastDiff []Change // lastDiff are the fields modified by the most recent update
 }
 
 // NewReport returns a new Report state and a notification channel. The channel
 // emits a bool when the Report contents have been modified. Verbose enables
-// Report logging.
+// Report logging to the standard logger, see SetLogger.
 func NewReport(verbose bool) (*Report, chan bool) {
 	r := &Report{
 		notify:       make(chan bool, 1),
-		verbose:      verbose,
+		logger:       verboseLogger(verbose),
 		lastChecksum: "",
 		lastBytes:    nil,
 		mutex:        &sync.Mutex{},
+		primary:      make(map[Measurement]int),
+		reporting:    make(map[Measurement]map[int]time.Time),
+		broker:       newBroker(),
 	}
 	return r, r.notify
 }
@@ -111,25 +151,33 @@ func (r *Report) UpdateHTTP(new *parser.ConditionsHTTP) error {
 
 	// set report header
 	r.DeviceID = new.Data.DeviceID
+	timestamp := new.Data.Timestamp.Time()
 
 	// iterate over all provided conditions, load conditions into report
 	for _, c := range new.Data.Conditions {
+		// skip unsupported data structures
+		if c.Unknown || c.DataStructureType == nil {
+			continue
+		}
 		structure := *c.DataStructureType
 
 		switch structure {
 		case parser.RecordISS:
 			v := c.Values.(*parser.WeatherISS)
-			r.processISS(v)
+			r.processISS(c.LogicalSensorID, v, timestamp)
+		case parser.RecordLeafSoil:
+			v := c.Values.(*parser.WeatherLeafSoil)
+			r.processLeafSoil(c.LogicalSensorID, v, timestamp)
 		case parser.RecordLSSBarometer:
 			v := c.Values.(*parser.WeatherLSSBarometer)
-			r.processLSSBarometer(v)
+			r.processLSSBarometer(v, timestamp)
 		case parser.RecordLSSTempRh:
 			v := c.Values.(*parser.WeatherLSSTempRh)
-			r.processLSSTempRh(v)
+			r.processLSSTempRh(v, timestamp)
 		}
 	}
 
-	return r.updateHook(parser.UpdateHTTP, new.Data.Timestamp.Time())
+	return r.updateHook(parser.UpdateHTTP, timestamp)
 }
 
 // UpdateUDP atomically updates the Report state using weather conditions
@@ -140,31 +188,21 @@ func (r *Report) UpdateUDP(new *parser.ConditionsUDP) error {
 
 	// set report header
 	r.DeviceID = new.DeviceID
+	timestamp := new.Timestamp.Time()
 
 	// iterate over all conditions, load conditions into report
-	for _, c := range new.Conditions {
-		r.WindSpeedLast = c.WindSpeedLast
-		r.WindDirLast = c.WindDirLast
-
-		r.RainSize = c.RainSize
-		r.RainRateLast = c.RainRateLast
-		r.RainLast15Min = c.RainLast15Min
-		r.RainLast60Min = c.RainLast60Min
-		r.RainLast24Hour = c.RainLast24Hour
-		r.RainStorm = c.RainStorm
-		if c.RainStormStartAt != nil {
-			t := c.RainStormStartAt.Time()
-			r.RainStormStartAt = &t
-		}
-		r.RainfallDaily = c.RainfallDaily
-		r.RainfallMonthly = c.RainfallMonthly
-		r.RainfallYear = c.RainfallYear
-
-		r.WindSpeedHighLast10Min = c.WindSpeedHighLast10Min
-		r.WindDirAtHighLast10Min = c.WindDirAtHighLast10Min
+	for i := range new.Conditions {
+		c := &new.Conditions[i]
+		s := r.sensor(c.LogicalSensorID, c.TransmitterID)
+		staged := *s
+		staged.processUDP(c)
+		r.calibrateUDP(&staged)
+		r.checkSensor(&staged, timestamp)
+		*s = staged
+		r.syncSensor(s, timestamp, MeasurementWind, MeasurementRain)
 	}
 
-	return r.updateHook(parser.UpdateUDP, new.Timestamp.Time())
+	return r.updateHook(parser.UpdateUDP, timestamp)
 }
 
 // UpdateJSON atomically updates the Report state using a provided JSON payload.
@@ -233,11 +271,26 @@ func (r *Report) UpdateJSON(payload []byte) error {
 	r.BarometerTrend = n.BarometerTrend
 	r.BarometerAbsolute = n.BarometerAbsolute
 
+	r.SoilTemperature1 = n.SoilTemperature1
+	r.SoilTemperature2 = n.SoilTemperature2
+	r.SoilTemperature3 = n.SoilTemperature3
+	r.SoilTemperature4 = n.SoilTemperature4
+	r.SoilMoisture1 = n.SoilMoisture1
+	r.SoilMoisture2 = n.SoilMoisture2
+	r.SoilMoisture3 = n.SoilMoisture3
+	r.SoilMoisture4 = n.SoilMoisture4
+	r.LeafWetness1 = n.LeafWetness1
+	r.LeafWetness2 = n.LeafWetness2
+
 	r.TemperatureIndoor = n.TemperatureIndoor
 	r.HumidityIndoor = n.HumidityIndoor
 	r.DewPointIndoor = n.DewPointIndoor
 	r.HeatIndexIndoor = n.HeatIndexIndoor
 
+	r.ET0 = n.ET0
+	r.Quality = n.Quality
+	r.Sensors = n.Sensors
+
 	return r.updateHook(parser.UpdateJSON, time.Now())
 }
 
@@ -252,9 +305,16 @@ func (r *Report) Copy() (*Report, error) {
 	if err != nil {
 		return nil, err
 	}
-	report, notify := NewReport(r.verbose)
+	return r.copyBytes(buff)
+}
+
+// copyBytes generates a new Report from the provided JSON representation of
+// the Report state, synchronizing the private variables. It returns an error if
+// the JSON representation is not valid.
+func (r *Report) copyBytes(buff []byte) (*Report, error) {
+	report, notify := NewReport(false)
 	// unmarshal buffer into report
-	err = json.Unmarshal(buff, &report)
+	err := json.Unmarshal(buff, &report)
 	if err != nil {
 		return nil, err
 	}
@@ -263,6 +323,17 @@ func (r *Report) Copy() (*Report, error) {
 	report.lastChecksum = r.lastChecksum
 	report.lastBytes = r.lastBytes
 	report.mutex = &sync.Mutex{}
+	report.logger = r.logger
+	report.rainDepth = r.rainDepth
+	for m, txid := range r.primary {
+		report.primary[m] = txid
+	}
+	for m, reporting := range r.reporting {
+		report.reporting[m] = make(map[int]time.Time, len(reporting))
+		for txid, last := range reporting {
+			report.reporting[m][txid] = last
+		}
+	}
 
 	return report, nil
 }
@@ -279,11 +350,15 @@ func (r *Report) JSON() []byte {
 func (r *Report) Encode() []byte {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
+	return encode(r.lastBytes)
+}
 
-	// stream last bytes into compressed buffer
+// encode returns the zlib encoded payload.
+func encode(payload []byte) []byte {
+	// stream payload into compressed buffer
 	var buff bytes.Buffer
 	stream := zlib.NewWriter(&buff)
-	stream.Write(r.lastBytes)
+	stream.Write(payload)
 	stream.Close()
 
 	// return compressed bytes
@@ -293,28 +368,42 @@ func (r *Report) Encode() []byte {
 // Decode updates the Report using a zlib encoded weather report. It returns an
 // error if the provided payload is not valid.
 func (r *Report) Decode(payload []byte) error {
+	report, err := decode(payload)
+	if err != nil {
+		return err
+	}
+	return r.UpdateJSON(report)
+}
+
+// decode returns the uncompressed zlib encoded payload.
+func decode(payload []byte) ([]byte, error) {
 	// uncompress data
 	buff := bytes.NewReader(payload)
 	stream, err := zlib.NewReader(buff)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer stream.Close()
 
 	// read uncompressed data
-	report, err := ioutil.ReadAll(stream)
-	if err != nil {
-		return err
-	}
-	return r.UpdateJSON(report)
+	return ioutil.ReadAll(stream)
 }
 
 // updateHook is called after UpdateHTTP, UpdateUDP, and UpdateJSON. If the
 // Report state contents have changed, it updates the lastBytes, lastChecksum,
 // and Timestamp fields, emitting a bool on the notify channel if the channel is
-// not full. If the Report state contents are not changed, nothing happens. It
-// returns an error if the Report state checksum fails.
+// not full and an Event to every subscriber. If the Report state contents are
+// not changed, nothing happens. It returns an error if the Report state
+// checksum fails.
 func (r *Report) updateHook(method parser.UpdateMethod, timestamp time.Time) error {
+	// accumulate values received from the WLL unit
+	if method != parser.UpdateJSON {
+		r.processET(timestamp)
+	}
+	// synchronize computed fields
+	r.processRainDepth()
+	r.processDerived()
+
 	// calculate checksum of latest report
 	newChecksum, _, err := r.checksum()
 	if err != nil {
@@ -326,27 +415,65 @@ func (r *Report) updateHook(method parser.UpdateMethod, timestamp time.Time) err
 	}
 	// only update internals, timestamp, and notify if new content
 	if newChecksum != r.lastChecksum {
+		// record modified fields
+		r.lastDiff = r.diffBytes(r.lastBytes)
 		// update last timestamp, last bytes and checksum
 		r.Timestamp = timestamp
 		r.lastChecksum, r.lastBytes, _ = r.checksum()
+		// restored Reports are already recorded
+		if method != parser.UpdateJSON {
+			if r.history != nil {
+				r.history.Add(timestamp, r.values())
+			}
+			r.store(timestamp)
+		}
+		r.publish(method, timestamp)
 		select {
 		case r.notify <- true: // attempt to notify
-			if r.verbose {
-				log.Println("[davisweather report] new data from", r.DeviceID, method)
-			}
+			r.logger.Log(LevelDebug, "new data", LogComponent, "report", LogDevice, r.DeviceID, LogMethod, method)
 		default: // already notified on channel
-			if r.verbose {
-				log.Println("[davisweather report] new data from", r.DeviceID, method, "(downstream pressure on Notify)")
-			}
+			r.logger.Log(LevelDebug, "new data (downstream pressure on Notify)", LogComponent, "report", LogDevice, r.DeviceID, LogMethod, method)
 		}
 		return nil
 	}
-	if r.verbose {
-		log.Println("[davisweather report] no new data from", r.DeviceID, method)
-	}
+	r.lastDiff = nil
+	r.logger.Log(LevelDebug, "no new data", LogComponent, "report", LogDevice, r.DeviceID, LogMethod, method)
 	return nil
 }
 
+// publish emits an Event describing the most recent modification of the
+// Report state to every subscriber.
+func (r *Report) publish(method parser.UpdateMethod, timestamp time.Time) {
+	if !r.broker.active() {
+		return
+	}
+	diff := r.lastDiff
+	changed := make([]string, len(diff))
+	for i, c := range diff {
+		changed[i] = c.Field
+	}
+	r.broker.publish(func() Event {
+		snapshot, _ := r.copyBytes(r.lastBytes)
+		return Event{
+			Report:    snapshot,
+			Method:    method,
+			Changed:   changed,
+			Diff:      diff,
+			Timestamp: timestamp,
+		}
+	})
+}
+
+// diffBytes returns the fields that differ between the provided JSON
+// representation of a previous Report state and the current Report state.
+func (r *Report) diffBytes(previous []byte) []Change {
+	before := &Report{}
+	if len(previous) > 0 {
+		json.Unmarshal(previous, before)
+	}
+	return before.diff(r)
+}
+
 // checksum return an MD5 checksum of the Report state and the JSON
 // representation of the Report state. It returns an error if the checksum
 // fails.
@@ -362,92 +489,58 @@ func (r *Report) checksum() (string, []byte, error) {
 }
 
 // processISS synchronizes the Report state with the provided ISS weather
-// conditions.
-func (r *Report) processISS(v *parser.WeatherISS) {
-	r.Temperature = v.Temperature
-	r.Humidity = v.Humidity
-	r.Dewpoint = v.Dewpoint
-	r.Wetbulb = v.Wetbulb
-	r.HeatIndex = v.HeatIndex
-	r.WindChill = v.WindChill
-	r.THWIndex = v.THWIndex
-	r.THSWIndex = v.THSWIndex
-
-	r.WindSpeedLast = v.WindSpeedLast
-	r.WindDirLast = v.WindDirLast
-	r.WindSpeedAvgLast1Min = v.WindSpeedAvgLast1Min
-	r.WindDirAvgLast1Min = v.WindDirAvgLast1Min
-	r.WindSpeedAvgLast2Min = v.WindSpeedAvgLast2Min
-	r.WindDirAvgLast2Min = v.WindDirAvgLast2Min
-	r.WindSpeedHighLast2Min = v.WindSpeedHighLast2Min
-	r.WindDirAtHighLast2Min = v.WindDirAtHighLast2Min
-	r.WindSpeedAvgLast10Min = v.WindSpeedAvgLast10Min
-	r.WindDirAvgLast10Min = v.WindDirAvgLast10Min
-	r.WindSpeedHighLast10Min = v.WindSpeedHighLast10Min
-	r.WindDirAtHighLast10Min = v.WindDirAtHighLast10Min
-
-	r.RainSize = v.RainSize
-	r.RainRateLast = v.RainRateLast
-	r.RainRateHigh = v.RainRateHigh
-	r.RainLast15Min = v.RainLast15Min
-	r.RainRateHighLast15Min = v.RainRateHighLast15Min
-	r.RainLast60Min = v.RainLast60Min
-	r.RainLast24Hour = v.RainLast24Hour
-	r.RainStorm = v.RainStorm
-	if v.RainStormStartAt != nil {
-		t := v.RainStormStartAt.Time()
-		r.RainStormStartAt = &t
-	}
+// conditions received at the provided time. Conditions are calibrated and
+// checked before they are stored in the Sensor.
+func (r *Report) processISS(lsid *int, v *parser.WeatherISS, now time.Time) {
+	s := r.sensor(lsid, v.TransmitterID)
+	staged := *s
+	staged.processISS(v)
+	r.calibrateISS(&staged)
+	r.checkSensor(&staged, now)
+	*s = staged
+	r.syncSensor(s, now, MeasurementTemperature, MeasurementWind, MeasurementRain, MeasurementSolar)
+}
 
-	r.SolarRad = v.SolarRad
-	r.UVIndex = v.UVIndex
-
-	if v.RXState != nil {
-		switch *v.RXState {
-		case parser.SignalSynced:
-			r.RXState = "Synced"
-		case parser.SignalRescan:
-			r.RXState = "Rescan"
-		case parser.SignalLost:
-			r.RXState = "Lost"
-		}
-	}
-	if v.TransBatteryFlag != nil {
-		switch *v.TransBatteryFlag {
-		case parser.BatteryNominal:
-			r.TransBatteryFlag = "Nominal"
-		case parser.BatteryWarning:
-			r.TransBatteryFlag = "Warning"
-		}
-	}
+// processLeafSoil synchronizes the Report state with the provided leaf and soil
+// weather conditions received at the provided time.
+func (r *Report) processLeafSoil(lsid *int, v *parser.WeatherLeafSoil, now time.Time) {
+	s := r.sensor(lsid, v.TransmitterID)
+	staged := *s
+	staged.processLeafSoil(v)
+	r.calibrateLeafSoil(&staged)
+	r.checkSensor(&staged, now)
+	*s = staged
+	r.syncSensor(s, now, MeasurementLeafSoil)
+}
 
-	r.RainfallDaily = v.RainfallDaily
-	r.RainfallMonthly = v.RainfallMonthly
-	r.RainfallYear = v.RainfallYear
-	r.RainStormLast = v.RainStormLast
-	if v.RainStormLastStartAt != nil {
-		t := v.RainStormLastStartAt.Time()
-		r.RainStormLastStartAt = &t
-	}
-	if v.RainStormLastEndAt != nil {
-		t := v.RainStormLastEndAt.Time()
-		r.RainStormLastEndAt = &t
-	}
+// processDerived synchronizes the Derived field with the Report state. Wind
+// quantities are derived from the 10 minute averages.
+func (r *Report) processDerived() {
+	r.Derived = derived.Compute(derived.Inputs{
+		Temperature: r.Temperature,
+		Humidity:    r.Humidity,
+		WindSpeed:   r.WindSpeedAvgLast10Min,
+		WindDir:     r.WindDirAvgLast10Min,
+		Barometer:   r.BarometerAbsolute,
+	})
 }
 
 // processLSSBarometer synchronizes the Report state with the provided LSS
-// barometer weather conditions.
-func (r *Report) processLSSBarometer(v *parser.WeatherLSSBarometer) {
-	r.BarometerSeaLevel = v.BarometerSeaLevel
-	r.BarometerTrend = v.BarometerTrend
-	r.BarometerAbsolute = v.BarometerAbsolute
+// barometer weather conditions received at the provided time.
+func (r *Report) processLSSBarometer(v *parser.WeatherLSSBarometer, now time.Time) {
+	r.BarometerSeaLevel = r.calibrate(calibrationDefault, "barometerSeaLevel", v.BarometerSeaLevel)
+	r.BarometerTrend = r.calibrate(calibrationDefault, "barometerTrend", v.BarometerTrend)
+	r.BarometerAbsolute = r.calibrate(calibrationDefault, "barometerAbsolute", v.BarometerAbsolute)
+	r.checkReport(qcBarometerFields, now)
 }
 
-// processLSSBarometer synchronizes the Report state with the provided LSS
-// temperature humidity weather conditions.
-func (r *Report) processLSSTempRh(v *parser.WeatherLSSTempRh) {
+// processLSSTempRh synchronizes the Report state with the provided LSS
+// temperature humidity weather conditions received at the provided time.
+func (r *Report) processLSSTempRh(v *parser.WeatherLSSTempRh, now time.Time) {
 	r.TemperatureIndoor = v.TemperatureIndoor
 	r.HumidityIndoor = v.HumidityIndoor
 	r.DewPointIndoor = v.DewPointIndoor
 	r.HeatIndexIndoor = v.HeatIndexIndoor
+	r.calibrateLSSTempRh()
+	r.checkReport(qcTempRhFields, now)
 }
@@ -0,0 +1,452 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tannerryan/davisweather/parser"
+)
+
+const (
+	// primaryExpiry is how long a transmitter remains the default primary
+	// transmitter of a measurement after it last reported the measurement
+	primaryExpiry = 5 * time.Minute
+)
+
+var (
+	// errSensorKey is returned when decoding a malformed SensorKey
+	errSensorKey = errors.New("davisweather: sensor key must be lsid/txid")
+)
+
+// Measurement is a group of Report fields that are sourced from a single
+// transmitter.
+type Measurement string
+
+const (
+	// MeasurementTemperature is temperature, humidity, the derived indices,
+	// receiver status and battery status
+	MeasurementTemperature Measurement = "temperature"
+	// MeasurementWind is wind speed and wind direction
+	MeasurementWind Measurement = "wind"
+	// MeasurementRain is rain rate and rainfall
+	MeasurementRain Measurement = "rain"
+	// MeasurementSolar is solar radiation and UV index
+	MeasurementSolar Measurement = "solar"
+	// MeasurementLeafSoil is soil temperature, soil moisture and leaf wetness
+	MeasurementLeafSoil Measurement = "leafSoil"
+)
+
+// measurementFields are the JSON names of the numeric Report fields of each
+// measurement.
+var measurementFields = map[Measurement][]string{
+	MeasurementTemperature: {"temperature", "humidity", "dewpoint", "wetbulb", "heatindex", "windchill",
+		"thwIndex", "thswIndex"},
+	MeasurementWind: {"windSpeedLast", "windDirLast", "windSpeedAvg1Min", "windDirAvg1Min", "windSpeedAvg2Min",
+		"windDirAvg2Min", "windGustSpeedLast2Min", "windGustDirLast2Min", "windSpeedAvg10Min", "windDirAvg10Min",
+		"windGustSpeedLast10Min", "windGustDirLast10Min"},
+	MeasurementRain: {"rainSize", "rainRateLast", "rainRateHigh", "rainLast15Min", "rainRateHighLast15Min",
+		"rainLast60Min", "rainLast24Hour", "rainStorm", "rainDaily", "rainMonthly", "rainYear", "rainStormLast"},
+	MeasurementSolar: {"solarRad", "uvIndex"},
+	MeasurementLeafSoil: {"soilTemperature1", "soilTemperature2", "soilTemperature3", "soilTemperature4",
+		"soilMoisture1", "soilMoisture2", "soilMoisture3", "soilMoisture4", "leafWetness1", "leafWetness2"},
+}
+
+// measurementSensorFields are the Sensor fields of each measurement
+var measurementSensorFields = loadMeasurementFields()
+
+// loadMeasurementFields returns the Sensor fields of each measurement.
+func loadMeasurementFields() map[Measurement][]reportField {
+	fields := make(map[Measurement][]reportField, len(measurementFields))
+	for m, names := range measurementFields {
+		for _, f := range sensorFields {
+			for _, name := range names {
+				if f.name == name {
+					fields[m] = append(fields[m], f)
+				}
+			}
+		}
+	}
+	return fields
+}
+
+// SensorKey identifies a logical sensor of a transmitter in Report.Sensors. It
+// is encoded as "lsid/txid" in JSON.
+type SensorKey struct {
+	LogicalSensorID int // LogicalSensorID is logical sensor ID
+	TransmitterID   int // TransmitterID is ID of transmitter
+}
+
+// MarshalText encodes the SensorKey as "lsid/txid".
+func (k SensorKey) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d/%d", k.LogicalSensorID, k.TransmitterID)), nil
+}
+
+// UnmarshalText decodes the SensorKey from "lsid/txid". It returns an error if
+// the text is malformed.
+func (k *SensorKey) UnmarshalText(text []byte) error {
+	parts := strings.Split(string(text), "/")
+	if len(parts) != 2 {
+		return errSensorKey
+	}
+	lsid, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return errSensorKey
+	}
+	txid, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return errSensorKey
+	}
+	*k = SensorKey{LogicalSensorID: lsid, TransmitterID: txid}
+	return nil
+}
+
+// Sensor is the latest weather conditions from a single transmitter.
+type Sensor struct {
+	LogicalSensorID int `json:"lsid"` // LogicalSensorID is logical sensor ID
+	TransmitterID   int `json:"txid"` // TransmitterID is ID of transmitter
+
+	Temperature *float64 `json:"temperature"` // Temperature (°F)
+	Humidity    *float64 `json:"humidity"`    // Humidity (%RH)
+	Dewpoint    *float64 `json:"dewpoint"`    // Dewpoint (°F)
+	Wetbulb     *float64 `json:"wetbulb"`     // Wetbulb (°F)
+	HeatIndex   *float64 `json:"heatindex"`   // HeatIndex (°F)
+	WindChill   *float64 `json:"windchill"`   // WindChill (°F)
+	THWIndex    *float64 `json:"thwIndex"`    // THWIndex is "feels like" (°F)
+	THSWIndex   *float64 `json:"thswIndex"`   // THWSIndex is "feels like" including solar (°F)
+
+	WindSpeedLast          *float64 `json:"windSpeedLast"`          // WindSpeedLast is most recent wind speed (mph)
+	WindDirLast            *float64 `json:"windDirLast"`            // WindDirLast is most recent wind direction (°)
+	WindSpeedAvgLast1Min   *float64 `json:"windSpeedAvg1Min"`       // WindSpeedAvgLast1Min is average wind over last minute (mph)
+	WindDirAvgLast1Min     *float64 `json:"windDirAvg1Min"`         // WindDirAvgLast1Min is average wind direction over last minute (°)
+	WindSpeedAvgLast2Min   *float64 `json:"windSpeedAvg2Min"`       // WindSpeedAvgLast2Min is average wind over last 2 minutes (mph)
+	WindDirAvgLast2Min     *float64 `json:"windDirAvg2Min"`         // WindDirAvgLast2Min is average wind direction over last 2 minutes (°)
+	WindSpeedHighLast2Min  *float64 `json:"windGustSpeedLast2Min"`  // WindSpeedHighLast2Min is max gust over last 2 minutes (mph)
+	WindDirAtHighLast2Min  *float64 `json:"windGustDirLast2Min"`    // WindDirAtHighLast2Min is max gust direction over last 2 minutes (°)
+	WindSpeedAvgLast10Min  *float64 `json:"windSpeedAvg10Min"`      // WindSpeedAvgLast10Min is average wind over last 10 minutes (mph)
+	WindDirAvgLast10Min    *float64 `json:"windDirAvg10Min"`        // WindDirAvgLast10Min is average wind dir over last 10 minutes (°)
+	WindSpeedHighLast10Min *float64 `json:"windGustSpeedLast10Min"` // WindSpeedHighLast10Min is max gust over last 10 minutes (mph)
+	WindDirAtHighLast10Min *float64 `json:"windGustDirLast10Min"`   // WindDirAtHighLast10Min is max gust direction over last 10 minutes (°)
+
+	RainSize              *float64   `json:"rainSize"`              // RainSize is size of rain collector (1: 0.01", 2: 0.2mm)
+	RainRateLast          *float64   `json:"rainRateLast"`          // RainRateLast is most recent rain rate (count/hour)
+	RainRateHigh          *float64   `json:"rainRateHigh"`          // RainRateHigh is highest rain rate over last minute (count/hour)
+	RainLast15Min         *float64   `json:"rainLast15Min"`         // RainLast15Min is rain count in last 15 minutes (count)
+	RainRateHighLast15Min *float64   `json:"rainRateHighLast15Min"` // RainRateHighLast15Min is highest rain count rate over last 15 minutes (count/hour)
+	RainLast60Min         *float64   `json:"rainLast60Min"`         // RainLast60Min is rain count over last 60 minutes (count)
+	RainLast24Hour        *float64   `json:"rainLast24Hour"`        // RainLast24Hour is rain count over last 24 hours (count)
+	RainStorm             *float64   `json:"rainStorm"`             // RainStorm is rain since last 24 hour break in rain (count)
+	RainStormStartAt      *time.Time `json:"rainStormStart"`        // RainStormStartAt is time of rain storm start
+
+	SolarRad *float64 `json:"solarRad"` // SolarRad is solar radiation (W/m²)
+	UVIndex  *float64 `json:"uvIndex"`  // UVIndex is solar UV index
+
+	RXState          string `json:"signal"`  // RXState is transmitter receiver status
+	TransBatteryFlag string `json:"battery"` // TransBatteryFlag is transmitter battery status
+
+	RainfallDaily        *float64   `json:"rainDaily"`          // RainfallDaily is total rain since midnight (count)
+	RainfallMonthly      *float64   `json:"rainMonthly"`        // RainfallMonthly is total rain since first of month (count)
+	RainfallYear         *float64   `json:"rainYear"`           // RainfallYear is total rain since first of year (count)
+	RainStormLast        *float64   `json:"rainStormLast"`      // RainStormLast is rain since last 24 hour break in rain (count)
+	RainStormLastStartAt *time.Time `json:"rainStormLastStart"` // RainStormLastStartAt is time of last rain storm start
+	RainStormLastEndAt   *time.Time `json:"rainStormLastEnd"`   // rainStormLastEndAt is time of last rain storm end
+
+	SoilTemperature1 *float64 `json:"soilTemperature1"` // SoilTemperature1 is soil temperature of slot 1 (°F)
+	SoilTemperature2 *float64 `json:"soilTemperature2"` // SoilTemperature2 is soil temperature of slot 2 (°F)
+	SoilTemperature3 *float64 `json:"soilTemperature3"` // SoilTemperature3 is soil temperature of slot 3 (°F)
+	SoilTemperature4 *float64 `json:"soilTemperature4"` // SoilTemperature4 is soil temperature of slot 4 (°F)
+	SoilMoisture1    *float64 `json:"soilMoisture1"`    // SoilMoisture1 is soil moisture of slot 1 (cb)
+	SoilMoisture2    *float64 `json:"soilMoisture2"`    // SoilMoisture2 is soil moisture of slot 2 (cb)
+	SoilMoisture3    *float64 `json:"soilMoisture3"`    // SoilMoisture3 is soil moisture of slot 3 (cb)
+	SoilMoisture4    *float64 `json:"soilMoisture4"`    // SoilMoisture4 is soil moisture of slot 4 (cb)
+	LeafWetness1     *float64 `json:"leafWetness1"`     // LeafWetness1 is leaf wetness of slot 1 (0-15)
+	LeafWetness2     *float64 `json:"leafWetness2"`     // LeafWetness2 is leaf wetness of slot 2 (0-15)
+
+	Quality map[string]QualityFlag `json:"quality,omitempty"` // Quality are the fields failing quality control (keyed by JSON name)
+}
+
+// SetPrimary configures the transmitter used for populating the Report fields
+// of the provided measurement. A transmitter ID of 0 uses the lowest
+// transmitter ID currently reporting the measurement.
+func (r *Report) SetPrimary(m Measurement, txid int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if txid <= 0 {
+		delete(r.primary, m)
+		return
+	}
+	r.primary[m] = txid
+}
+
+// sensor returns the Sensor state for the provided logical sensor of the
+// transmitter, creating it if it does not exist. Conditions without a logical
+// sensor ID belong to the Sensor of the transmitter with the lowest logical
+// sensor ID.
+func (r *Report) sensor(lsid *int, txid *int) *Sensor {
+	key := SensorKey{}
+	if txid != nil {
+		key.TransmitterID = *txid
+	}
+	if r.Sensors == nil {
+		r.Sensors = make(map[SensorKey]*Sensor)
+	}
+	if lsid != nil {
+		key.LogicalSensorID = *lsid
+	} else {
+		found := false
+		for k := range r.Sensors {
+			if k.TransmitterID != key.TransmitterID {
+				continue
+			}
+			if !found || k.LogicalSensorID < key.LogicalSensorID {
+				key, found = k, true
+			}
+		}
+	}
+	s, ok := r.Sensors[key]
+	if !ok {
+		s = &Sensor{LogicalSensorID: key.LogicalSensorID, TransmitterID: key.TransmitterID}
+		r.Sensors[key] = s
+	}
+	return s
+}
+
+// reports returns true if the Sensor provides any field of the measurement.
+func (s *Sensor) reports(m Measurement) bool {
+	v := reflect.ValueOf(s).Elem()
+	for _, f := range measurementSensorFields[m] {
+		if !v.Field(f.index).IsNil() {
+			return true
+		}
+	}
+	return false
+}
+
+// isPrimary returns true if the provided Sensor populates the Report fields of
+// the provided measurement, received at the provided time. Without a
+// configured primary transmitter, the lowest transmitter ID that reported the
+// measurement within the primaryExpiry is used. If no transmitter reports the
+// measurement, the provided Sensor is used.
+func (r *Report) isPrimary(m Measurement, s *Sensor, now time.Time) bool {
+	if txid, ok := r.primary[m]; ok {
+		return txid == s.TransmitterID
+	}
+	reporting := r.reporting[m]
+	if reporting == nil {
+		reporting = make(map[int]time.Time)
+		r.reporting[m] = reporting
+	}
+	if s.reports(m) {
+		reporting[s.TransmitterID] = now
+	} else {
+		delete(reporting, s.TransmitterID)
+	}
+
+	primary := 0
+	for txid, last := range reporting {
+		if now.Sub(last) > primaryExpiry {
+			delete(reporting, txid)
+			continue
+		}
+		if primary == 0 || txid < primary {
+			primary = txid
+		}
+	}
+	return primary == 0 || primary == s.TransmitterID
+}
+
+// syncSensor synchronizes the Report state with the provided Sensor, received
+// at the provided time, for every measurement the Sensor is primary for.
+func (r *Report) syncSensor(s *Sensor, now time.Time, measurements ...Measurement) {
+	for _, m := range measurements {
+		if !r.isPrimary(m, s, now) {
+			continue
+		}
+		r.syncQuality(s.Quality, measurementFields[m]...)
+		switch m {
+		case MeasurementTemperature:
+			r.Temperature = s.Temperature
+			r.Humidity = s.Humidity
+			r.Dewpoint = s.Dewpoint
+			r.Wetbulb = s.Wetbulb
+			r.HeatIndex = s.HeatIndex
+			r.WindChill = s.WindChill
+			r.THWIndex = s.THWIndex
+			r.THSWIndex = s.THSWIndex
+
+			r.RXState = s.RXState
+			r.TransBatteryFlag = s.TransBatteryFlag
+		case MeasurementWind:
+			r.WindSpeedLast = s.WindSpeedLast
+			r.WindDirLast = s.WindDirLast
+			r.WindSpeedAvgLast1Min = s.WindSpeedAvgLast1Min
+			r.WindDirAvgLast1Min = s.WindDirAvgLast1Min
+			r.WindSpeedAvgLast2Min = s.WindSpeedAvgLast2Min
+			r.WindDirAvgLast2Min = s.WindDirAvgLast2Min
+			r.WindSpeedHighLast2Min = s.WindSpeedHighLast2Min
+			r.WindDirAtHighLast2Min = s.WindDirAtHighLast2Min
+			r.WindSpeedAvgLast10Min = s.WindSpeedAvgLast10Min
+			r.WindDirAvgLast10Min = s.WindDirAvgLast10Min
+			r.WindSpeedHighLast10Min = s.WindSpeedHighLast10Min
+			r.WindDirAtHighLast10Min = s.WindDirAtHighLast10Min
+		case MeasurementRain:
+			r.RainSize = s.RainSize
+			r.RainRateLast = s.RainRateLast
+			r.RainRateHigh = s.RainRateHigh
+			r.RainLast15Min = s.RainLast15Min
+			r.RainRateHighLast15Min = s.RainRateHighLast15Min
+			r.RainLast60Min = s.RainLast60Min
+			r.RainLast24Hour = s.RainLast24Hour
+			r.RainStorm = s.RainStorm
+			r.RainStormStartAt = s.RainStormStartAt
+
+			r.RainfallDaily = s.RainfallDaily
+			r.RainfallMonthly = s.RainfallMonthly
+			r.RainfallYear = s.RainfallYear
+			r.RainStormLast = s.RainStormLast
+			r.RainStormLastStartAt = s.RainStormLastStartAt
+			r.RainStormLastEndAt = s.RainStormLastEndAt
+		case MeasurementSolar:
+			r.SolarRad = s.SolarRad
+			r.UVIndex = s.UVIndex
+		case MeasurementLeafSoil:
+			r.SoilTemperature1 = s.SoilTemperature1
+			r.SoilTemperature2 = s.SoilTemperature2
+			r.SoilTemperature3 = s.SoilTemperature3
+			r.SoilTemperature4 = s.SoilTemperature4
+			r.SoilMoisture1 = s.SoilMoisture1
+			r.SoilMoisture2 = s.SoilMoisture2
+			r.SoilMoisture3 = s.SoilMoisture3
+			r.SoilMoisture4 = s.SoilMoisture4
+			r.LeafWetness1 = s.LeafWetness1
+			r.LeafWetness2 = s.LeafWetness2
+		}
+	}
+}
+
+// processISS synchronizes the Sensor state with the provided ISS weather
+// conditions.
+func (s *Sensor) processISS(v *parser.WeatherISS) {
+	s.Temperature = v.Temperature
+	s.Humidity = v.Humidity
+	s.Dewpoint = v.Dewpoint
+	s.Wetbulb = v.Wetbulb
+	s.HeatIndex = v.HeatIndex
+	s.WindChill = v.WindChill
+	s.THWIndex = v.THWIndex
+	s.THSWIndex = v.THSWIndex
+
+	s.WindSpeedLast = v.WindSpeedLast
+	s.WindDirLast = v.WindDirLast
+	s.WindSpeedAvgLast1Min = v.WindSpeedAvgLast1Min
+	s.WindDirAvgLast1Min = v.WindDirAvgLast1Min
+	s.WindSpeedAvgLast2Min = v.WindSpeedAvgLast2Min
+	s.WindDirAvgLast2Min = v.WindDirAvgLast2Min
+	s.WindSpeedHighLast2Min = v.WindSpeedHighLast2Min
+	s.WindDirAtHighLast2Min = v.WindDirAtHighLast2Min
+	s.WindSpeedAvgLast10Min = v.WindSpeedAvgLast10Min
+	s.WindDirAvgLast10Min = v.WindDirAvgLast10Min
+	s.WindSpeedHighLast10Min = v.WindSpeedHighLast10Min
+	s.WindDirAtHighLast10Min = v.WindDirAtHighLast10Min
+
+	s.RainSize = v.RainSize
+	s.RainRateLast = v.RainRateLast
+	s.RainRateHigh = v.RainRateHigh
+	s.RainLast15Min = v.RainLast15Min
+	s.RainRateHighLast15Min = v.RainRateHighLast15Min
+	s.RainLast60Min = v.RainLast60Min
+	s.RainLast24Hour = v.RainLast24Hour
+	s.RainStorm = v.RainStorm
+	if v.RainStormStartAt != nil {
+		t := v.RainStormStartAt.Time()
+		s.RainStormStartAt = &t
+	}
+
+	s.SolarRad = v.SolarRad
+	s.UVIndex = v.UVIndex
+
+	s.processStatus(v.RXState, v.TransBatteryFlag)
+
+	s.RainfallDaily = v.RainfallDaily
+	s.RainfallMonthly = v.RainfallMonthly
+	s.RainfallYear = v.RainfallYear
+	s.RainStormLast = v.RainStormLast
+	if v.RainStormLastStartAt != nil {
+		t := v.RainStormLastStartAt.Time()
+		s.RainStormLastStartAt = &t
+	}
+	if v.RainStormLastEndAt != nil {
+		t := v.RainStormLastEndAt.Time()
+		s.RainStormLastEndAt = &t
+	}
+}
+
+// processLeafSoil synchronizes the Sensor state with the provided leaf and soil
+// weather conditions.
+func (s *Sensor) processLeafSoil(v *parser.WeatherLeafSoil) {
+	s.SoilTemperature1 = v.SoilTemperature1
+	s.SoilTemperature2 = v.SoilTemperature2
+	s.SoilTemperature3 = v.SoilTemperature3
+	s.SoilTemperature4 = v.SoilTemperature4
+	s.SoilMoisture1 = v.SoilMoisture1
+	s.SoilMoisture2 = v.SoilMoisture2
+	s.SoilMoisture3 = v.SoilMoisture3
+	s.SoilMoisture4 = v.SoilMoisture4
+	s.LeafWetness1 = v.LeafWetness1
+	s.LeafWetness2 = v.LeafWetness2
+
+	s.processStatus(v.RXState, v.TransBatteryFlag)
+}
+
+// processUDP synchronizes the Sensor state with the provided UDP weather
+// conditions.
+func (s *Sensor) processUDP(c *parser.EntryUDP) {
+	s.WindSpeedLast = c.WindSpeedLast
+	s.WindDirLast = c.WindDirLast
+
+	s.RainSize = c.RainSize
+	s.RainRateLast = c.RainRateLast
+	s.RainLast15Min = c.RainLast15Min
+	s.RainLast60Min = c.RainLast60Min
+	s.RainLast24Hour = c.RainLast24Hour
+	s.RainStorm = c.RainStorm
+	if c.RainStormStartAt != nil {
+		t := c.RainStormStartAt.Time()
+		s.RainStormStartAt = &t
+	}
+	s.RainfallDaily = c.RainfallDaily
+	s.RainfallMonthly = c.RainfallMonthly
+	s.RainfallYear = c.RainfallYear
+
+	s.WindSpeedHighLast10Min = c.WindSpeedHighLast10Min
+	s.WindDirAtHighLast10Min = c.WindDirAtHighLast10Min
+}
+
+// processStatus synchronizes the Sensor receiver and battery status.
+func (s *Sensor) processStatus(rx *parser.SignalState, battery *parser.BatteryState) {
+	if rx != nil {
+		switch *rx {
+		case parser.SignalSynced:
+			s.RXState = "Synced"
+		case parser.SignalRescan:
+			s.RXState = "Rescan"
+		case parser.SignalLost:
+			s.RXState = "Lost"
+		}
+	}
+	if battery != nil {
+		switch *battery {
+		case parser.BatteryNominal:
+			s.TransBatteryFlag = "Nominal"
+		case parser.BatteryWarning:
+			s.TransBatteryFlag = "Warning"
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPrimaryLowestTransmitter(t *testing.T) {
+	r, _ := NewReport(false)
+	for i := 0; i < 3; i++ {
+		updateHTTP(t, r, conditionsISS(1592400000+i, 2, "60", "40"))
+		updateHTTP(t, r, conditionsISS(1592400000+i, 1, "70", "50"))
+		updateHTTP(t, r, conditionsISS(1592400000+i, 3, "80", "60"))
+		if r.Temperature == nil || *r.Temperature != 70 {
+			t.Fatalf("Temperature = %v, want 70 of transmitter 1", r.Temperature)
+		}
+	}
+
+	r.SetPrimary(MeasurementTemperature, 3)
+	updateHTTP(t, r, conditionsISS(1592400010, 1, "70", "50"))
+	updateHTTP(t, r, conditionsISS(1592400010, 3, "80", "60"))
+	if r.Temperature == nil || *r.Temperature != 80 {
+		t.Errorf("Temperature = %v, want 80 of primary transmitter 3", r.Temperature)
+	}
+}
+
+func TestPrimaryReporting(t *testing.T) {
+	r, _ := NewReport(false)
+	updateHTTP(t, r, conditionsISS(1592400000, 1, "70", "50"))
+	updateHTTP(t, r, conditionsISS(1592400000, 2, "60", "40"))
+	if r.Temperature == nil || *r.Temperature != 70 {
+		t.Fatalf("Temperature = %v, want 70 of transmitter 1", r.Temperature)
+	}
+
+	// transmitter without temperature is not the primary transmitter
+	updateHTTP(t, r, conditionsISS(1592400010, 1, "null", "null"))
+	updateHTTP(t, r, conditionsISS(1592400010, 2, "61", "40"))
+	if r.Temperature == nil || *r.Temperature != 61 {
+		t.Fatalf("Temperature = %v, want 61 of transmitter 2", r.Temperature)
+	}
+	// wind is still reported by transmitter 1
+	if r.WindSpeedLast == nil || r.Sensors[issKey(1)].WindSpeedLast != r.WindSpeedLast {
+		t.Errorf("WindSpeedLast = %v, want wind of transmitter 1", r.WindSpeedLast)
+	}
+
+	// transmitter 1 reports again
+	updateHTTP(t, r, conditionsISS(1592400020, 1, "71", "50"))
+	updateHTTP(t, r, conditionsISS(1592400020, 2, "62", "40"))
+	if r.Temperature == nil || *r.Temperature != 71 {
+		t.Fatalf("Temperature = %v, want 71 of transmitter 1", r.Temperature)
+	}
+
+	// transmitter 1 expires after it stops reporting
+	updateHTTP(t, r, conditionsISS(1592400020+240, 2, "63", "40"))
+	if *r.Temperature != 71 {
+		t.Errorf("Temperature = %v, want 71 of transmitter 1 before expiry", *r.Temperature)
+	}
+	updateHTTP(t, r, conditionsISS(1592400020+301, 2, "64", "40"))
+	if *r.Temperature != 64 {
+		t.Errorf("Temperature = %v, want 64 of transmitter 2 after expiry", *r.Temperature)
+	}
+
+	// no transmitter reports the measurement
+	updateHTTP(t, r, conditionsISS(1592400400, 2, "null", "null"))
+	if r.Temperature != nil {
+		t.Errorf("Temperature = %v, want not provided", *r.Temperature)
+	}
+}
+
+func TestSensorKey(t *testing.T) {
+	r, _ := NewReport(false)
+	updateHTTP(t, r, conditionsISS(1592400000, 1, "70", "50"))
+	// broadcast without a logical sensor ID belongs to the ISS
+	updateUDP(t, r, `{"did":"001D0A700002","ts":1592400002,"conditions":[{"txid":1,"wind_speed_last":7,"wind_dir_last":90}]}`)
+	if len(r.Sensors) != 1 || *r.Sensors[issKey(1)].WindSpeedLast != 7 {
+		t.Fatalf("Sensors = %+v, want wind of ISS", r.Sensors)
+	}
+
+	buff, err := json.Marshal(r.Sensors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sensors map[SensorKey]*Sensor
+	if err := json.Unmarshal(buff, &sensors); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sensors, r.Sensors) {
+		t.Errorf("decoded %s = %+v", buff, sensors)
+	}
+	for _, text := range []string{"1", "a/1", "48301/b", "1/2/3"} {
+		var k SensorKey
+		if err := k.UnmarshalText([]byte(text)); err != errSensorKey {
+			t.Errorf("UnmarshalText(%q) = %v, want %v", text, err, errSensorKey)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"time"
+)
+
+// Station is the location of the weather station, which is not reported by the
+// WLL unit.
+type Station struct {
+	Latitude   float64        // Latitude is station latitude (°, north positive)
+	Longitude  float64        // Longitude is station longitude (°, east positive)
+	Elevation  float64        // Elevation is station elevation above sea level (m)
+	WindHeight float64        // WindHeight is anemometer height above ground (m), 0 for 2 m
+	Location   *time.Location // Location is the station time zone, nil for time.Local
+}
+
+// location returns the time zone of the Station.
+func (s *Station) location() *time.Location {
+	if s == nil || s.Location == nil {
+		return time.Local
+	}
+	return s.Location
+}
+
+// SetStation configures the location of the weather station, enabling the
+// reference evapotranspiration (ET0) of the Report.
+func (r *Report) SetStation(s Station) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.station = &s
+	r.et = &etState{}
+}
+
+// WithStation configures the location of the weather station, see SetStation.
+func WithStation(s Station) Option {
+	return func(c *Client) {
+		c.report.SetStation(s)
+	}
+}
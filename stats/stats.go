@@ -0,0 +1,337 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+// Package stats tracks the minimum, maximum and mean of each numeric Report
+// field over the current day, month and year.
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/tannerryan/davisweather"
+)
+
+const (
+	// defaultSaveInterval is how often a running Tracker persists its state
+	defaultSaveInterval = time.Minute
+	// maxWeightGap is the longest interval a value is weighted for in the mean
+	maxWeightGap = 15 * time.Minute
+)
+
+var (
+	// errUnknownPeriod is returned when loading an unknown period
+	errUnknownPeriod = errors.New("stats: unknown period")
+)
+
+// Period is a calendar period of statistics.
+type Period string
+
+const (
+	// Day is the current day
+	Day Period = "day"
+	// Month is the current month
+	Month Period = "month"
+	// Year is the current year
+	Year Period = "year"
+)
+
+// periods are the tracked periods
+var periods = []Period{Day, Month, Year}
+
+// Extreme is an extreme value and the time it was observed.
+type Extreme struct {
+	Value float64   `json:"value"` // Value is the extreme value
+	Time  time.Time `json:"time"`  // Time is when the value was observed
+}
+
+// Summary is the statistics of a single field over a period.
+type Summary struct {
+	Min   Extreme   `json:"min"`   // Min is the lowest value
+	Max   Extreme   `json:"max"`   // Max is the highest value
+	Mean  float64   `json:"mean"`  // Mean is the time-weighted mean value
+	Last  Extreme   `json:"last"`  // Last is the most recent value
+	Count int       `json:"count"` // Count is the number of observations
+	Sum   float64   `json:"sum"`   // Sum is the time-weighted sum of values (value·seconds)
+	Span  float64   `json:"span"`  // Span is the total weight of the Sum (seconds)
+	First time.Time `json:"first"` // First is when the field was first observed in the period
+}
+
+// Snapshot is the statistics of every field over a period.
+type Snapshot struct {
+	Period Period             `json:"period"` // Period is the calendar period
+	Start  time.Time          `json:"start"`  // Start is the start of the period
+	Fields map[string]Summary `json:"fields"` // Fields are the statistics of each field (keyed by JSON name)
+}
+
+// Options configures a Tracker.
+type Options struct {
+	Location     *time.Location // Location is the time zone of the periods (default time.Local)
+	Path         string         // Path is the file the statistics are persisted to (optional)
+	SaveInterval time.Duration  // SaveInterval is how often Run persists the statistics (default 1 minute)
+}
+
+// Tracker maintains the statistics of each numeric Report field.
+type Tracker struct {
+	location     *time.Location       // location is the time zone of the periods
+	path         string               // path is the persistence file ("" if disabled)
+	saveInterval time.Duration        // saveInterval is how often Run persists the statistics
+	current      map[Period]*Snapshot // current are the statistics of the current periods
+	previous     map[Period]*Snapshot // previous are the statistics of the previous periods
+	mutex        *sync.Mutex          // mutex is for atomic tracker actions
+}
+
+// state is the persisted representation of a Tracker.
+type state struct {
+	Current  map[Period]*Snapshot `json:"current"`  // Current are the statistics of the current periods
+	Previous map[Period]*Snapshot `json:"previous"` // Previous are the statistics of the previous periods
+}
+
+// New returns a Tracker, loading the persisted statistics if a Path is
+// provided. A missing file is not an error. It returns an error if the
+// persisted statistics cannot be read.
+func New(opts Options) (*Tracker, error) {
+	t := &Tracker{
+		location:     opts.Location,
+		path:         opts.Path,
+		saveInterval: opts.SaveInterval,
+		current:      make(map[Period]*Snapshot),
+		previous:     make(map[Period]*Snapshot),
+		mutex:        &sync.Mutex{},
+	}
+	if t.location == nil {
+		t.location = time.Local
+	}
+	if t.saveInterval <= 0 {
+		t.saveInterval = defaultSaveInterval
+	}
+	if t.path == "" {
+		return t, nil
+	}
+
+	buff, err := ioutil.ReadFile(t.path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s state
+	if err := json.Unmarshal(buff, &s); err != nil {
+		return nil, err
+	}
+	for _, m := range []map[Period]*Snapshot{s.Current, s.Previous} {
+		for p, snapshot := range m {
+			if _, err := start(p, snapshot.Start); err != nil {
+				return nil, err
+			}
+			if snapshot.Fields == nil {
+				snapshot.Fields = make(map[string]Summary)
+			}
+		}
+	}
+	if s.Current != nil {
+		t.current = s.Current
+	}
+	if s.Previous != nil {
+		t.previous = s.Previous
+	}
+	return t, nil
+}
+
+// Run updates the Tracker with every Event of the Client until the context is
+// cancelled, persisting the statistics every SaveInterval and on return. It
+// returns the error of the final save.
+func (t *Tracker) Run(ctx context.Context, c *davisweather.Client) error {
+	events := c.Subscribe(ctx, davisweather.SubscribeOptions{Buffer: 16, Policy: davisweather.DropOldest})
+	if report, err := c.Report(); err == nil && !report.Timestamp.IsZero() {
+		t.Update(report)
+	}
+
+	ticker := time.NewTicker(t.saveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return t.Save()
+			}
+			t.Update(event.Report)
+		case <-ticker.C:
+			t.Save()
+		case <-ctx.Done():
+			return t.Save()
+		}
+	}
+}
+
+// Update observes the numeric fields of the Report at the Report Timestamp.
+func (t *Tracker) Update(r *davisweather.Report) {
+	t.Observe(r.Timestamp, r.Values())
+}
+
+// Observe updates the statistics of every period with the values observed at
+// the provided time, keyed by field name. Periods ending before the provided
+// time are reset first. Observations older than the current periods are
+// ignored.
+func (t *Tracker) Observe(at time.Time, values map[string]float64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, p := range periods {
+		begin, _ := start(p, at.In(t.location))
+		current, ok := t.current[p]
+		if ok && begin.Before(current.Start) {
+			continue
+		}
+		// reset at period boundary
+		if !ok || begin.After(current.Start) {
+			if ok {
+				t.previous[p] = current
+			}
+			current = &Snapshot{Period: p, Start: begin, Fields: make(map[string]Summary)}
+			t.current[p] = current
+		}
+		for name, v := range values {
+			current.Fields[name] = observe(current.Fields[name], at, v)
+		}
+	}
+}
+
+// observe returns the Summary updated with the value observed at the provided
+// time.
+func observe(s Summary, at time.Time, v float64) Summary {
+	if s.Count == 0 {
+		return Summary{
+			Min:   Extreme{Value: v, Time: at},
+			Max:   Extreme{Value: v, Time: at},
+			Mean:  v,
+			Last:  Extreme{Value: v, Time: at},
+			Count: 1,
+			First: at,
+		}
+	}
+	if v < s.Min.Value {
+		s.Min = Extreme{Value: v, Time: at}
+	}
+	if v > s.Max.Value {
+		s.Max = Extreme{Value: v, Time: at}
+	}
+	// weight the previous value by how long it was current
+	if dt := at.Sub(s.Last.Time); dt > 0 && dt <= maxWeightGap {
+		s.Sum += s.Last.Value * dt.Seconds()
+		s.Span += dt.Seconds()
+	}
+	if s.Span > 0 {
+		s.Mean = s.Sum / s.Span
+	} else {
+		s.Mean = v
+	}
+	if !at.Before(s.Last.Time) {
+		s.Last = Extreme{Value: v, Time: at}
+	}
+	s.Count++
+	return s
+}
+
+// Get returns the statistics of the field over the current period. It returns
+// false if the field has not been observed in the period.
+func (t *Tracker) Get(p Period, field string) (Summary, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	current, ok := t.current[p]
+	if !ok {
+		return Summary{}, false
+	}
+	s, ok := current.Fields[field]
+	return s, ok
+}
+
+// Current returns the statistics of every field over the current period. It
+// returns false if nothing has been observed in the period.
+func (t *Tracker) Current(p Period) (Snapshot, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return copySnapshot(t.current[p])
+}
+
+// Previous returns the statistics of every field over the previous period,
+// such as yesterday. It returns false if the previous period was not tracked.
+func (t *Tracker) Previous(p Period) (Snapshot, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return copySnapshot(t.previous[p])
+}
+
+// Save persists the statistics to the Path, replacing the file atomically. It
+// does nothing if no Path is provided. It returns an error if the write fails.
+func (t *Tracker) Save() error {
+	if t.path == "" {
+		return nil
+	}
+	t.mutex.Lock()
+	buff, err := json.Marshal(state{Current: t.current, Previous: t.previous})
+	t.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFile(t.path, buff)
+}
+
+// copySnapshot returns a deep copy of the Snapshot.
+func copySnapshot(s *Snapshot) (Snapshot, bool) {
+	if s == nil {
+		return Snapshot{}, false
+	}
+	out := Snapshot{Period: s.Period, Start: s.Start, Fields: make(map[string]Summary, len(s.Fields))}
+	for name, summary := range s.Fields {
+		out.Fields[name] = summary
+	}
+	return out, true
+}
+
+// start returns the start of the period containing the provided time, in the
+// time zone of the provided time. It returns an error if the period is
+// unknown.
+func start(p Period, at time.Time) (time.Time, error) {
+	switch p {
+	case Day:
+		return time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location()), nil
+	case Month:
+		return time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, at.Location()), nil
+	case Year:
+		return time.Date(at.Year(), 1, 1, 0, 0, 0, 0, at.Location()), nil
+	}
+	return time.Time{}, errUnknownPeriod
+}
+
+// writeFile writes the contents to a temporary file in the same directory and
+// renames it over the path, so the file is never partially written.
+func writeFile(path string, contents []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,257 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package stats
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/davisweather"
+	"github.com/tannerryan/davisweather/davisweathertest"
+)
+
+// est is the time zone of the rollover tests
+var est = time.FixedZone("EST", -5*60*60)
+
+// waitFor polls the condition until it is true or the timeout expires.
+func waitFor(t *testing.T, timeout time.Duration, msg string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for " + msg)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// temp returns the values with the temperature.
+func temp(v float64) map[string]float64 {
+	return map[string]float64{"temperature": v}
+}
+
+// count returns the observation count of the temperature over the current
+// period.
+func count(t *Tracker, p Period) int {
+	s, _ := t.Get(p, "temperature")
+	return s.Count
+}
+
+func TestRollover(t *testing.T) {
+	tr, err := New(Options{Location: est})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 04:50 UTC is still the last day of the year in the time zone
+	tr.Observe(time.Date(2020, 1, 1, 4, 50, 0, 0, time.UTC), temp(10))
+	tr.Observe(time.Date(2019, 12, 31, 23, 55, 0, 0, est), temp(20))
+	if day, _ := tr.Current(Day); !day.Start.Equal(time.Date(2019, 12, 31, 0, 0, 0, 0, est)) {
+		t.Errorf("day start = %v, want 2019-12-31 EST", day.Start)
+	}
+	if _, ok := tr.Previous(Day); ok {
+		t.Error("previous day before rollover")
+	}
+
+	// midnight of the new year resets every period
+	tr.Observe(time.Date(2020, 1, 1, 0, 5, 0, 0, est), temp(5))
+	for _, p := range periods {
+		if got := count(tr, p); got != 1 {
+			t.Errorf("%s count after new year = %d, want 1", p, got)
+		}
+		previous, ok := tr.Previous(p)
+		if !ok {
+			t.Fatalf("no previous %s", p)
+		}
+		s := previous.Fields["temperature"]
+		if s.Count != 2 || s.Min.Value != 10 || s.Max.Value != 20 || s.Mean != 10 {
+			t.Errorf("previous %s = %+v", p, s)
+		}
+	}
+	if year, _ := tr.Previous(Year); !year.Start.Equal(time.Date(2019, 1, 1, 0, 0, 0, 0, est)) {
+		t.Errorf("previous year start = %v", year.Start)
+	}
+
+	// observations of previous periods are ignored
+	tr.Observe(time.Date(2019, 12, 31, 23, 59, 0, 0, est), temp(50))
+	if got := count(tr, Day); got != 1 {
+		t.Errorf("day count after late observation = %d, want 1", got)
+	}
+
+	// end of the month resets the day only
+	tr.Observe(time.Date(2020, 1, 31, 23, 0, 0, 0, est), temp(7))
+	if day, month, year := count(tr, Day), count(tr, Month), count(tr, Year); day != 1 || month != 2 || year != 2 {
+		t.Errorf("counts on last day of month = %d, %d, %d, want 1, 2, 2", day, month, year)
+	}
+	// start of the next month resets the day and month
+	tr.Observe(time.Date(2020, 2, 1, 1, 0, 0, 0, est), temp(8))
+	if day, month, year := count(tr, Day), count(tr, Month), count(tr, Year); day != 1 || month != 1 || year != 3 {
+		t.Errorf("counts on first day of month = %d, %d, %d, want 1, 1, 3", day, month, year)
+	}
+	if month, _ := tr.Previous(Month); month.Fields["temperature"].Max.Value != 7 {
+		t.Errorf("previous month = %+v", month.Fields["temperature"])
+	}
+	if year, _ := tr.Previous(Year); year.Fields["temperature"].Count != 2 {
+		t.Errorf("previous year after month rollover = %+v", year.Fields["temperature"])
+	}
+}
+
+func TestExtremes(t *testing.T) {
+	tr, err := New(Options{Location: time.UTC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2020, 6, 16, 12, 0, 0, 0, time.UTC)
+	tr.Observe(at, temp(10))
+	tr.Observe(at.Add(10*time.Minute), temp(20))
+	tr.Observe(at.Add(20*time.Minute), temp(30))
+	// gap longer than maxWeightGap is not weighted
+	tr.Observe(at.Add(60*time.Minute), temp(0))
+
+	s, ok := tr.Get(Day, "temperature")
+	if !ok {
+		t.Fatal("temperature not tracked")
+	}
+	if s.Min.Value != 0 || !s.Min.Time.Equal(at.Add(60*time.Minute)) {
+		t.Errorf("Min = %+v", s.Min)
+	}
+	if s.Max.Value != 30 || !s.Max.Time.Equal(at.Add(20*time.Minute)) {
+		t.Errorf("Max = %+v", s.Max)
+	}
+	if s.Mean != 15 || s.Span != 1200 || s.Count != 4 {
+		t.Errorf("Mean = %v, Span = %v, Count = %d, want 15, 1200, 4", s.Mean, s.Span, s.Count)
+	}
+	if s.Last.Value != 0 || !s.First.Equal(at) {
+		t.Errorf("Last = %+v, First = %v", s.Last, s.First)
+	}
+
+	// out of order observation updates extremes but not the last value
+	tr.Observe(at.Add(30*time.Minute), temp(40))
+	s, _ = tr.Get(Day, "temperature")
+	if s.Max.Value != 40 || s.Last.Value != 0 {
+		t.Errorf("after out of order observation Max = %+v, Last = %+v", s.Max, s.Last)
+	}
+	if _, ok := tr.Get(Day, "humidity"); ok {
+		t.Error("Get of unobserved field succeeded")
+	}
+}
+
+func TestPersist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "stats.json")
+
+	// missing file is not an error
+	tr, err := New(Options{Location: time.UTC, Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.Observe(time.Date(2020, 6, 15, 23, 50, 0, 0, time.UTC), map[string]float64{"temperature": 60, "humidity": 80})
+	tr.Observe(time.Date(2020, 6, 16, 0, 10, 0, 0, time.UTC), temp(58))
+	tr.Observe(time.Date(2020, 6, 16, 0, 20, 0, 0, time.UTC), temp(57))
+	if err := tr.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := New(Options{Location: time.UTC, Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range periods {
+		for _, get := range []func(*Tracker, Period) (Snapshot, bool){(*Tracker).Current, (*Tracker).Previous} {
+			want, wantOK := get(tr, p)
+			got, ok := get(loaded, p)
+			if ok != wantOK || !reflect.DeepEqual(got, want) {
+				t.Errorf("loaded %s =\n%+v\nwant\n%+v", p, got, want)
+			}
+		}
+	}
+
+	// loaded statistics continue the period
+	loaded.Observe(time.Date(2020, 6, 16, 0, 30, 0, 0, time.UTC), temp(56))
+	if s, _ := loaded.Get(Day, "temperature"); s.Count != 3 || s.Min.Value != 56 || s.Max.Value != 58 {
+		t.Errorf("day after load = %+v", s)
+	}
+
+	for _, contents := range []string{`{"current":{"week":{"period":"week"}}}`, `{`} {
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := New(Options{Path: path}); err == nil {
+			t.Errorf("New with %s succeeded", contents)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "stats.json")
+
+	// accelerated day changes the wind with every broadcast
+	unit, err := davisweathertest.Start(davisweathertest.Config{
+		BroadcastInterval: 100 * time.Millisecond,
+		Scenario:          davisweathertest.Diurnal(davisweathertest.Typical, time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unit.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := davisweather.Unmanaged(ctx, false, unit.Host(), unit.Port(),
+		davisweather.WithHTTPStartDelay(0),
+		davisweather.WithUDPDeadline(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := New(Options{Location: time.UTC, Path: path, SaveInterval: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- tr.Run(runCtx, c) }()
+
+	waitFor(t, 10*time.Second, "wind statistics", func() bool {
+		s, _ := tr.Get(Day, "windSpeedLast")
+		return s.Count > 1
+	})
+	waitFor(t, 5*time.Second, "periodic save", func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	})
+	stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+
+	// final save holds the statistics at return
+	loaded, err := New(Options{Location: time.UTC, Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := loaded.Get(Day, "windSpeedLast")
+	want, _ := tr.Get(Day, "windSpeedLast")
+	if got.Count != want.Count {
+		t.Errorf("loaded count = %d, want %d", got.Count, want.Count)
+	}
+}
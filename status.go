@@ -0,0 +1,225 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DiscoveryState indicates the mDNS discovery state of the Client.
+type DiscoveryState string
+
+const (
+	// DiscoveryDisabled means the Client is unmanaged and does not use mDNS
+	DiscoveryDisabled DiscoveryState = "disabled"
+	// DiscoverySearching means the Client is searching for the WLL unit
+	DiscoverySearching DiscoveryState = "searching"
+	// DiscoveryResolved means the Client has located the WLL unit
+	DiscoveryResolved DiscoveryState = "resolved"
+)
+
+// ConnectionState indicates how the Client is receiving weather conditions.
+type ConnectionState string
+
+const (
+	// StateDiscovering means the Client is waiting for mDNS discovery
+	StateDiscovering ConnectionState = "discovering"
+	// StateConnecting means the Client has not received weather conditions
+	StateConnecting ConnectionState = "connecting"
+	// StateLive means the Client is receiving UDP broadcasts
+	StateLive ConnectionState = "live"
+	// StatePolling means the Client is polling HTTP without UDP broadcasts
+	StatePolling ConnectionState = "polling"
+	// StateOffline means the Client has stopped receiving weather conditions
+	StateOffline ConnectionState = "offline"
+)
+
+const (
+	// transitionBuffer is the buffer size of each transition channel
+	transitionBuffer = 8
+)
+
+// Status is the health and connection state of the Client.
+type Status struct {
+	State     ConnectionState `json:"state"`     // State is the connection state
+	Discovery DiscoveryState  `json:"discovery"` // Discovery is the mDNS discovery state
+	Address   string          `json:"address"`   // Address is the URL of the resolved WLL unit
+	UDPPort   int             `json:"udpPort"`   // UDPPort is the port of the UDP broadcasts
+
+	LastUDP         time.Time `json:"lastUDP"`         // LastUDP is the time the last UDP broadcast was received
+	LastHTTP        time.Time `json:"lastHTTP"`        // LastHTTP is the time of the last successful HTTP poll
+	BroadcastExpiry time.Time `json:"broadcastExpiry"` // BroadcastExpiry is the time the UDP broadcasts expire
+
+	UDPFailures       int `json:"udpFailures"`       // UDPFailures is the number of consecutive UDP failures
+	HTTPFailures      int `json:"httpFailures"`      // HTTPFailures is the number of consecutive HTTP failures
+	DiscoveryFailures int `json:"discoveryFailures"` // DiscoveryFailures is the number of consecutive mDNS failures
+
+	UDPError       error `json:"-"` // UDPError is the last error of the UDP event loop
+	HTTPError      error `json:"-"` // HTTPError is the last error of the HTTP event loop
+	DiscoveryError error `json:"-"` // DiscoveryError is the last error of the mDNS discovery loop
+}
+
+// Transition is emitted when the connection state of the Client changes.
+type Transition struct {
+	From   ConnectionState // From is the previous connection state
+	To     ConnectionState // To is the current connection state
+	Status Status          // Status is the Client status at the transition
+	Time   time.Time       // Time is the time of the transition
+}
+
+// health tracks the Status of a Client.
+type health struct {
+	status      Status                       // status is the latest Client status
+	transitions map[chan Transition]struct{} // transitions are the transition subscribers
+	mutex       *sync.Mutex                  // mutex is for atomic health actions
+}
+
+// newHealth returns a health tracker with the provided discovery state.
+func newHealth(discovery DiscoveryState) *health {
+	state := StateConnecting
+	if discovery == DiscoverySearching {
+		state = StateDiscovering
+	}
+	return &health{
+		status: Status{
+			State:     state,
+			Discovery: discovery,
+		},
+		transitions: make(map[chan Transition]struct{}),
+		mutex:       &sync.Mutex{},
+	}
+}
+
+// Status returns the health and connection state of the Client.
+func (c *Client) Status() Status {
+	c.health.mutex.Lock()
+	defer c.health.mutex.Unlock()
+	c.evaluateState(time.Now())
+	return c.health.status
+}
+
+// Transitions returns a channel that emits a Transition each time the
+// connection state of the Client changes. Transitions are dropped if the
+// channel is full. The channel is closed when the context is cancelled.
+func (c *Client) Transitions(ctx context.Context) <-chan Transition {
+	ch := make(chan Transition, transitionBuffer)
+
+	c.health.mutex.Lock()
+	c.health.transitions[ch] = struct{}{}
+	c.health.mutex.Unlock()
+
+	// remove subscriber when context is cancelled
+	go func() {
+		<-ctx.Done()
+		c.health.mutex.Lock()
+		delete(c.health.transitions, ch)
+		close(ch)
+		c.health.mutex.Unlock()
+	}()
+	return ch
+}
+
+// recordDiscovery updates the Client status after an mDNS discovery attempt.
+func (c *Client) recordDiscovery(address string, err error) {
+	c.updateHealth(func(s *Status) {
+		if err != nil {
+			s.DiscoveryFailures++
+			s.DiscoveryError = err
+			return
+		}
+		s.DiscoveryFailures = 0
+		if address != "" {
+			s.Discovery = DiscoveryResolved
+			s.Address = address
+		}
+	})
+}
+
+// recordHTTP updates the Client status after an HTTP poll.
+func (c *Client) recordHTTP(err error) {
+	c.updateHealth(func(s *Status) {
+		if err != nil {
+			s.HTTPFailures++
+			s.HTTPError = err
+			return
+		}
+		s.HTTPFailures = 0
+		s.LastHTTP = time.Now()
+	})
+}
+
+// recordUDP updates the Client status after reading a UDP broadcast.
+func (c *Client) recordUDP(err error) {
+	c.updateHealth(func(s *Status) {
+		if err != nil {
+			s.UDPFailures++
+			s.UDPError = err
+			return
+		}
+		s.UDPFailures = 0
+		s.LastUDP = time.Now()
+	})
+}
+
+// recordBroadcast updates the Client status after enabling UDP broadcasts.
+func (c *Client) recordBroadcast(port int, duration time.Duration) {
+	c.updateHealth(func(s *Status) {
+		s.UDPPort = port
+		s.BroadcastExpiry = time.Now().Add(duration)
+	})
+}
+
+// checkHealth re-evaluates the connection state of the Client, emitting a
+// Transition if the state has changed.
+func (c *Client) checkHealth() {
+	c.updateHealth(func(s *Status) {})
+}
+
+// updateHealth atomically modifies the Client status and re-evaluates the
+// connection state.
+func (c *Client) updateHealth(modify func(s *Status)) {
+	c.health.mutex.Lock()
+	defer c.health.mutex.Unlock()
+	modify(&c.health.status)
+	c.evaluateState(time.Now())
+}
+
+// evaluateState updates the connection state of the Client status, emitting a
+// Transition to every subscriber if the state has changed. The health mutex
+// must be held.
+func (c *Client) evaluateState(now time.Time) {
+	s := &c.health.status
+	previous := s.State
+
+	switch {
+	case s.Discovery == DiscoverySearching:
+		s.State = StateDiscovering
+	case !s.LastUDP.IsZero() && now.Sub(s.LastUDP) <= c.udpDeadline:
+		s.State = StateLive
+	case !s.LastHTTP.IsZero() && now.Sub(s.LastHTTP) <= 2*c.httpInterval+c.httpTimeout:
+		s.State = StatePolling
+	case s.LastUDP.IsZero() && s.LastHTTP.IsZero():
+		s.State = StateConnecting
+	default:
+		s.State = StateOffline
+	}
+	if s.State == previous {
+		return
+	}
+
+	t := Transition{
+		From:   previous,
+		To:     s.State,
+		Status: *s,
+		Time:   now,
+	}
+	for ch := range c.health.transitions {
+		select {
+		case ch <- t:
+		default:
+		}
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+// Package units converts weather measurements from the US customary units
+// reported by the WeatherLink Live unit.
+package units
+
+import (
+	"errors"
+	"math"
+)
+
+var (
+	// errUnknownUnit is returned when unmarshalling an unknown unit symbol
+	errUnknownUnit = errors.New("units: unknown unit")
+)
+
+// Temperature is a unit of temperature.
+type Temperature int
+
+const (
+	// Fahrenheit is degrees Fahrenheit (°F)
+	Fahrenheit Temperature = 0
+	// Celsius is degrees Celsius (°C)
+	Celsius Temperature = 1
+	// Kelvin is kelvin (K)
+	Kelvin Temperature = 2
+)
+
+// Speed is a unit of speed.
+type Speed int
+
+const (
+	// MilesPerHour is miles per hour (mph)
+	MilesPerHour Speed = 0
+	// KilometresPerHour is kilometres per hour (km/h)
+	KilometresPerHour Speed = 1
+	// MetresPerSecond is metres per second (m/s)
+	MetresPerSecond Speed = 2
+	// Knots is nautical miles per hour (kn)
+	Knots Speed = 3
+)
+
+// Pressure is a unit of pressure.
+type Pressure int
+
+const (
+	// InchesOfMercury is inches of mercury (inHg)
+	InchesOfMercury Pressure = 0
+	// Hectopascals is hectopascals (hPa), equal to millibars
+	Hectopascals Pressure = 1
+	// Kilopascals is kilopascals (kPa)
+	Kilopascals Pressure = 2
+	// MillimetresOfMercury is millimetres of mercury (mmHg)
+	MillimetresOfMercury Pressure = 3
+)
+
+// Length is a unit of rain depth.
+type Length int
+
+const (
+	// Inches is inches (in)
+	Inches Length = 0
+	// Millimetres is millimetres (mm)
+	Millimetres Length = 1
+)
+
+// System is a selection of units for each quantity.
+type System struct {
+	Temperature Temperature `json:"temperature"` // Temperature is the unit of temperatures
+	Speed       Speed       `json:"speed"`       // Speed is the unit of wind speeds
+	Pressure    Pressure    `json:"pressure"`    // Pressure is the unit of barometer readings
+	Rain        Length      `json:"rain"`        // Rain is the unit of rain depths
+}
+
+var (
+	// Imperial is the US customary units reported by the WLL unit
+	Imperial = System{Temperature: Fahrenheit, Speed: MilesPerHour, Pressure: InchesOfMercury, Rain: Inches}
+	// Metric is the metric units commonly used for weather reports
+	Metric = System{Temperature: Celsius, Speed: KilometresPerHour, Pressure: Hectopascals, Rain: Millimetres}
+	// SI is the metric units with wind speed in metres per second
+	SI = System{Temperature: Celsius, Speed: MetresPerSecond, Pressure: Hectopascals, Rain: Millimetres}
+)
+
+const (
+	// mphToKMH is kilometres per hour in a mile per hour
+	mphToKMH = 1.609344
+	// mphToMS is metres per second in a mile per hour
+	mphToMS = 0.44704
+	// mphToKnots is knots in a mile per hour
+	mphToKnots = 0.868976
+	// inHgToHPa is hectopascals in an inch of mercury
+	inHgToHPa = 33.8638866667
+	// inHgToMMHg is millimetres of mercury in an inch of mercury
+	inHgToMMHg = 25.4
+	// inchToMM is millimetres in an inch
+	inchToMM = 25.4
+)
+
+// FromFahrenheit converts a temperature from °F.
+func (u Temperature) FromFahrenheit(v float64) float64 {
+	switch u {
+	case Celsius:
+		return (v - 32) * 5 / 9
+	case Kelvin:
+		return (v-32)*5/9 + 273.15
+	}
+	return v
+}
+
+// FromFahrenheitDelta converts a temperature difference from °F.
+func (u Temperature) FromFahrenheitDelta(v float64) float64 {
+	switch u {
+	case Celsius, Kelvin:
+		return v * 5 / 9
+	}
+	return v
+}
+
+// Precision returns the decimal places of temperatures in the unit.
+func (u Temperature) Precision() int {
+	return 1
+}
+
+// String returns the unit symbol.
+func (u Temperature) String() string {
+	switch u {
+	case Celsius:
+		return "°C"
+	case Kelvin:
+		return "K"
+	}
+	return "°F"
+}
+
+// MarshalText encodes the unit symbol.
+func (u Temperature) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// UnmarshalText decodes the unit symbol. It returns an error if the symbol is
+// unknown.
+func (u *Temperature) UnmarshalText(text []byte) error {
+	for _, t := range []Temperature{Fahrenheit, Celsius, Kelvin} {
+		if t.String() == string(text) {
+			*u = t
+			return nil
+		}
+	}
+	return errUnknownUnit
+}
+
+// FromMilesPerHour converts a speed from mph.
+func (u Speed) FromMilesPerHour(v float64) float64 {
+	switch u {
+	case KilometresPerHour:
+		return v * mphToKMH
+	case MetresPerSecond:
+		return v * mphToMS
+	case Knots:
+		return v * mphToKnots
+	}
+	return v
+}
+
+// Precision returns the decimal places of speeds in the unit.
+func (u Speed) Precision() int {
+	return 1
+}
+
+// String returns the unit symbol.
+func (u Speed) String() string {
+	switch u {
+	case KilometresPerHour:
+		return "km/h"
+	case MetresPerSecond:
+		return "m/s"
+	case Knots:
+		return "kn"
+	}
+	return "mph"
+}
+
+// MarshalText encodes the unit symbol.
+func (u Speed) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// UnmarshalText decodes the unit symbol. It returns an error if the symbol is
+// unknown.
+func (u *Speed) UnmarshalText(text []byte) error {
+	for _, s := range []Speed{MilesPerHour, KilometresPerHour, MetresPerSecond, Knots} {
+		if s.String() == string(text) {
+			*u = s
+			return nil
+		}
+	}
+	return errUnknownUnit
+}
+
+// FromInchesOfMercury converts a pressure from inHg.
+func (u Pressure) FromInchesOfMercury(v float64) float64 {
+	switch u {
+	case Hectopascals:
+		return v * inHgToHPa
+	case Kilopascals:
+		return v * inHgToHPa / 10
+	case MillimetresOfMercury:
+		return v * inHgToMMHg
+	}
+	return v
+}
+
+// Precision returns the decimal places of pressures in the unit.
+func (u Pressure) Precision() int {
+	switch u {
+	case Hectopascals, MillimetresOfMercury:
+		return 1
+	case Kilopascals:
+		return 2
+	}
+	return 3
+}
+
+// String returns the unit symbol.
+func (u Pressure) String() string {
+	switch u {
+	case Hectopascals:
+		return "hPa"
+	case Kilopascals:
+		return "kPa"
+	case MillimetresOfMercury:
+		return "mmHg"
+	}
+	return "inHg"
+}
+
+// MarshalText encodes the unit symbol.
+func (u Pressure) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// UnmarshalText decodes the unit symbol. It returns an error if the symbol is
+// unknown.
+func (u *Pressure) UnmarshalText(text []byte) error {
+	for _, p := range []Pressure{InchesOfMercury, Hectopascals, Kilopascals, MillimetresOfMercury} {
+		if p.String() == string(text) {
+			*u = p
+			return nil
+		}
+	}
+	return errUnknownUnit
+}
+
+// FromInches converts a length from inches.
+func (u Length) FromInches(v float64) float64 {
+	switch u {
+	case Millimetres:
+		return v * inchToMM
+	}
+	return v
+}
+
+// FromMillimetres converts a length from millimetres.
+func (u Length) FromMillimetres(v float64) float64 {
+	switch u {
+	case Inches:
+		return v / inchToMM
+	}
+	return v
+}
+
+// Precision returns the decimal places of lengths in the unit.
+func (u Length) Precision() int {
+	switch u {
+	case Millimetres:
+		return 1
+	}
+	return 2
+}
+
+// String returns the unit symbol.
+func (u Length) String() string {
+	switch u {
+	case Millimetres:
+		return "mm"
+	}
+	return "in"
+}
+
+// MarshalText encodes the unit symbol.
+func (u Length) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// UnmarshalText decodes the unit symbol. It returns an error if the symbol is
+// unknown.
+func (u *Length) UnmarshalText(text []byte) error {
+	for _, l := range []Length{Inches, Millimetres} {
+		if l.String() == string(text) {
+			*u = l
+			return nil
+		}
+	}
+	return errUnknownUnit
+}
+
+// Round rounds the value to the provided decimal places. Rounding is half away
+// from zero, so every consumer rounds identically.
+func Round(v float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(v*scale) / scale
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"time"
+
+	"github.com/tannerryan/davisweather/units"
+)
+
+// View is the Report state converted to a System of units. Rain counts are
+// converted to rain depths using the RainSize; rain fields are nil if the
+// RainSize is not provided or unknown.
+type View struct {
+	DeviceID  string       `json:"deviceID"`  // DeviceID is unique device ID
+	Timestamp time.Time    `json:"timestamp"` // Timestamp is the time the Report was last modified
+	Units     units.System `json:"units"`     // Units are the units of the View
+
+	Temperature *float64 `json:"temperature"` // Temperature (temperature unit)
+	Humidity    *float64 `json:"humidity"`    // Humidity (%RH)
+	Dewpoint    *float64 `json:"dewpoint"`    // Dewpoint (temperature unit)
+	Wetbulb     *float64 `json:"wetbulb"`     // Wetbulb (temperature unit)
+	HeatIndex   *float64 `json:"heatindex"`   // HeatIndex (temperature unit)
+	WindChill   *float64 `json:"windchill"`   // WindChill (temperature unit)
+	THWIndex    *float64 `json:"thwIndex"`    // THWIndex is "feels like" (temperature unit)
+	THSWIndex   *float64 `json:"thswIndex"`   // THWSIndex is "feels like" including solar (temperature unit)
+
+	WindSpeedLast          *float64 `json:"windSpeedLast"`          // WindSpeedLast is most recent wind speed (speed unit)
+	WindDirLast            *float64 `json:"windDirLast"`            // WindDirLast is most recent wind direction (°)
+	WindSpeedAvgLast1Min   *float64 `json:"windSpeedAvg1Min"`       // WindSpeedAvgLast1Min is average wind over last minute (speed unit)
+	WindDirAvgLast1Min     *float64 `json:"windDirAvg1Min"`         // WindDirAvgLast1Min is average wind direction over last minute (°)
+	WindSpeedAvgLast2Min   *float64 `json:"windSpeedAvg2Min"`       // WindSpeedAvgLast2Min is average wind over last 2 minutes (speed unit)
+	WindDirAvgLast2Min     *float64 `json:"windDirAvg2Min"`         // WindDirAvgLast2Min is average wind direction over last 2 minutes (°)
+	WindSpeedHighLast2Min  *float64 `json:"windGustSpeedLast2Min"`  // WindSpeedHighLast2Min is max gust over last 2 minutes (speed unit)
+	WindDirAtHighLast2Min  *float64 `json:"windGustDirLast2Min"`    // WindDirAtHighLast2Min is max gust direction over last 2 minutes (°)
+	WindSpeedAvgLast10Min  *float64 `json:"windSpeedAvg10Min"`      // WindSpeedAvgLast10Min is average wind over last 10 minutes (speed unit)
+	WindDirAvgLast10Min    *float64 `json:"windDirAvg10Min"`        // WindDirAvgLast10Min is average wind dir over last 10 minutes (°)
+	WindSpeedHighLast10Min *float64 `json:"windGustSpeedLast10Min"` // WindSpeedHighLast10Min is max gust over last 10 minutes (speed unit)
+	WindDirAtHighLast10Min *float64 `json:"windGustDirLast10Min"`   // WindDirAtHighLast10Min is max gust direction over last 10 minutes (°)
+
+	RainRateLast          *float64   `json:"rainRateLast"`          // RainRateLast is most recent rain rate (rain unit/hour)
+	RainRateHigh          *float64   `json:"rainRateHigh"`          // RainRateHigh is highest rain rate over last minute (rain unit/hour)
+	RainLast15Min         *float64   `json:"rainLast15Min"`         // RainLast15Min is rain in last 15 minutes (rain unit)
+	RainRateHighLast15Min *float64   `json:"rainRateHighLast15Min"` // RainRateHighLast15Min is highest rain rate over last 15 minutes (rain unit/hour)
+	RainLast60Min         *float64   `json:"rainLast60Min"`         // RainLast60Min is rain over last 60 minutes (rain unit)
+	RainLast24Hour        *float64   `json:"rainLast24Hour"`        // RainLast24Hour is rain over last 24 hours (rain unit)
+	RainStorm             *float64   `json:"rainStorm"`             // RainStorm is rain since last 24 hour break in rain (rain unit)
+	RainStormStartAt      *time.Time `json:"rainStormStart"`        // RainStormStartAt is time of rain storm start
+
+	SolarRad *float64 `json:"solarRad"` // SolarRad is solar radiation (W/m²)
+	UVIndex  *float64 `json:"uvIndex"`  // UVIndex is solar UV index
+
+	RXState          string `json:"signal"`  // RXState is ISS receiver status
+	TransBatteryFlag string `json:"battery"` // TransBatteryFlag is ISS battery status
+
+	RainfallDaily        *float64   `json:"rainDaily"`          // RainfallDaily is total rain since midnight (rain unit)
+	RainfallMonthly      *float64   `json:"rainMonthly"`        // RainfallMonthly is total rain since first of month (rain unit)
+	RainfallYear         *float64   `json:"rainYear"`           // RainfallYear is total rain since first of year (rain unit)
+	RainStormLast        *float64   `json:"rainStormLast"`      // RainStormLast is rain since last 24 hour break in rain (rain unit)
+	RainStormLastStartAt *time.Time `json:"rainStormLastStart"` // RainStormLastStartAt is time of last rain storm start
+	RainStormLastEndAt   *time.Time `json:"rainStormLastEnd"`   // rainStormLastEndAt is time of last rain storm end
+
+	BarometerSeaLevel *float64 `json:"barometerSeaLevel"` // BarometerSeaLevel is barometer reading with elevation adjustment (pressure unit)
+	BarometerTrend    *float64 `json:"barometerTrend"`    // BarometerTrend is 3 hour barometric trend (pressure unit)
+	BarometerAbsolute *float64 `json:"barometerAbsolute"` // BarometerAbsolute is barometer reading at current elevation (pressure unit)
+
+	SoilTemperature1 *float64 `json:"soilTemperature1"` // SoilTemperature1 is soil temperature of slot 1 (temperature unit)
+	SoilTemperature2 *float64 `json:"soilTemperature2"` // SoilTemperature2 is soil temperature of slot 2 (temperature unit)
+	SoilTemperature3 *float64 `json:"soilTemperature3"` // SoilTemperature3 is soil temperature of slot 3 (temperature unit)
+	SoilTemperature4 *float64 `json:"soilTemperature4"` // SoilTemperature4 is soil temperature of slot 4 (temperature unit)
+	SoilMoisture1    *float64 `json:"soilMoisture1"`    // SoilMoisture1 is soil moisture of slot 1 (cb)
+	SoilMoisture2    *float64 `json:"soilMoisture2"`    // SoilMoisture2 is soil moisture of slot 2 (cb)
+	SoilMoisture3    *float64 `json:"soilMoisture3"`    // SoilMoisture3 is soil moisture of slot 3 (cb)
+	SoilMoisture4    *float64 `json:"soilMoisture4"`    // SoilMoisture4 is soil moisture of slot 4 (cb)
+	LeafWetness1     *float64 `json:"leafWetness1"`     // LeafWetness1 is leaf wetness of slot 1 (0-15)
+	LeafWetness2     *float64 `json:"leafWetness2"`     // LeafWetness2 is leaf wetness of slot 2 (0-15)
+
+	TemperatureIndoor *float64 `json:"indoorTemperature"` // TemperatureIndoor is indoor temp (temperature unit)
+	HumidityIndoor    *float64 `json:"indoorHumidity"`    // HumidityIndoor is indoor humidity (%)
+	DewPointIndoor    *float64 `json:"indoorDewpoint"`    // DewPointIndoor is indoor dewpoint (temperature unit)
+	HeatIndexIndoor   *float64 `json:"indoorHeatIndex"`   // HeatIndexIndoor is indoor heat index (temperature unit)
+}
+
+// In returns the Report state converted to the provided System of units. Each
+// converted value is rounded to the precision of its unit. The View does not
+// share any values with the Report.
+func (r *Report) In(s units.System) *View {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	temp := func(v *float64) *float64 {
+		return convert(v, s.Temperature.FromFahrenheit, s.Temperature.Precision())
+	}
+	speed := func(v *float64) *float64 {
+		return convert(v, s.Speed.FromMilesPerHour, s.Speed.Precision())
+	}
+	pressure := func(v *float64) *float64 {
+		return convert(v, s.Pressure.FromInchesOfMercury, s.Pressure.Precision())
+	}
+	collector, err := rainCollector(r.RainSize)
+	size, _ := collector.Depth()
+	rain := func(v *float64) *float64 {
+		if err != nil {
+			return nil
+		}
+		return convert(v, func(count float64) float64 {
+			return (Depth(count) * size).In(s.Rain)
+		}, s.Rain.Precision())
+	}
+
+	return &View{
+		DeviceID:  r.DeviceID,
+		Timestamp: r.Timestamp,
+		Units:     s,
+
+		Temperature: temp(r.Temperature),
+		Humidity:    copyFloat(r.Humidity),
+		Dewpoint:    temp(r.Dewpoint),
+		Wetbulb:     temp(r.Wetbulb),
+		HeatIndex:   temp(r.HeatIndex),
+		WindChill:   temp(r.WindChill),
+		THWIndex:    temp(r.THWIndex),
+		THSWIndex:   temp(r.THSWIndex),
+
+		WindSpeedLast:          speed(r.WindSpeedLast),
+		WindDirLast:            copyFloat(r.WindDirLast),
+		WindSpeedAvgLast1Min:   speed(r.WindSpeedAvgLast1Min),
+		WindDirAvgLast1Min:     copyFloat(r.WindDirAvgLast1Min),
+		WindSpeedAvgLast2Min:   speed(r.WindSpeedAvgLast2Min),
+		WindDirAvgLast2Min:     copyFloat(r.WindDirAvgLast2Min),
+		WindSpeedHighLast2Min:  speed(r.WindSpeedHighLast2Min),
+		WindDirAtHighLast2Min:  copyFloat(r.WindDirAtHighLast2Min),
+		WindSpeedAvgLast10Min:  speed(r.WindSpeedAvgLast10Min),
+		WindDirAvgLast10Min:    copyFloat(r.WindDirAvgLast10Min),
+		WindSpeedHighLast10Min: speed(r.WindSpeedHighLast10Min),
+		WindDirAtHighLast10Min: copyFloat(r.WindDirAtHighLast10Min),
+
+		RainRateLast:          rain(r.RainRateLast),
+		RainRateHigh:          rain(r.RainRateHigh),
+		RainLast15Min:         rain(r.RainLast15Min),
+		RainRateHighLast15Min: rain(r.RainRateHighLast15Min),
+		RainLast60Min:         rain(r.RainLast60Min),
+		RainLast24Hour:        rain(r.RainLast24Hour),
+		RainStorm:             rain(r.RainStorm),
+		RainStormStartAt:      copyTime(r.RainStormStartAt),
+
+		SolarRad: copyFloat(r.SolarRad),
+		UVIndex:  copyFloat(r.UVIndex),
+
+		RXState:          r.RXState,
+		TransBatteryFlag: r.TransBatteryFlag,
+
+		RainfallDaily:        rain(r.RainfallDaily),
+		RainfallMonthly:      rain(r.RainfallMonthly),
+		RainfallYear:         rain(r.RainfallYear),
+		RainStormLast:        rain(r.RainStormLast),
+		RainStormLastStartAt: copyTime(r.RainStormLastStartAt),
+		RainStormLastEndAt:   copyTime(r.RainStormLastEndAt),
+
+		BarometerSeaLevel: pressure(r.BarometerSeaLevel),
+		BarometerTrend:    pressure(r.BarometerTrend),
+		BarometerAbsolute: pressure(r.BarometerAbsolute),
+
+		SoilTemperature1: temp(r.SoilTemperature1),
+		SoilTemperature2: temp(r.SoilTemperature2),
+		SoilTemperature3: temp(r.SoilTemperature3),
+		SoilTemperature4: temp(r.SoilTemperature4),
+		SoilMoisture1:    copyFloat(r.SoilMoisture1),
+		SoilMoisture2:    copyFloat(r.SoilMoisture2),
+		SoilMoisture3:    copyFloat(r.SoilMoisture3),
+		SoilMoisture4:    copyFloat(r.SoilMoisture4),
+		LeafWetness1:     copyFloat(r.LeafWetness1),
+		LeafWetness2:     copyFloat(r.LeafWetness2),
+
+		TemperatureIndoor: temp(r.TemperatureIndoor),
+		HumidityIndoor:    copyFloat(r.HumidityIndoor),
+		DewPointIndoor:    temp(r.DewPointIndoor),
+		HeatIndexIndoor:   temp(r.HeatIndexIndoor),
+	}
+}
+
+// convert returns a new value converted with the provided function and rounded
+// to the provided decimal places. It returns nil if the value is nil.
+func convert(v *float64, fn func(float64) float64, places int) *float64 {
+	if v == nil {
+		return nil
+	}
+	out := units.Round(fn(*v), places)
+	return &out
+}
+
+// copyFloat returns a copy of the value. It returns nil if the value is nil.
+func copyFloat(v *float64) *float64 {
+	if v == nil {
+		return nil
+	}
+	out := *v
+	return &out
+}
+
+// copyTime returns a copy of the time. It returns nil if the time is nil.
+func copyTime(v *time.Time) *time.Time {
+	if v == nil {
+		return nil
+	}
+	out := *v
+	return &out
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package davisweather
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/davisweather/units"
+)
+
+// viewPayload is the Report state of the View tests
+const viewPayload = `{"temperature":77,"humidity":50,"windSpeedLast":10,"windDirLast":90,
+	"barometerSeaLevel":29.92,"rainSize":%s,"rainDaily":10,"solarRad":450,
+	"rainStormStart":"2020-06-16T12:00:00Z","signal":"Synced","battery":"Nominal"}`
+
+// value returns the value, or -1 if the value is nil.
+func value(v *float64) float64 {
+	if v == nil {
+		return -1
+	}
+	return *v
+}
+
+func TestViewIn(t *testing.T) {
+	for _, test := range []struct {
+		rainSize string
+		system   units.System
+		want     map[string]float64
+	}{
+		{"1", units.Metric, map[string]float64{
+			"temperature": 25, "humidity": 50, "windSpeedLast": 16.1, "windDirLast": 90,
+			"barometerSeaLevel": 1013.2, "rainDaily": 2.5, "solarRad": 450,
+		}},
+		{"1", units.Imperial, map[string]float64{
+			"temperature": 77, "humidity": 50, "windSpeedLast": 10, "windDirLast": 90,
+			"barometerSeaLevel": 29.92, "rainDaily": 0.1, "solarRad": 450,
+		}},
+		{"2", units.Metric, map[string]float64{"rainDaily": 2}},
+		{"2", units.Imperial, map[string]float64{"rainDaily": 0.08}},
+		{"3", units.Metric, map[string]float64{"rainDaily": 1}},
+		{"4", units.Imperial, map[string]float64{"rainDaily": 0.01}},
+		// rain is unknown without a known collector
+		{"5", units.Metric, map[string]float64{"temperature": 25, "rainDaily": -1}},
+		{"null", units.Imperial, map[string]float64{"temperature": 77, "rainDaily": -1}},
+	} {
+		r := newTestReport(t, fmt.Sprintf(viewPayload, test.rainSize))
+		v := r.In(test.system)
+		if v.Units != test.system || v.DeviceID != r.DeviceID || !v.Timestamp.Equal(r.Timestamp) {
+			t.Errorf("rainSize %s: View = %+v", test.rainSize, v)
+		}
+		got := map[string]float64{
+			"temperature":       value(v.Temperature),
+			"humidity":          value(v.Humidity),
+			"windSpeedLast":     value(v.WindSpeedLast),
+			"windDirLast":       value(v.WindDirLast),
+			"barometerSeaLevel": value(v.BarometerSeaLevel),
+			"rainDaily":         value(v.RainfallDaily),
+			"solarRad":          value(v.SolarRad),
+		}
+		for field, want := range test.want {
+			if got[field] != want {
+				t.Errorf("rainSize %s: %s in %+v = %v, want %v", test.rainSize, field, test.system, got[field], want)
+			}
+		}
+		if v.RainStormStartAt == nil || !v.RainStormStartAt.Equal(*r.RainStormStartAt) {
+			t.Errorf("rainSize %s: RainStormStartAt = %v", test.rainSize, v.RainStormStartAt)
+		}
+		if v.Dewpoint != nil || v.RainRateLast != nil {
+			t.Errorf("rainSize %s: missing values = %v, %v, want nil", test.rainSize, v.Dewpoint, v.RainRateLast)
+		}
+	}
+}
+
+func TestViewCopy(t *testing.T) {
+	r := newTestReport(t, fmt.Sprintf(viewPayload, "1"))
+	v := r.In(units.Imperial)
+
+	// no pointer of the View is shared with the Report
+	report := reflect.ValueOf(r).Elem()
+	view := reflect.ValueOf(v).Elem()
+	for i := 0; i < view.NumField(); i++ {
+		f := view.Field(i)
+		if f.Kind() != reflect.Ptr || f.IsNil() {
+			continue
+		}
+		name := view.Type().Field(i).Name
+		if rf := report.FieldByName(name); rf.IsValid() && rf.Pointer() == f.Pointer() {
+			t.Errorf("%s is shared with the Report", name)
+		}
+	}
+
+	*v.Humidity = 0
+	*v.WindDirLast = 0
+	*v.SolarRad = 0
+	*v.RainStormStartAt = time.Time{}
+	if *r.Humidity != 50 || *r.WindDirLast != 90 || *r.SolarRad != 450 || r.RainStormStartAt.IsZero() {
+		t.Errorf("Report changed by the View = %v, %v, %v, %v", *r.Humidity, *r.WindDirLast, *r.SolarRad, r.RainStormStartAt)
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+// Package wind analyzes the wind speed and direction stream broadcast by the
+// WeatherLink Live unit every 2.5 seconds: vector averages, gust factor,
+// direction variability (sigma-theta) and wind rose histograms.
+package wind
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tannerryan/davisweather"
+	"github.com/tannerryan/davisweather/derived"
+)
+
+const (
+	// defaultRetention is the default duration samples are kept
+	defaultRetention = 24 * time.Hour
+	// defaultCalm is the default calm wind speed threshold (mph)
+	defaultCalm = 1
+	// sampleInterval is the time between samples of the Client, matching the
+	// UDP broadcast interval
+	sampleInterval = 2500 * time.Millisecond
+	// sectors is the number of wind rose sectors
+	sectors = 16
+	// sectorWidth is the width of a wind rose sector (°)
+	sectorWidth = 360.0 / sectors
+)
+
+var (
+	// defaultSpeedBins are the default wind rose speed bin upper limits (mph)
+	defaultSpeedBins = []float64{5, 10, 15, 20, 25}
+)
+
+// Sample is a single wind observation.
+type Sample struct {
+	Time  time.Time `json:"time"`  // Time is when the wind was observed
+	Speed float64   `json:"speed"` // Speed is wind speed (mph)
+	Dir   float64   `json:"dir"`   // Dir is wind direction (°)
+}
+
+// Summary is the wind over a window.
+type Summary struct {
+	Window      time.Duration `json:"window"`      // Window is the duration summarized
+	Samples     int           `json:"samples"`     // Samples is the number of observations
+	VectorSpeed float64       `json:"vectorSpeed"` // VectorSpeed is the magnitude of the mean wind vector (mph)
+	VectorDir   float64       `json:"vectorDir"`   // VectorDir is the direction of the mean wind vector (°)
+	ScalarSpeed float64       `json:"scalarSpeed"` // ScalarSpeed is the mean wind speed (mph)
+	UnitDir     float64       `json:"unitDir"`     // UnitDir is the mean direction ignoring speed (°)
+	Gust        float64       `json:"gust"`        // Gust is the highest wind speed (mph)
+	GustFactor  float64       `json:"gustFactor"`  // GustFactor is the ratio of Gust to ScalarSpeed (0 if calm)
+	SigmaTheta  float64       `json:"sigmaTheta"`  // SigmaTheta is the Yamartino standard deviation of direction (°)
+	Calm        int           `json:"calm"`        // Calm is the number of calm observations, excluded from direction statistics
+}
+
+// Sector is a single wind rose sector.
+type Sector struct {
+	Name      string  `json:"name"`      // Name is the compass point of the sector (N, NNE, ...)
+	Dir       float64 `json:"dir"`       // Dir is the centre direction of the sector (°)
+	Count     int     `json:"count"`     // Count is the number of observations from the sector
+	Frequency float64 `json:"frequency"` // Frequency is the fraction of all observations from the sector
+	MeanSpeed float64 `json:"meanSpeed"` // MeanSpeed is the mean wind speed from the sector (mph)
+	Bins      []int   `json:"bins"`      // Bins are the observations per speed bin of the Rose Limits
+}
+
+// Rose is a 16 sector wind rose histogram.
+type Rose struct {
+	Window  time.Duration `json:"window"`  // Window is the duration summarized
+	Samples int           `json:"samples"` // Samples is the number of observations
+	Calm    int           `json:"calm"`    // Calm is the number of calm observations
+	Limits  []float64     `json:"limits"`  // Limits are the speed bin upper limits (mph), the last bin is unbounded
+	Sectors []Sector      `json:"sectors"` // Sectors are the sectors clockwise from north
+}
+
+// Options configures an Analyzer.
+type Options struct {
+	Retention time.Duration // Retention is how long samples are kept (default 24 hours)
+	Calm      float64       // Calm is the wind speed below which wind is calm (default 1 mph)
+	SpeedBins []float64     // SpeedBins are the wind rose speed bin upper limits (default 5, 10, 15, 20, 25 mph)
+}
+
+// Analyzer computes wind statistics over the retained samples.
+type Analyzer struct {
+	retention time.Duration // retention is how long samples are kept
+	calm      float64       // calm is the calm wind speed threshold
+	bins      []float64     // bins are the wind rose speed bin upper limits
+	interval  time.Duration // interval is the time between samples of Run
+	samples   []Sample      // samples are the retained samples, oldest first
+	mutex     *sync.Mutex   // mutex is for atomic analyzer actions
+}
+
+// New returns an Analyzer with no samples.
+func New(opts Options) *Analyzer {
+	a := &Analyzer{
+		retention: opts.Retention,
+		calm:      opts.Calm,
+		bins:      append([]float64(nil), opts.SpeedBins...),
+		interval:  sampleInterval,
+		mutex:     &sync.Mutex{},
+	}
+	if a.retention <= 0 {
+		a.retention = defaultRetention
+	}
+	if a.calm <= 0 {
+		a.calm = defaultCalm
+	}
+	if len(a.bins) == 0 {
+		a.bins = append([]float64(nil), defaultSpeedBins...)
+	}
+	sort.Float64s(a.bins)
+	return a
+}
+
+// Run samples the most recent wind speed and direction of the Client every
+// 2.5 seconds, until the context is cancelled. A sample is added whenever a UDP
+// broadcast was received since the previous sample, whether or not the wind
+// changed, so steady wind is weighted like changing wind.
+func (a *Analyzer) Run(ctx context.Context, c *davisweather.Client) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	var last time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// only sample live wind
+		received := c.Status().LastUDP
+		if !received.After(last) {
+			continue
+		}
+		last = received
+		r, err := c.Report()
+		if err != nil || r.WindSpeedLast == nil || r.WindDirLast == nil {
+			continue
+		}
+		a.Observe(received, *r.WindSpeedLast, *r.WindDirLast)
+	}
+}
+
+// Update adds a sample from the most recent wind speed and direction of the
+// Report, if provided.
+func (a *Analyzer) Update(r *davisweather.Report) {
+	if r.WindSpeedLast == nil || r.WindDirLast == nil {
+		return
+	}
+	a.Observe(r.Timestamp, *r.WindSpeedLast, *r.WindDirLast)
+}
+
+// Observe adds a sample observed at the provided time. Samples older than the
+// most recent sample are ignored.
+func (a *Analyzer) Observe(at time.Time, speed float64, dir float64) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if n := len(a.samples); n > 0 && at.Before(a.samples[n-1].Time) {
+		return
+	}
+	a.samples = append(a.samples, Sample{Time: at, Speed: speed, Dir: math.Mod(math.Mod(dir, 360)+360, 360)})
+
+	// drop expired samples
+	cutoff := at.Add(-a.retention)
+	i := sort.Search(len(a.samples), func(i int) bool {
+		return !a.samples[i].Time.Before(cutoff)
+	})
+	if i > 0 {
+		a.samples = append(a.samples[:0], a.samples[i:]...)
+	}
+}
+
+// Samples returns the samples within the window before the most recent sample.
+func (a *Analyzer) Samples(window time.Duration) []Sample {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return append([]Sample(nil), a.window(window)...)
+}
+
+// Summary returns the wind statistics within the window before the most recent
+// sample. Direction statistics exclude calm samples.
+func (a *Analyzer) Summary(window time.Duration) Summary {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	s := Summary{Window: window}
+	var speedSum, sinSum, cosSum, unitSin, unitCos float64
+	var directional int
+	for _, sample := range a.window(window) {
+		s.Samples++
+		speedSum += sample.Speed
+		s.Gust = math.Max(s.Gust, sample.Speed)
+		if sample.Speed < a.calm {
+			s.Calm++
+			continue
+		}
+		directional++
+		rad := sample.Dir * math.Pi / 180
+		sinSum += sample.Speed * math.Sin(rad)
+		cosSum += sample.Speed * math.Cos(rad)
+		unitSin += math.Sin(rad)
+		unitCos += math.Cos(rad)
+	}
+	if s.Samples == 0 {
+		return s
+	}
+
+	s.ScalarSpeed = speedSum / float64(s.Samples)
+	if s.ScalarSpeed > 0 {
+		s.GustFactor = s.Gust / s.ScalarSpeed
+	}
+	if directional == 0 {
+		return s
+	}
+	n := float64(s.Samples)
+	s.VectorSpeed = math.Hypot(sinSum/n, cosSum/n)
+	s.VectorDir = direction(sinSum, cosSum)
+	s.UnitDir = direction(unitSin, unitCos)
+
+	// Yamartino method
+	sa, ca := unitSin/float64(directional), unitCos/float64(directional)
+	epsilon := math.Sqrt(math.Max(0, 1-(sa*sa+ca*ca)))
+	s.SigmaTheta = math.Asin(epsilon) * (1 + (2/math.Sqrt(3)-1)*math.Pow(epsilon, 3)) * 180 / math.Pi
+	return s
+}
+
+// Rose returns the wind rose histogram within the window before the most
+// recent sample. Calm samples are counted separately.
+func (a *Analyzer) Rose(window time.Duration) Rose {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	rose := Rose{
+		Window:  window,
+		Limits:  append([]float64(nil), a.bins...),
+		Sectors: make([]Sector, sectors),
+	}
+	speeds := make([]float64, sectors)
+	for i := range rose.Sectors {
+		dir := float64(i) * sectorWidth
+		rose.Sectors[i] = Sector{
+			Name: derived.CompassPoint(dir),
+			Dir:  dir,
+			Bins: make([]int, len(a.bins)+1),
+		}
+	}
+	for _, sample := range a.window(window) {
+		rose.Samples++
+		if sample.Speed < a.calm {
+			rose.Calm++
+			continue
+		}
+		i := int(math.Mod(sample.Dir+sectorWidth/2, 360) / sectorWidth)
+		sector := &rose.Sectors[i]
+		sector.Count++
+		speeds[i] += sample.Speed
+		bin := sort.Search(len(a.bins), func(b int) bool {
+			return sample.Speed < a.bins[b]
+		})
+		sector.Bins[bin]++
+	}
+	for i := range rose.Sectors {
+		sector := &rose.Sectors[i]
+		if rose.Samples > 0 {
+			sector.Frequency = float64(sector.Count) / float64(rose.Samples)
+		}
+		if sector.Count > 0 {
+			sector.MeanSpeed = speeds[i] / float64(sector.Count)
+		}
+	}
+	return rose
+}
+
+// window returns the samples within the window before the most recent sample.
+func (a *Analyzer) window(window time.Duration) []Sample {
+	n := len(a.samples)
+	if n == 0 {
+		return nil
+	}
+	cutoff := a.samples[n-1].Time.Add(-window)
+	i := sort.Search(n, func(i int) bool {
+		return a.samples[i].Time.After(cutoff)
+	})
+	return a.samples[i:]
+}
+
+// direction returns the direction (°) of the vector sum of the provided sine
+// and cosine components.
+func direction(sin float64, cos float64) float64 {
+	dir := math.Atan2(sin, cos) * 180 / math.Pi
+	if dir < 0 {
+		dir += 360
+	}
+	if dir >= 360 {
+		// rounding of small negative angles
+		dir = 0
+	}
+	return dir
+}
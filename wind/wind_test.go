@@ -0,0 +1,70 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package wind
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/davisweather"
+	"github.com/tannerryan/davisweather/davisweathertest"
+)
+
+func TestRunSteadyWind(t *testing.T) {
+	unit, err := davisweathertest.Start(davisweathertest.Config{BroadcastInterval: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unit.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := davisweather.Unmanaged(ctx, false, unit.Host(), unit.Port(),
+		davisweather.WithHTTPStartDelay(0),
+		davisweather.WithUDPDeadline(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := New(Options{})
+	a.interval = 100 * time.Millisecond
+	done := make(chan struct{})
+	go func() {
+		a.Run(ctx, c)
+		close(done)
+	}()
+
+	// steady wind is sampled once per broadcast interval
+	deadline := time.Now().Add(5 * time.Second)
+	for len(a.Samples(time.Hour)) < 5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("samples = %d after 5 seconds, want at least 5", len(a.Samples(time.Hour)))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	s := a.Summary(time.Hour)
+	if math.Abs(s.VectorSpeed-davisweathertest.Typical.WindSpeed) > 1e-9 || math.Abs(s.VectorDir-davisweathertest.Typical.WindDir) > 1e-9 {
+		t.Errorf("Summary = %+v, want %v mph from %v°", s, davisweathertest.Typical.WindSpeed, davisweathertest.Typical.WindDir)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
+
+func TestSummaryAroundNorth(t *testing.T) {
+	a := New(Options{})
+	start := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	a.Observe(start, 10, 350)
+	a.Observe(start.Add(time.Second), 10, 10)
+
+	s := a.Summary(time.Minute)
+	if s.Samples != 2 || math.Abs(s.UnitDir) > 1e-9 && math.Abs(s.UnitDir-360) > 1e-9 {
+		t.Errorf("Summary = %+v, want 2 samples from north", s)
+	}
+}
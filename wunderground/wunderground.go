@@ -0,0 +1,283 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+// Package wunderground uploads the Report of a Client to a Weather Underground
+// personal weather station (PWS), using the standard upload protocol or
+// RapidFire real-time updates.
+package wunderground
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tannerryan/davisweather"
+)
+
+const (
+	// StandardURL is the upload endpoint of standard updates
+	StandardURL = "https://weatherstation.wunderground.com/weatherstation/updateweatherstation.php"
+	// RapidFireURL is the upload endpoint of RapidFire updates
+	RapidFireURL = "https://rtupdate.wunderground.com/weatherstation/updateweatherstation.php"
+
+	// defaultStandardInterval is the default time between standard updates
+	defaultStandardInterval = 5 * time.Minute
+	// defaultRapidFireInterval is the default time between RapidFire updates,
+	// matching the UDP broadcasts of the WLL unit
+	defaultRapidFireInterval = 2500 * time.Millisecond
+	// defaultRetries is the default number of retries of a failed upload
+	defaultRetries = 3
+	// defaultBackoff is the default delay before the first retry
+	defaultBackoff = 2 * time.Second
+	// defaultTimeout is the default timeout of each upload attempt
+	defaultTimeout = 10 * time.Second
+	// resultBuffer is the capacity of the channel returned by Run
+	resultBuffer = 16
+	// dateLayout is the layout of the dateutc parameter
+	dateLayout = "2006-01-02 15:04:05"
+	// softwareType is the softwaretype parameter
+	softwareType = "davisweather"
+	// responseSuccess is the response body of an accepted upload
+	responseSuccess = "success"
+)
+
+var (
+	// ErrStationMissing is returned when the station ID or key is not provided
+	ErrStationMissing = errors.New("wunderground: station ID and key not provided")
+	// ErrRejected is returned when the upload is not accepted
+	ErrRejected = errors.New("wunderground: upload rejected")
+	// ErrNoObservation is returned when uploading a Report without a Timestamp
+	ErrNoObservation = errors.New("wunderground: report has no observation")
+)
+
+// Mode is the upload protocol.
+type Mode int
+
+const (
+	// Standard uploads every few minutes
+	Standard Mode = 0
+	// RapidFire uploads real-time updates every few seconds
+	RapidFire Mode = 1
+)
+
+// Options configures an Uploader.
+type Options struct {
+	StationID string        // StationID is the PWS station ID
+	Key       string        // Key is the PWS station key (password)
+	Mode      Mode          // Mode is the upload protocol
+	URL       string        // URL is the upload endpoint (default StandardURL or RapidFireURL)
+	Interval  time.Duration // Interval is the time between uploads of Run (default 5 minutes, or 2.5 seconds for RapidFire)
+	Retries   int           // Retries is the number of retries of a failed upload (default 3, negative disables)
+	Backoff   time.Duration // Backoff is the delay before the first retry, doubled for each retry (default 2 seconds)
+	Timeout   time.Duration // Timeout is the timeout of each upload attempt (default 10 seconds)
+
+	Logger davisweather.Logger // Logger receives upload failures (default discards)
+}
+
+// Result is the outcome of an upload.
+type Result struct {
+	Observed time.Time     // Observed is the Timestamp of the uploaded Report
+	Time     time.Time     // Time is when the upload completed
+	Attempts int           // Attempts is the number of upload attempts
+	Status   int           // Status is the HTTP status of the last attempt (0 if no response)
+	Response string        // Response is the response body of the last attempt
+	Duration time.Duration // Duration is the total time spent uploading
+	Err      error         // Err is the error of the last attempt (nil if accepted)
+}
+
+// Uploader uploads Reports to Weather Underground.
+type Uploader struct {
+	opts   Options      // opts are the Uploader options
+	client *http.Client // client is the HTTP client
+}
+
+// New returns an Uploader with the provided options. It returns an error if
+// the station ID or key is not provided.
+func New(opts Options) (*Uploader, error) {
+	if opts.StationID == "" || opts.Key == "" {
+		return nil, ErrStationMissing
+	}
+	if opts.URL == "" {
+		opts.URL = StandardURL
+		if opts.Mode == RapidFire {
+			opts.URL = RapidFireURL
+		}
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultStandardInterval
+		if opts.Mode == RapidFire {
+			opts.Interval = defaultRapidFireInterval
+		}
+	}
+	if opts.Retries == 0 {
+		opts.Retries = defaultRetries
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = defaultBackoff
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.Logger == nil {
+		opts.Logger = davisweather.NopLogger()
+	}
+	return &Uploader{opts: opts, client: &http.Client{Timeout: opts.Timeout}}, nil
+}
+
+// Run uploads the Report of the Client every Interval until the context is
+// cancelled. Uploads are skipped while the Client is not receiving weather
+// conditions, so the station appears offline rather than reporting stale
+// conditions. The returned channel receives the Result of every upload;
+// Results are dropped if the channel is full. The channel is closed when the
+// context is cancelled.
+func (u *Uploader) Run(ctx context.Context, c *davisweather.Client) <-chan Result {
+	results := make(chan Result, resultBuffer)
+	go func() {
+		defer close(results)
+		ticker := time.NewTicker(u.opts.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			state := c.Status().State
+			if state != davisweather.StateLive && state != davisweather.StatePolling {
+				continue
+			}
+			report, err := c.Report()
+			if err != nil || report.Timestamp.IsZero() {
+				continue
+			}
+			result := u.Upload(ctx, report)
+			if result.Err != nil && ctx.Err() == nil {
+				u.opts.Logger.Log(davisweather.LevelWarn, "upload failed", davisweather.LogComponent, "wunderground",
+					"attempts", result.Attempts, "status", result.Status, davisweather.LogError, result.Err)
+			}
+			select {
+			case results <- result:
+			default:
+			}
+		}
+	}()
+	return results
+}
+
+// Upload uploads the Report, retrying failed attempts with exponential
+// backoff. Rejected credentials and malformed requests are not retried.
+func (u *Uploader) Upload(ctx context.Context, r *davisweather.Report) Result {
+	start := time.Now()
+	result := Result{Observed: r.Timestamp}
+	if r.Timestamp.IsZero() {
+		result.Err = ErrNoObservation
+		result.Time = start
+		return result
+	}
+
+	query := Params(r)
+	query.Set("ID", u.opts.StationID)
+	query.Set("PASSWORD", u.opts.Key)
+	query.Set("action", "updateraw")
+	query.Set("softwaretype", softwareType)
+	if u.opts.Mode == RapidFire {
+		query.Set("realtime", "1")
+		query.Set("rtfreq", strconv.FormatFloat(u.opts.Interval.Seconds(), 'f', -1, 64))
+	}
+	endpoint := u.opts.URL + "?" + query.Encode()
+
+	backoff := u.opts.Backoff
+	for {
+		result.Attempts++
+		retry := u.attempt(ctx, endpoint, &result)
+		if result.Err == nil || !retry || result.Attempts > u.opts.Retries {
+			break
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			result.Err = ctx.Err()
+			result.Time = time.Now()
+			result.Duration = result.Time.Sub(start)
+			return result
+		}
+		backoff *= 2
+	}
+	result.Time = time.Now()
+	result.Duration = result.Time.Sub(start)
+	return result
+}
+
+// attempt performs a single upload, recording the response in the Result. It
+// returns true if a failed attempt should be retried.
+func (u *Uploader) attempt(ctx context.Context, endpoint string, result *Result) bool {
+	result.Status = 0
+	result.Response = ""
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		result.Err = err
+		return false
+	}
+	resp, err := u.client.Do(req.WithContext(ctx))
+	if err != nil {
+		result.Err = err
+		return ctx.Err() == nil
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		result.Err = err
+		return true
+	}
+
+	result.Status = resp.StatusCode
+	result.Response = strings.TrimSpace(string(body))
+	if resp.StatusCode == http.StatusOK && strings.HasPrefix(strings.ToLower(result.Response), responseSuccess) {
+		result.Err = nil
+		return false
+	}
+	result.Err = ErrRejected
+	// server failures and rate limiting are transient
+	return resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+}
+
+// Params returns the weather parameters of the Report. Rain counts are
+// converted to inches using the RainSize. Fields that are not provided are
+// omitted.
+func Params(r *davisweather.Report) url.Values {
+	params := url.Values{}
+	params.Set("dateutc", r.Timestamp.UTC().Format(dateLayout))
+	set := func(name string, v *float64, places int) {
+		if v != nil {
+			params.Set(name, strconv.FormatFloat(*v, 'f', places, 64))
+		}
+	}
+	set("tempf", r.Temperature, 1)
+	set("humidity", r.Humidity, 0)
+	set("dewptf", r.Dewpoint, 1)
+	set("windspeedmph", r.WindSpeedLast, 1)
+	set("windgustmph", r.WindSpeedHighLast2Min, 1)
+	set("winddir", r.WindDirLast, 0)
+	set("baromin", r.BarometerSeaLevel, 3)
+	set("solarradiation", r.SolarRad, 0)
+	set("UV", r.UVIndex, 1)
+
+	for name, field := range map[string]davisweather.RainField{
+		"rainin":      davisweather.RainFieldLast60Min,
+		"dailyrainin": davisweather.RainFieldDaily,
+	} {
+		if depth, err := r.RainDepth(field); err == nil {
+			inches := depth.Inches()
+			set(name, &inches, 3)
+		}
+	}
+	return params
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2020 Tanner Ryan. All rights reserved. Use of this source code
+// is governed by a BSD-style license that can be found in the LICENSE file.
+
+package wunderground
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/davisweather"
+)
+
+// testReport returns a Report loaded from the JSON payload, observed at
+// 2020-06-16 14:25:00 UTC.
+func testReport(t *testing.T, payload string) *davisweather.Report {
+	t.Helper()
+	r, _ := davisweather.NewReport(false)
+	if err := r.UpdateJSON([]byte(payload)); err != nil {
+		t.Fatal(err)
+	}
+	r.Timestamp = time.Date(2020, 6, 16, 14, 25, 0, 0, time.UTC)
+	return r
+}
+
+// standIn is an HTTP stand-in of the upload endpoint answering with the
+// scripted statuses and bodies, then success.
+type standIn struct {
+	statuses []int        // statuses are the scripted response statuses
+	bodies   []string     // bodies are the scripted response bodies
+	queries  []url.Values // queries are the received upload parameters
+	mutex    *sync.Mutex  // mutex is for atomic stand-in actions
+
+	server *httptest.Server // server is the HTTP server
+}
+
+// newStandIn starts an HTTP stand-in with the scripted responses.
+func newStandIn(statuses []int, bodies []string) *standIn {
+	s := &standIn{statuses: statuses, bodies: bodies, mutex: &sync.Mutex{}}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.queries = append(s.queries, req.URL.Query())
+		status, body := http.StatusOK, "success\n"
+		if len(s.statuses) > 0 {
+			status, body = s.statuses[0], s.bodies[0]
+			s.statuses, s.bodies = s.statuses[1:], s.bodies[1:]
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	return s
+}
+
+// query returns the upload parameters of the request.
+func (s *standIn) query(i int) url.Values {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.queries[i]
+}
+
+func TestParams(t *testing.T) {
+	r := testReport(t, `{"temperature":77.04,"humidity":50.4,"dewpoint":56.96,
+		"windSpeedLast":4,"windGustSpeedLast2Min":5.2,"windDirLast":220,
+		"rainSize":1,"rainLast60Min":12,"rainDaily":34,
+		"barometerSeaLevel":29.9213,"solarRad":450,"uvIndex":3.2}`)
+	got := Params(r)
+	want := url.Values{
+		"dateutc":        {"2020-06-16 14:25:00"},
+		"tempf":          {"77.0"},
+		"humidity":       {"50"},
+		"dewptf":         {"57.0"},
+		"windspeedmph":   {"4.0"},
+		"windgustmph":    {"5.2"},
+		"winddir":        {"220"},
+		"rainin":         {"0.120"},
+		"dailyrainin":    {"0.340"},
+		"baromin":        {"29.921"},
+		"solarradiation": {"450"},
+		"UV":             {"3.2"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Params =\n%v\nwant\n%v", got, want)
+	}
+
+	// rain in millimetres and missing fields
+	r = testReport(t, `{"rainSize":2,"rainLast60Min":5}`)
+	got = Params(r)
+	want = url.Values{
+		"dateutc": {"2020-06-16 14:25:00"},
+		"rainin":  {"0.039"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Params =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	s := newStandIn([]int{http.StatusServiceUnavailable}, []string{"busy"})
+	defer s.server.Close()
+	u, err := New(Options{StationID: "KTEST1", Key: "secret", URL: s.server.URL, Mode: RapidFire, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := u.Upload(context.Background(), testReport(t, `{"temperature":77}`))
+	if result.Err != nil || result.Attempts != 2 || result.Status != http.StatusOK || result.Response != "success" {
+		t.Fatalf("Result = %+v, want success after 2 attempts", result)
+	}
+	query := s.query(1)
+	for name, value := range map[string]string{
+		"ID": "KTEST1", "PASSWORD": "secret", "action": "updateraw", "softwaretype": "davisweather",
+		"realtime": "1", "rtfreq": "2.5", "tempf": "77.0",
+	} {
+		if got := query.Get(name); got != value {
+			t.Errorf("parameter %s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestUploadRejected(t *testing.T) {
+	s := newStandIn([]int{http.StatusUnauthorized}, []string{"unauthorized"})
+	defer s.server.Close()
+	u, err := New(Options{StationID: "KTEST1", Key: "wrong", URL: s.server.URL, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := u.Upload(context.Background(), testReport(t, `{"temperature":77}`))
+	if result.Err != ErrRejected || result.Attempts != 1 || result.Status != http.StatusUnauthorized {
+		t.Errorf("Result = %+v, want rejected without retry", result)
+	}
+	if _, ok := s.query(0)["realtime"]; ok {
+		t.Error("standard upload sent realtime parameter")
+	}
+
+	result = u.Upload(context.Background(), &davisweather.Report{})
+	if result.Err != ErrNoObservation || result.Attempts != 0 {
+		t.Errorf("Result = %+v, want no observation", result)
+	}
+}